@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+// boostRequest is the body accepted by the boost endpoint. Zero values
+// fall back to the AutoBoost targets in settings.json
+type boostRequest struct {
+	Duration    int32 `json:"duration,omitempty"`
+	Temperature int32 `json:"temperature,omitempty"`
+}
+
+// mfaRequest is the body accepted by the mfa endpoint
+type mfaRequest struct {
+	Code string `json:"code"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// newAPIServer returns an http.Server exposing the control API for d
+func newAPIServer(d *daemon, c config.APIConfig) *http.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status", method(http.MethodGet, d.handleStatus))
+	mux.HandleFunc("/boost", method(http.MethodPost, d.handleBoost))
+	mux.HandleFunc("/autoboost/pause", method(http.MethodPost, d.handleAutoBoost(true)))
+	mux.HandleFunc("/autoboost/resume", method(http.MethodPost, d.handleAutoBoost(false)))
+	mux.HandleFunc("/collect", method(http.MethodPost, d.handleCollect))
+	mux.HandleFunc("/mfa", method(http.MethodPost, d.handleMFA))
+
+	// The health endpoints are left unauthenticated so they can be
+	// used by Docker and other supervisors
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", method(http.MethodGet, d.handleHealthz))
+	root.HandleFunc("/readyz", method(http.MethodGet, d.handleReadyz))
+	root.Handle("/", requireToken(c.Token, mux))
+
+	return &http.Server{
+		Addr:         c.Address,
+		Handler:      root,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+}
+
+// requireToken rejects any request that doesn't carry the bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// method only allows requests with the given HTTP method through to h
+func method(m string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			w.Header().Set("Allow", m)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func (d *daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.status())
+}
+
+func (d *daemon) handleBoost(w http.ResponseWriter, r *http.Request) {
+	if d.thermostatCollector() == nil {
+		writeError(w, http.StatusConflict, errNoThermostat)
+		return
+	}
+
+	br := boostRequest{}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&br); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("unable to decode boost request"))
+			return
+		}
+	}
+
+	var err error
+
+	br.Duration, br.Temperature, err = d.boostTargets(br.Duration, br.Temperature)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	l := d.log.With("requestedBy", "api")
+	l.Info("Boosting the heating", "duration", br.Duration, "temperature", br.Temperature)
+
+	if err := d.boost(logger.NewContext(r.Context(), l), br.Duration, br.Temperature); err != nil {
+		l.Error("Unable to boost the heating", "err", err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, br)
+}
+
+func (d *daemon) handleAutoBoost(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := d.setAutoBoostPaused(paused); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+
+		d.log.Info("AutoBoost paused", "paused", paused, "requestedBy", "api")
+
+		writeJSON(w, http.StatusOK, d.status())
+	}
+}
+
+func (d *daemon) handleCollect(w http.ResponseWriter, r *http.Request) {
+	err := d.requestCollection(r.URL.Query().Get("collector"))
+
+	switch {
+	case errors.Is(err, errUnknownCollector):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errCollectorDisabled):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (d *daemon) handleMFA(w http.ResponseWriter, r *http.Request) {
+	t := d.thermostatCollector()
+	if t == nil {
+		writeError(w, http.StatusConflict, errNoThermostat)
+		return
+	}
+
+	mr := mfaRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(&mr); err != nil || mr.Code == "" {
+		writeError(w, http.StatusBadRequest, errors.New(`unable to decode MFA request, expected {"code": "123456"}`))
+		return
+	}
+
+	l := d.log.With("requestedBy", "api")
+
+	if err := t.SubmitMFACode(logger.NewContext(r.Context(), l), mr.Code); err != nil {
+		if errors.Is(err, collector.ErrNoMFAChallenge) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+
+		l.Error("Unable to log in to Hive with the MFA code", "err", err)
+		writeError(w, http.StatusBadGateway, err)
+
+		return
+	}
+
+	l.Info("Logged in to Hive with the MFA code")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	// The responses are plain structs, so an error means the client has gone away
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCollector is a Collector that returns a fixed set of readings
+type fakeCollector struct {
+	name string
+	wrs  []dbpkg.WriteRequest
+	err  error
+}
+
+func (f *fakeCollector) Name() string            { return f.name }
+func (f *fakeCollector) Interval() time.Duration { return time.Hour }
+func (f *fakeCollector) Collect(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	return f.wrs, f.err
+}
+
+// committingCollector is a fakeCollector which counts the times it's committed
+type committingCollector struct {
+	fakeCollector
+	commits int
+}
+
+func (c *committingCollector) Commit() { c.commits++ }
+
+func newTestServer(t *testing.T) (*daemon, http.Handler) {
+	conf := &config.Config{
+		Thermostat: config.ThermostatConfig{
+			CollectorConfig: config.CollectorConfig{Enabled: true, Interval: "10m"},
+		},
+		API: config.APIConfig{Enabled: true, Token: "secret"},
+	}
+
+	thermostat, err := collector.NewThermostat(conf.Thermostat)
+	assert.NoError(t, err)
+
+	d := newDaemon(conf, []collector.Collector{thermostat}, &fakeStore{})
+
+	return d, newAPIServer(d, conf.API).Handler
+}
+
+func doRequest(h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestAPIAuth(t *testing.T) {
+	_, h := newTestServer(t)
+
+	t.Run("should reject requests without a token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, doRequest(h, http.MethodGet, "/status", "").Code)
+	})
+
+	t.Run("should reject requests with the wrong token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, doRequest(h, http.MethodGet, "/status", "wrong").Code)
+	})
+
+	t.Run("should accept requests with the correct token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, doRequest(h, http.MethodGet, "/status", "secret").Code)
+	})
+
+	t.Run("should reject requests using the wrong method", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, doRequest(h, http.MethodGet, "/autoboost/pause", "secret").Code)
+	})
+}
+
+func TestAPIAutoBoost(t *testing.T) {
+	a := assert.New(t)
+	d, h := newTestServer(t)
+
+	rec := doRequest(h, http.MethodPost, "/autoboost/pause", "secret")
+	a.Equal(http.StatusOK, rec.Code)
+	a.True(d.thermostat.AutoBoostPaused())
+
+	var s status
+	a.NoError(json.NewDecoder(rec.Body).Decode(&s))
+	a.True(s.AutoBoostPaused)
+	a.True(s.Collectors[collector.ThermostatName].Enabled)
+
+	a.Equal(http.StatusOK, doRequest(h, http.MethodPost, "/autoboost/resume", "secret").Code)
+	a.False(d.thermostat.AutoBoostPaused())
+}
+
+func TestAPICollect(t *testing.T) {
+	t.Run("should accept a request for an enabled collector", func(t *testing.T) {
+		d, h := newTestServer(t)
+		assert.NoError(t, d.schedule())
+
+		assert.Equal(t, http.StatusAccepted, doRequest(h, http.MethodPost, "/collect?collector=thermostat", "secret").Code)
+	})
+
+	t.Run("should accept a request for every collector when none is specified", func(t *testing.T) {
+		d, h := newTestServer(t)
+		assert.NoError(t, d.schedule())
+
+		assert.Equal(t, http.StatusAccepted, doRequest(h, http.MethodPost, "/collect", "secret").Code)
+	})
+
+	t.Run("should return conflict for a disabled collector", func(t *testing.T) {
+		_, h := newTestServer(t)
+
+		assert.Equal(t, http.StatusConflict, doRequest(h, http.MethodPost, "/collect?collector=weather", "secret").Code)
+	})
+
+	t.Run("should return not found for an unknown collector", func(t *testing.T) {
+		_, h := newTestServer(t)
+
+		assert.Equal(t, http.StatusNotFound, doRequest(h, http.MethodPost, "/collect?collector=unknown", "secret").Code)
+	})
+}
+
+func TestAPIMFA(t *testing.T) {
+	t.Run("should reject a request without a code", func(t *testing.T) {
+		_, h := newTestServer(t)
+
+		req := httptest.NewRequest(http.MethodPost, "/mfa", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer secret")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should return conflict when logging in isn't waiting for a code", func(t *testing.T) {
+		a := assert.New(t)
+		_, h := newTestServer(t)
+
+		req := httptest.NewRequest(http.MethodPost, "/mfa", strings.NewReader(`{"code": "123456"}`))
+		req.Header.Set("Authorization", "Bearer secret")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		a.Equal(http.StatusConflict, rec.Code)
+		a.Contains(rec.Body.String(), collector.ErrNoMFAChallenge.Error())
+	})
+}
+
+func TestAPIAutoBoostWithoutThermostat(t *testing.T) {
+	d := newDaemon(&config.Config{API: config.APIConfig{Token: "secret"}}, nil, &fakeStore{})
+	h := newAPIServer(d, d.conf.API).Handler
+
+	assert.Equal(t, http.StatusConflict, doRequest(h, http.MethodPost, "/autoboost/pause", "secret").Code)
+	assert.Equal(t, http.StatusConflict, doRequest(h, http.MethodPost, "/boost", "secret").Code)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/simondrake/home-stats/internal/config"
+)
+
+const configUsage = `usage:
+  home-stats config check [-config settings.json]
+  home-stats config migrate [-config settings.json] [-dry-run]`
+
+// runConfig implements the config subcommand. check validates the settings
+// file, including any environment overrides, and migrate upgrades it to the
+// current version
+func runConfig(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, in JSON, YAML or TOML")
+
+	switch args[0] {
+	case "check":
+		_ = fs.Parse(args[1:])
+
+		return checkConfig(os.Stdout, *configFile)
+	case "migrate":
+		dryRun := fs.Bool("dry-run", false, "print the migrated settings rather than rewriting the file")
+
+		_ = fs.Parse(args[1:])
+
+		return migrateConfig(os.Stdout, *configFile, *dryRun)
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+}
+
+// checkConfig prints every problem with the settings file to w, returning 1 if there are any
+func checkConfig(w io.Writer, fileName string) int {
+	conf, err := config.New(fileName)
+	if err != nil {
+		fmt.Fprintf(w, "unable to initialise config: %+v\n", err)
+		return 1
+	}
+
+	for _, warning := range conf.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+
+	err = conf.Validate()
+
+	var verr *config.ValidationError
+
+	switch {
+	case errors.As(err, &verr):
+		fmt.Fprintf(w, "%s has %d problem(s):\n", fileName, len(verr.Problems))
+
+		for _, p := range verr.Problems {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+
+		return 1
+	case err != nil:
+		fmt.Fprintf(w, "%+v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(w, "%s is valid\n", fileName)
+
+	return 0
+}
+
+// migrateConfig upgrades the settings file to the current version, keeping
+// the original alongside it with a .bak suffix. When dryRun is set, the
+// upgraded file is printed to w instead
+func migrateConfig(w io.Writer, fileName string, dryRun bool) int {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(w, "unable to read %s: %+v\n", fileName, err)
+		return 1
+	}
+
+	format := config.FormatOf(fileName)
+
+	migrated, changes, err := config.Migrate(format, b)
+	if err != nil {
+		fmt.Fprintf(w, "unable to migrate %s: %+v\n", fileName, err)
+		return 1
+	}
+
+	if migrated == nil {
+		fmt.Fprintf(w, "%s is already version %d\n", fileName, config.CurrentVersion)
+		return 0
+	}
+
+	if dryRun {
+		_, _ = w.Write(migrated)
+		return 0
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		fmt.Fprintf(w, "unable to stat %s: %+v\n", fileName, err)
+		return 1
+	}
+
+	if err := ioutil.WriteFile(fileName+".bak", b, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(w, "unable to back up %s: %+v\n", fileName, err)
+		return 1
+	}
+
+	if err := ioutil.WriteFile(fileName, migrated, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(w, "unable to write %s: %+v\n", fileName, err)
+		return 1
+	}
+
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\n", c)
+	}
+
+	fmt.Fprintf(w, "%s has been migrated to version %d, the original is in %s.bak\n", fileName, config.CurrentVersion, fileName)
+
+	if format != config.JSON {
+		fmt.Fprintln(w, "comments aren't kept when migrating, so copy any you need from the original")
+	}
+
+	return 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, s string) string {
+	dir, err := ioutil.TempDir("", "home-stats")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "settings.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(s), 0600))
+
+	return path
+}
+
+func TestCheckConfig(t *testing.T) {
+	t.Run("should report a valid settings file", func(t *testing.T) {
+		var b bytes.Buffer
+		path := writeConfig(t, `{"version": 2, "database": {"uri": "http://localhost:8086", "database": "home"}}`)
+
+		assert.Equal(t, 0, checkConfig(&b, path))
+		assert.Equal(t, path+" is valid\n", b.String())
+	})
+
+	t.Run("should list every problem", func(t *testing.T) {
+		var b bytes.Buffer
+		path := writeConfig(t, `{"weather": {"enabled": true, "interval": "1h"}}`)
+
+		assert.Equal(t, 1, checkConfig(&b, path))
+		assert.Equal(t, `warning: the settings file has been read as version 2, run home-stats config migrate to upgrade it
+`+path+` has 4 problem(s):
+  weather.city: must be set
+  weather.apiKey: must be set
+  database.uri: must be set
+  database.database: must be set
+`, b.String())
+	})
+
+	t.Run("should report a settings file that can't be read", func(t *testing.T) {
+		var b bytes.Buffer
+
+		assert.Equal(t, 1, checkConfig(&b, "non-existent"))
+		assert.Contains(t, b.String(), "unable to open file")
+	})
+}
+
+func TestMigrateConfig(t *testing.T) {
+	const legacy = `{"interval": "10m", "weather": {"enabled": true}, "influxDBConfig": {"uri": "http://localhost:8086"}}`
+
+	t.Run("should rewrite a legacy settings file and keep a backup", func(t *testing.T) {
+		a := assert.New(t)
+
+		var b bytes.Buffer
+		path := writeConfig(t, legacy)
+
+		a.Equal(0, migrateConfig(&b, path, false))
+		a.Equal(`interval has been moved to weather.interval
+influxDBConfig has been renamed to database
+`+path+` has been migrated to version 2, the original is in `+path+`.bak
+`, b.String())
+
+		migrated, err := ioutil.ReadFile(path)
+		a.NoError(err)
+		a.JSONEq(`{"version": 2, "weather": {"enabled": true, "interval": "10m"}, "database": {"uri": "http://localhost:8086"}}`, string(migrated))
+
+		backup, err := ioutil.ReadFile(path + ".bak")
+		a.NoError(err)
+		a.Equal(legacy, string(backup))
+	})
+
+	t.Run("should only print the migrated settings file on a dry run", func(t *testing.T) {
+		a := assert.New(t)
+
+		var b bytes.Buffer
+		path := writeConfig(t, legacy)
+
+		a.Equal(0, migrateConfig(&b, path, true))
+		a.JSONEq(`{"version": 2, "weather": {"enabled": true, "interval": "10m"}, "database": {"uri": "http://localhost:8086"}}`, b.String())
+
+		unchanged, err := ioutil.ReadFile(path)
+		a.NoError(err)
+		a.Equal(legacy, string(unchanged))
+	})
+
+	t.Run("should leave a current settings file alone", func(t *testing.T) {
+		var b bytes.Buffer
+		path := writeConfig(t, `{"version": 2}`)
+
+		assert.Equal(t, 0, migrateConfig(&b, path, false))
+		assert.Equal(t, path+" is already version 2\n", b.String())
+	})
+}
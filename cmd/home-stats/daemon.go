@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/alert"
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/logger"
+	"github.com/simondrake/home-stats/pkg/scheduler"
+)
+
+const (
+	// alertsJob is the name of the scheduler job that checks the alert health rules
+	alertsJob = "alerts"
+
+	// shutdownTimeout is how long in-flight work is given to
+	// finish once a shutdown has been requested
+	shutdownTimeout = 10 * time.Second
+)
+
+var (
+	errUnknownCollector  = errors.New("unknown collector")
+	errCollectorDisabled = errors.New("collector is disabled")
+	errNoThermostat      = errors.New("thermostat collector is not enabled")
+	errInvalidBoost      = errors.New("duration and temperature must be greater than zero")
+)
+
+// reading is a point most recently stored by a collector
+type reading struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Fields      map[string]interface{} `json:"fields"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
+
+// collectorStatus describes the outcome of the most recent collection runs
+type collectorStatus struct {
+	Enabled     bool      `json:"enabled"`
+	Interval    string    `json:"interval,omitempty"`
+	LastRun     time.Time `json:"lastRun,omitempty"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	// ConsecutiveFailures is the number of runs that have failed
+	// since the last successful run
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+}
+
+// store is the subset of the database client used by the daemon. It's
+// shared with the collectors that read measurements back
+type store interface {
+	collector.History
+	Write(ctx context.Context, wr dbpkg.WriteRequest) error
+	Ping(ctx context.Context) error
+}
+
+// sink is somewhere, other than the database, that readings are published to
+type sink interface {
+	Publish(ctx context.Context, wrs []dbpkg.WriteRequest) error
+}
+
+// daemon holds the collectors and the runtime state shared between
+// the scheduler and the HTTP API
+type daemon struct {
+	db    store
+	sinks []sink
+	// log is nil, which discards everything, unless set by runDaemon
+	log *logger.Logger
+	// alerts is nil if alerting isn't enabled
+	alerts *alert.Manager
+
+	// mu guards the settings and collectors, which are replaced when the
+	// settings file is reloaded, as well as the readings and statuses
+	mu         sync.RWMutex
+	conf       *config.Config
+	collectors map[string]collector.Collector
+	// thermostat is the Hive thermostat collector, or nil if it isn't enabled
+	thermostat *collector.Thermostat
+	readings   map[string][]reading
+	statuses   map[string]*collectorStatus
+
+	// reloadMu serialises reloads of the settings file
+	reloadMu sync.Mutex
+
+	scheduler *scheduler.Scheduler
+}
+
+func newDaemon(conf *config.Config, collectors []collector.Collector, db store) *daemon {
+	d := &daemon{
+		conf:       conf,
+		db:         db,
+		collectors: map[string]collector.Collector{},
+		readings:   map[string][]reading{},
+		statuses:   map[string]*collectorStatus{},
+	}
+
+	d.scheduler = scheduler.New(scheduler.WithSkipHandler(func(name string) {
+		d.log.Warn("Skipping collection as the previous collection is still in progress", "collector", name)
+	}))
+
+	for name, c := range conf.Collectors() {
+		d.statuses[name] = &collectorStatus{Enabled: c.Enabled, Interval: c.Interval}
+	}
+
+	for _, c := range collectors {
+		d.collectors[c.Name()] = c
+
+		if t, ok := c.(*collector.Thermostat); ok {
+			d.thermostat = t
+		}
+	}
+
+	return d
+}
+
+// config returns the current settings
+func (d *daemon) config() *config.Config {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.conf
+}
+
+// collector returns the named collector, if it is enabled
+func (d *daemon) collector(name string) (collector.Collector, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	c, ok := d.collectors[name]
+
+	return c, ok
+}
+
+// thermostatCollector returns the Hive thermostat collector, or nil if it isn't enabled
+func (d *daemon) thermostatCollector() *collector.Thermostat {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.thermostat
+}
+
+// collectorNames returns the sorted names of the enabled collectors
+func (d *daemon) collectorNames() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	names := make([]string, 0, len(d.collectors))
+	for n := range d.collectors {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// schedule registers every collector to be run on its interval,
+// using the jitter and runOnStartup settings from its section
+func (d *daemon) schedule() error {
+	sections := d.config().Collectors()
+
+	for _, name := range d.collectorNames() {
+		section := sections[name]
+
+		if err := d.scheduleCollector(name, section, section.RunOnStartup); err != nil {
+			return err
+		}
+	}
+
+	if d.alerts != nil {
+		return d.scheduler.Add(scheduler.Job{
+			Name:     alertsJob,
+			Interval: d.alerts.Interval(),
+			Run:      d.checkAlerts,
+		})
+	}
+
+	return nil
+}
+
+func (d *daemon) scheduleCollector(name string, section config.CollectorConfig, runOnStartup bool) error {
+	c, ok := d.collector(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnknownCollector, name)
+	}
+
+	jitter, err := parseOptionalDuration(section.Jitter)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s jitter: %w", name, err)
+	}
+
+	return d.scheduler.Add(scheduler.Job{
+		Name:       name,
+		Interval:   c.Interval(),
+		Jitter:     jitter,
+		RunOnStart: runOnStartup,
+		Run: func(ctx context.Context) {
+			d.collect(ctx, name)
+		},
+	})
+}
+
+// run runs the scheduled collectors, each in its own goroutine, until ctx is
+// cancelled. Collections that are in progress when ctx is cancelled are given
+// shutdownTimeout to finish before their own context is cancelled
+func (d *daemon) run(ctx context.Context) {
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-workCtx.Done():
+			return
+		}
+
+		t := time.NewTimer(shutdownTimeout)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+			d.log.Warn("Shutdown timeout reached, cancelling in-flight collections")
+			cancelWork()
+		case <-workCtx.Done():
+		}
+	}()
+
+	d.scheduler.Start(ctx, workCtx)
+
+	<-ctx.Done()
+
+	d.scheduler.Wait()
+}
+
+// collect runs the named collector, writes its readings to the database and records the outcome
+func (d *daemon) collect(ctx context.Context, name string) {
+	c, ok := d.collector(name)
+	if !ok {
+		return
+	}
+
+	l := d.log.With("collector", name)
+	ctx = logger.NewContext(ctx, l)
+
+	l.Info("Collecting statistics")
+
+	start := time.Now()
+	wrs, err := c.Collect(ctx)
+
+	// A collector can return readings alongside an error, in which
+	// case the readings are still stored
+	var writeErr error
+
+	for _, wr := range wrs {
+		if werr := d.db.Write(ctx, wr); werr != nil && writeErr == nil {
+			writeErr = fmt.Errorf("error writing %s measurement: %w", wr.Measurement, werr)
+		}
+	}
+
+	if writeErr == nil {
+		if cm, ok := c.(collector.Committer); ok {
+			cm.Commit()
+		}
+	} else if err == nil {
+		err = writeErr
+	}
+
+	if err != nil {
+		l.Error("Collection failed", "duration", time.Since(start), "err", err)
+	} else {
+		l.Debug("Collection finished", "readings", len(wrs), "duration", time.Since(start))
+	}
+
+	// Sinks are best effort, so a failure doesn't fail the collection
+	if len(wrs) > 0 {
+		for _, s := range d.sinks {
+			if serr := s.Publish(ctx, wrs); serr != nil {
+				l.Error("Unable to publish readings", "err", serr)
+			}
+		}
+	}
+
+	d.recordRun(name, wrs, err)
+
+	if d.alerts != nil {
+		d.alerts.ObserveReadings(ctx, wrs)
+	}
+}
+
+// checkAlerts evaluates the alert health rules against the current readiness of the daemon
+func (d *daemon) checkAlerts(ctx context.Context) {
+	r := d.readiness(ctx)
+
+	h := alert.Health{Collectors: map[string]alert.CollectorHealth{}}
+
+	for name, c := range r.Collectors {
+		if c.Enabled {
+			h.Collectors[name] = alert.CollectorHealth{ConsecutiveFailures: c.ConsecutiveFailures, LastError: c.LastError}
+		}
+	}
+
+	if r.Token != nil {
+		h.TokenError = r.Token.LastError
+	}
+
+	if r.Database != nil {
+		h.DatabaseError = r.Database.Error
+	}
+
+	d.alerts.ObserveHealth(ctx, h)
+}
+
+// requestCollection runs the named collector as soon as possible, or every
+// enabled collector if name is empty
+func (d *daemon) requestCollection(name string) error {
+	if name == "" {
+		for _, n := range d.collectorNames() {
+			if err := d.scheduler.Trigger(n); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if _, ok := d.collector(name); !ok {
+		if _, ok := d.collectorStatus(name); ok {
+			return errCollectorDisabled
+		}
+
+		return errUnknownCollector
+	}
+
+	return d.scheduler.Trigger(name)
+}
+
+// boost boosts the heating on the configured thermostat, regardless
+// of whether AutoBoost is enabled or paused
+func (d *daemon) boost(ctx context.Context, targetDuration, targetTemperature int32) error {
+	t := d.thermostatCollector()
+	if t == nil {
+		return errNoThermostat
+	}
+
+	return t.Boost(ctx, targetDuration, targetTemperature)
+}
+
+// boostTargets fills in a zero duration or temperature with the AutoBoost targets
+func (d *daemon) boostTargets(targetDuration, targetTemperature int32) (int32, int32, error) {
+	ab := d.config().Thermostat.AutoBoost
+
+	if targetDuration == 0 {
+		targetDuration = ab.TargetDuration
+	}
+
+	if targetTemperature == 0 {
+		targetTemperature = ab.TargetTemperature
+	}
+
+	if targetDuration <= 0 || targetTemperature <= 0 {
+		return 0, 0, errInvalidBoost
+	}
+
+	return targetDuration, targetTemperature, nil
+}
+
+func (d *daemon) setMode(ctx context.Context, mode hivepkg.Mode) error {
+	t := d.thermostatCollector()
+	if t == nil {
+		return errNoThermostat
+	}
+
+	return t.SetMode(ctx, mode)
+}
+
+func (d *daemon) cancelBoost(ctx context.Context) error {
+	t := d.thermostatCollector()
+	if t == nil {
+		return errNoThermostat
+	}
+
+	return t.CancelBoost(ctx)
+}
+
+func (d *daemon) setAutoBoostPaused(paused bool) error {
+	t := d.thermostatCollector()
+	if t == nil {
+		return errNoThermostat
+	}
+
+	t.SetAutoBoostPaused(paused)
+
+	return nil
+}
+
+func (d *daemon) recordRun(name string, wrs []dbpkg.WriteRequest, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(wrs) > 0 {
+		readings := make([]reading, 0, len(wrs))
+		for _, wr := range wrs {
+			readings = append(readings, reading(wr))
+		}
+
+		d.readings[name] = readings
+	}
+
+	s, ok := d.statuses[name]
+	if !ok {
+		return
+	}
+
+	s.LastRun = time.Now()
+
+	if err != nil {
+		s.LastError = err.Error()
+		s.ConsecutiveFailures++
+		return
+	}
+
+	s.LastSuccess = s.LastRun
+	s.LastError = ""
+	s.ConsecutiveFailures = 0
+}
+
+func (d *daemon) collectorStatus(name string) (collectorStatus, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	s, ok := d.statuses[name]
+	if !ok {
+		return collectorStatus{}, false
+	}
+
+	return *s, true
+}
+
+// status is a point-in-time snapshot of the daemon state
+type status struct {
+	AutoBoostPaused bool                       `json:"autoBoostPaused"`
+	Readings        map[string][]reading       `json:"readings"`
+	Collectors      map[string]collectorStatus `json:"collectors"`
+}
+
+func (d *daemon) status() status {
+	s := status{}
+
+	if t := d.thermostatCollector(); t != nil {
+		s.AutoBoostPaused = t.AutoBoostPaused()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	s.Readings = make(map[string][]reading, len(d.readings))
+	s.Collectors = make(map[string]collectorStatus, len(d.statuses))
+
+	for k, v := range d.readings {
+		s.Readings[k] = v
+	}
+
+	for k, v := range d.statuses {
+		s.Collectors[k] = *v
+	}
+
+	return s
+}
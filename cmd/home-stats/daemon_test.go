@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/alert"
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/simondrake/home-stats/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	published []dbpkg.WriteRequest
+	err       error
+}
+
+func (f *fakeSink) Publish(ctx context.Context, wrs []dbpkg.WriteRequest) error {
+	f.published = append(f.published, wrs...)
+	return f.err
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should return once the context is cancelled", func(t *testing.T) {
+		d := newDaemon(&config.Config{}, nil, &fakeStore{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			d.run(ctx)
+			close(done)
+		}()
+
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("run did not return after the context was cancelled")
+		}
+	})
+}
+
+func TestCollect(t *testing.T) {
+	wr := dbpkg.WriteRequest{
+		Measurement: "test",
+		Fields:      map[string]interface{}{"current": 1.0},
+	}
+
+	t.Run("should write readings and record a successful run", func(t *testing.T) {
+		a := assert.New(t)
+		s := &fakeStore{}
+		d := newDaemon(&config.Config{}, []collector.Collector{&fakeCollector{name: collector.WeatherName, wrs: []dbpkg.WriteRequest{wr}}}, s)
+
+		d.collect(context.Background(), collector.WeatherName)
+
+		a.Equal([]dbpkg.WriteRequest{wr}, s.writes)
+
+		st := d.status()
+		a.Len(st.Readings[collector.WeatherName], 1)
+		a.Equal(0, st.Collectors[collector.WeatherName].ConsecutiveFailures)
+		a.False(st.Collectors[collector.WeatherName].LastSuccess.IsZero())
+	})
+
+	t.Run("should write readings returned alongside an error", func(t *testing.T) {
+		a := assert.New(t)
+		s := &fakeStore{}
+		d := newDaemon(&config.Config{}, []collector.Collector{&fakeCollector{name: collector.WeatherName, wrs: []dbpkg.WriteRequest{wr}, err: errors.New("something went wrong")}}, s)
+
+		d.collect(context.Background(), collector.WeatherName)
+
+		a.Len(s.writes, 1)
+
+		st := d.status()
+		a.Equal(1, st.Collectors[collector.WeatherName].ConsecutiveFailures)
+		a.Equal("something went wrong", st.Collectors[collector.WeatherName].LastError)
+	})
+
+	t.Run("should only commit readings once they're written", func(t *testing.T) {
+		a := assert.New(t)
+		s := &fakeStore{writeErr: errors.New("influx is down")}
+		c := &committingCollector{fakeCollector: fakeCollector{name: collector.EnergyName, wrs: []dbpkg.WriteRequest{wr}}}
+		d := newDaemon(&config.Config{}, []collector.Collector{c}, s)
+
+		d.collect(context.Background(), collector.EnergyName)
+
+		a.Equal(0, c.commits)
+		a.Equal("error writing test measurement: influx is down", d.status().Collectors[collector.EnergyName].LastError)
+
+		s.writeErr = nil
+
+		d.collect(context.Background(), collector.EnergyName)
+
+		a.Equal(1, c.commits)
+		a.Equal([]dbpkg.WriteRequest{wr}, s.writes)
+	})
+
+	t.Run("should log failed collections with the collector's name", func(t *testing.T) {
+		a := assert.New(t)
+		d := newDaemon(&config.Config{}, []collector.Collector{&fakeCollector{name: collector.WeatherName, err: errors.New("something went wrong")}}, &fakeStore{})
+
+		var b bytes.Buffer
+		d.log = logger.New(&b)
+
+		d.collect(context.Background(), collector.WeatherName)
+
+		a.Contains(b.String(), `msg="Collection failed" collector=weather`)
+		a.Contains(b.String(), `err="something went wrong"`)
+	})
+
+	t.Run("should publish readings to sinks without failing the run", func(t *testing.T) {
+		a := assert.New(t)
+		sk := &fakeSink{err: errors.New("not connected")}
+		d := newDaemon(&config.Config{}, []collector.Collector{&fakeCollector{name: collector.WeatherName, wrs: []dbpkg.WriteRequest{wr}}}, &fakeStore{})
+		d.sinks = []sink{sk}
+
+		d.collect(context.Background(), collector.WeatherName)
+
+		a.Equal([]dbpkg.WriteRequest{wr}, sk.published)
+		a.Equal(0, d.status().Collectors[collector.WeatherName].ConsecutiveFailures)
+	})
+}
+
+func TestBoostTargets(t *testing.T) {
+	d := newDaemon(&config.Config{Thermostat: config.ThermostatConfig{AutoBoost: config.AutoBoost{TargetDuration: 30, TargetTemperature: 22}}}, nil, &fakeStore{})
+
+	duration, temperature, err := d.boostTargets(0, 24)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(30), duration)
+	assert.Equal(t, int32(24), temperature)
+
+	_, _, err = newDaemon(&config.Config{}, nil, &fakeStore{}).boostTargets(0, 0)
+	assert.Equal(t, errInvalidBoost, err)
+}
+
+func TestMQTTController(t *testing.T) {
+	c := mqttController{d: newDaemon(&config.Config{}, nil, &fakeStore{})}
+
+	assert.Equal(t, errNoThermostat, c.CancelBoost(context.Background()))
+	assert.Equal(t, errNoThermostat, c.SetAutoBoostPaused(true))
+}
+
+func TestCheckAlerts(t *testing.T) {
+	a := assert.New(t)
+
+	var bodies []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	conf := &config.Config{Alerts: config.AlertsConfig{
+		Rules:     []config.AlertRule{{Name: "database", Type: "database"}},
+		Notifiers: config.NotifiersConfig{Webhooks: []config.WebhookConfig{{URL: srv.URL}}},
+	}}
+
+	d := newDaemon(conf, nil, &fakeStore{pingErr: errors.New("connection refused")})
+
+	var err error
+	d.alerts, err = alert.New(conf.Alerts, d.failureThreshold(), nil)
+	a.NoError(err)
+
+	d.checkAlerts(context.Background())
+
+	a.Len(bodies, 1)
+	a.JSONEq(`{"title": "[FIRING] database", "message": "database is unreachable: connection refused", "status": "firing"}`, bodies[0])
+}
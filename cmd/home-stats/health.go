@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+)
+
+const (
+	defaultFailureThreshold = 3
+	databasePingTimeout     = 5 * time.Second
+)
+
+// databaseStatus describes whether the database could be reached
+type databaseStatus struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// healthReport is the body returned by the health and readiness endpoints
+type healthReport struct {
+	Healthy    bool                       `json:"healthy"`
+	Problems   []string                   `json:"problems,omitempty"`
+	Collectors map[string]collectorStatus `json:"collectors"`
+	Token      *tokenReport               `json:"token,omitempty"`
+	Database   *databaseStatus            `json:"database,omitempty"`
+}
+
+// publicHealthReport is the part of a healthReport returned by the health and
+// readiness endpoints. They don't require the token, so error messages, which
+// can include secrets such as API keys in request URLs, are left out
+type publicHealthReport struct {
+	Healthy    bool                       `json:"healthy"`
+	Problems   []string                   `json:"problems,omitempty"`
+	Collectors map[string]collectorHealth `json:"collectors"`
+}
+
+type collectorHealth struct {
+	LastSuccess         time.Time `json:"lastSuccess,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+// public returns the parts of r that are safe to return without the token
+func (r healthReport) public() publicHealthReport {
+	p := publicHealthReport{Healthy: r.Healthy, Problems: r.Problems, Collectors: map[string]collectorHealth{}}
+
+	for name, c := range r.Collectors {
+		p.Collectors[name] = collectorHealth{LastSuccess: c.LastSuccess, ConsecutiveFailures: c.ConsecutiveFailures}
+	}
+
+	return p
+}
+
+type tokenReport struct {
+	Valid bool `json:"valid"`
+	collector.TokenStatus
+}
+
+// health reports whether any enabled collector has been failing for at least
+// the configured number of consecutive runs
+func (d *daemon) health() healthReport {
+	threshold := d.failureThreshold()
+
+	s := d.status()
+
+	r := healthReport{Healthy: true, Collectors: s.Collectors}
+
+	for name, c := range s.Collectors {
+		if c.Enabled && c.ConsecutiveFailures >= threshold {
+			r.Healthy = false
+			r.Problems = append(r.Problems, fmt.Sprintf("%s collector has failed %d consecutive times", name, c.ConsecutiveFailures))
+		}
+	}
+
+	return r
+}
+
+// failureThreshold is the number of consecutive failures after which a collector is unhealthy
+func (d *daemon) failureThreshold() int {
+	threshold := d.config().API.FailureThreshold
+	if threshold <= 0 {
+		return defaultFailureThreshold
+	}
+
+	return threshold
+}
+
+// readiness extends health with the state of the Hive token and the database
+func (d *daemon) readiness(ctx context.Context) healthReport {
+	r := d.health()
+
+	if th := d.thermostatCollector(); th != nil {
+		t := th.TokenStatus()
+
+		r.Token = &tokenReport{
+			Valid:       t.LastError == "" && time.Now().Before(t.ExpiresAt),
+			TokenStatus: t,
+		}
+
+		if t.LastError != "" {
+			r.Healthy = false
+			r.Problems = append(r.Problems, "unable to generate hive token")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, databasePingTimeout)
+	defer cancel()
+
+	r.Database = &databaseStatus{Reachable: true}
+
+	if err := d.db.Ping(ctx); err != nil {
+		r.Healthy = false
+		r.Problems = append(r.Problems, "database is unreachable")
+		r.Database = &databaseStatus{Error: err.Error()}
+	}
+
+	return r
+}
+
+func (d *daemon) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, d.health())
+}
+
+func (d *daemon) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, d.readiness(r.Context()))
+}
+
+func writeHealth(w http.ResponseWriter, r healthReport) {
+	code := http.StatusOK
+	if !r.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, r.public())
+}
+
+// runHealthcheck implements the healthcheck subcommand, which queries the
+// health endpoint of a running daemon and exits non-zero if it isn't healthy
+func runHealthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, used to find the API address")
+	url := fs.String("url", "", "base URL of the API, overrides the address in the settings file")
+	ready := fs.Bool("ready", false, "check readiness rather than health")
+	timeout := fs.Duration("timeout", 10*time.Second, "time to wait for a response")
+
+	_ = fs.Parse(args)
+
+	base := *url
+	if base == "" {
+		conf, err := config.New(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to initialise config: %+v\n", err)
+			return 1
+		}
+
+		base = apiBaseURL(conf.API.Address)
+	}
+
+	endpoint := strings.TrimSuffix(base, "/") + "/healthz"
+	if *ready {
+		endpoint = strings.TrimSuffix(base, "/") + "/readyz"
+	}
+
+	client := &http.Client{Timeout: *timeout}
+
+	res, err := client.Get(endpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error requesting %s: %+v\n", endpoint, err)
+		return 1
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%s returned %s\n", endpoint, res.Status)
+		return 1
+	}
+
+	return 0
+}
+
+// apiBaseURL turns a listen address such as ":8080" into a URL that can be
+// used to reach the API from the same host
+func apiBaseURL(address string) string {
+	if strings.HasPrefix(address, ":") {
+		address = "localhost" + address
+	}
+
+	return "http://" + address
+}
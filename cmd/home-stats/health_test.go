@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	writes   []dbpkg.WriteRequest
+	writeErr error
+	pingErr  error
+}
+
+func (f *fakeStore) Write(ctx context.Context, wr dbpkg.WriteRequest) error {
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+
+	f.writes = append(f.writes, wr)
+	return nil
+}
+
+func (f *fakeStore) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f *fakeStore) Query(ctx context.Context, measurement, field string, from, to time.Time) ([]dbpkg.Point, error) {
+	return nil, nil
+}
+
+func TestHealth(t *testing.T) {
+	newDaemonWithStore := func(s store) *daemon {
+		return newDaemon(&config.Config{
+			Weather: config.WeatherConfig{
+				CollectorConfig: config.CollectorConfig{Enabled: true},
+			},
+			API: config.APIConfig{FailureThreshold: 2},
+		}, nil, s)
+	}
+
+	t.Run("should be healthy when no collector has failed", func(t *testing.T) {
+		d := newDaemonWithStore(&fakeStore{})
+
+		rec := doRequest(newAPIServer(d, d.conf.API).Handler, http.MethodGet, "/healthz", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("should be unhealthy once a collector reaches the failure threshold", func(t *testing.T) {
+		a := assert.New(t)
+		d := newDaemonWithStore(&fakeStore{})
+
+		d.recordRun(collector.WeatherName, nil, errors.New("something went wrong"))
+		a.True(d.health().Healthy)
+
+		d.recordRun(collector.WeatherName, nil, errors.New("something went wrong"))
+		r := d.health()
+		a.False(r.Healthy)
+		a.Equal(2, r.Collectors[collector.WeatherName].ConsecutiveFailures)
+
+		rec := doRequest(newAPIServer(d, d.conf.API).Handler, http.MethodGet, "/healthz", "")
+		a.Equal(http.StatusServiceUnavailable, rec.Code)
+
+		d.recordRun(collector.WeatherName, nil, nil)
+		a.True(d.health().Healthy)
+	})
+
+	t.Run("should ignore failures of disabled collectors", func(t *testing.T) {
+		d := newDaemonWithStore(&fakeStore{})
+
+		for i := 0; i < 5; i++ {
+			d.recordRun(collector.ThermostatName, nil, errors.New("something went wrong"))
+		}
+
+		assert.True(t, d.health().Healthy)
+	})
+
+	t.Run("should not be ready when the database is unreachable", func(t *testing.T) {
+		a := assert.New(t)
+		d := newDaemonWithStore(&fakeStore{pingErr: errors.New("connection refused")})
+
+		r := d.readiness(context.Background())
+		a.False(r.Healthy)
+		a.False(r.Database.Reachable)
+		a.Equal("connection refused", r.Database.Error)
+
+		rec := doRequest(newAPIServer(d, d.conf.API).Handler, http.MethodGet, "/readyz", "")
+		a.Equal(http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("should not return error messages, which can contain secrets", func(t *testing.T) {
+		a := assert.New(t)
+		d := newDaemonWithStore(&fakeStore{pingErr: errors.New("dial tcp: lookup influx?token=secret")})
+
+		d.recordRun(collector.WeatherName, nil, errors.New(`Get "https://api.openweathermap.org/data/2.5/weather?appid=secret": timeout`))
+
+		for _, path := range []string{"/healthz", "/readyz"} {
+			rec := doRequest(newAPIServer(d, d.conf.API).Handler, http.MethodGet, path, "")
+
+			a.NotContains(rec.Body.String(), "secret", path)
+			a.Contains(rec.Body.String(), `"consecutiveFailures":1`, path)
+		}
+	})
+
+	t.Run("should be ready when the database is reachable", func(t *testing.T) {
+		d := newDaemonWithStore(&fakeStore{})
+
+		rec := doRequest(newAPIServer(d, d.conf.API).Handler, http.MethodGet, "/readyz", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080", apiBaseURL(":8080"))
+	assert.Equal(t, "http://127.0.0.1:8080", apiBaseURL("127.0.0.1:8080"))
+}
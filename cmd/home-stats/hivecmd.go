@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/logger"
+	"github.com/simondrake/home-stats/pkg/totp"
+	"golang.org/x/term"
+)
+
+const hiveUsage = `usage:
+  home-stats hive login [-config settings.json]
+  home-stats hive status [-config settings.json]
+  home-stats hive boost [-config settings.json] [-duration 30] [-temp 22]`
+
+// runHive implements the hive command. login stores a refresh token in the
+// keyring, status prints the state of the thermostat and boost boosts the
+// heating, defaulting to the AutoBoost targets
+func runHive(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, hiveUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("hive "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, in JSON, YAML or TOML")
+
+	var duration, temp *int
+
+	switch args[0] {
+	case "login", "status":
+	case "boost":
+		duration = fs.Int("duration", 0, "minutes to boost the heating for, defaulting to thermostat.autoBoost.targetDuration")
+		temp = fs.Int("temp", 0, "temperature to boost the heating to, defaulting to thermostat.autoBoost.targetTemperature")
+	default:
+		fmt.Fprintln(os.Stderr, hiveUsage)
+		return 2
+	}
+
+	_ = fs.Parse(args[1:])
+
+	conf, l, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		return 1
+	}
+
+	ctx := logger.NewContext(context.Background(), l)
+
+	if args[0] == "login" {
+		if err := hiveLogin(ctx, conf.Thermostat, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			return 1
+		}
+
+		return 0
+	}
+
+	if !conf.Thermostat.Enabled {
+		fmt.Fprintln(os.Stderr, errNoThermostat)
+		return 1
+	}
+
+	t, err := collector.NewThermostat(conf.Thermostat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create thermostat: %+v\n", err)
+		return 1
+	}
+
+	if args[0] == "status" {
+		ns, err := t.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			return 1
+		}
+
+		printHiveStatus(os.Stdout, ns)
+
+		return 0
+	}
+
+	d := newDaemon(conf, []collector.Collector{t}, nil)
+	d.log = l
+
+	targetDuration, targetTemperature, err := d.boostTargets(int32(*duration), int32(*temp))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := d.boost(ctx, targetDuration, targetTemperature); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Boosted the heating to %d°C for %d minutes\n", targetTemperature, targetDuration)
+
+	return 0
+}
+
+// hiveLogin logs in to Hive with the username and password, prompting for
+// them and any MFA code if they aren't in the settings, and stores the
+// refresh token and remembered device in the keyring so that the password
+// can be removed from the settings
+func hiveLogin(ctx context.Context, c config.ThermostatConfig, in io.Reader, out io.Writer) error {
+	if c.Keyring.File == "" || c.Keyring.Passphrase == "" {
+		return errors.New("thermostat.keyring.file and thermostat.keyring.passphrase must be set to log in")
+	}
+
+	r := bufio.NewReader(in)
+
+	if c.Username == "" {
+		fmt.Fprint(out, "Hive username: ")
+
+		username, err := readLine(r)
+		if err != nil {
+			return fmt.Errorf("unable to read the username: %w", err)
+		}
+
+		c.Username = username
+	}
+
+	// Only a password in the settings needs removing once the refresh token is stored
+	passwordInSettings := c.Password != ""
+
+	if c.Password == "" {
+		fmt.Fprint(out, "Hive password: ")
+
+		password, err := readPassword(in, r)
+		fmt.Fprintln(out)
+
+		if err != nil {
+			return fmt.Errorf("unable to read the password: %w", err)
+		}
+
+		c.Password = password
+	}
+
+	timeout, err := parseOptionalDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("unable to parse timeout: %w", err)
+	}
+
+	// A device remembered by an earlier login doesn't need an MFA code
+	_, device, err := collector.LoadCredentials(c)
+	if err != nil {
+		return err
+	}
+
+	h := hivepkg.New(hivepkg.Config{
+		Username:                 c.Username,
+		Password:                 c.Password,
+		SSOPoolID:                c.HiveSSO.PoolID,
+		SSOPublicCognitoClientID: c.HiveSSO.PublicCognitoClientID,
+		Device:                   device,
+		MFACode:                  promptMFACode(r, out, c.MFA),
+		Timeout:                  timeout,
+	}, nil)
+
+	if err := h.GenerateTokenWithContext(ctx); err != nil {
+		return fmt.Errorf("unable to log in to Hive: %w", err)
+	}
+
+	if h.RefreshToken == "" {
+		return errors.New("no refresh token was returned by Hive")
+	}
+
+	if err := collector.SaveCredentials(c, h.RefreshToken, h.Device); err != nil {
+		return err
+	}
+
+	printLogin(out, c, h.Device.Key != "" && h.Device.Key != device.Key, passwordInSettings)
+
+	return nil
+}
+
+// printLogin prints the outcome of logging in. newDevice is set when Hive has remembered
+// this device, and passwordInSettings when the password was read from the settings
+func printLogin(out io.Writer, c config.ThermostatConfig, newDevice, passwordInSettings bool) {
+	fmt.Fprintf(out, "Logged in to Hive as %s, the refresh token has been saved to %s\n", c.Username, c.Keyring.File)
+
+	if newDevice {
+		fmt.Fprintln(out, "Hive has remembered this device, so an MFA code won't be needed to log in again")
+	}
+
+	if passwordInSettings {
+		fmt.Fprintln(out, "thermostat.password can now be removed from the settings")
+	}
+}
+
+// promptMFACode returns an MFACodeFunc that asks for the code, or generates
+// it when the challenge is for an authenticator app and there's a TOTP secret
+func promptMFACode(r *bufio.Reader, out io.Writer, c config.MFAConfig) hivepkg.MFACodeFunc {
+	return func(ctx context.Context, challenge, destination string) (string, error) {
+		if challenge == hivepkg.ChallengeSoftwareTokenMFA && c.TOTPSecret != "" {
+			return totp.Code(c.TOTPSecret, time.Now())
+		}
+
+		if challenge == hivepkg.ChallengeSMSMFA {
+			fmt.Fprintf(out, "Enter the code sent to %s: ", destination)
+		} else {
+			fmt.Fprint(out, "Enter the code from your authenticator app: ")
+		}
+
+		return readLine(r)
+	}
+}
+
+// readLine reads a line from r without its line ending
+func readLine(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || s == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+// readPassword reads a password without echoing it when in is a terminal,
+// and otherwise reads a line, so that the password can be piped in
+func readPassword(in io.Reader, r *bufio.Reader) (string, error) {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		b, err := term.ReadPassword(int(f.Fd()))
+		return string(b), err
+	}
+
+	return readLine(r)
+}
+
+func printHiveStatus(out io.Writer, ns hivepkg.NodeStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	heating := "unknown"
+	if ns.HeatingKnown {
+		heating = "off"
+		if ns.HeatingOn {
+			heating = "on"
+		}
+	}
+
+	fmt.Fprintf(w, "Temperature\t%.1f°C\n", ns.Temperature)
+	fmt.Fprintf(w, "Target\t%.1f°C\n", ns.TargetTemperature)
+	fmt.Fprintf(w, "Mode\t%s\n", ns.Mode)
+	fmt.Fprintf(w, "Heating\t%s\n", heating)
+
+	w.Flush()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/simondrake/home-stats/internal/config"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintHiveStatus(t *testing.T) {
+	var b bytes.Buffer
+
+	printHiveStatus(&b, hivepkg.NodeStatus{Temperature: 19.46, TargetTemperature: 21, Mode: "SCHEDULE", HeatingOn: true, HeatingKnown: true})
+
+	assert.Equal(t, `Temperature  19.5°C
+Target       21.0°C
+Mode         SCHEDULE
+Heating      on
+`, b.String())
+}
+
+func TestHiveLogin(t *testing.T) {
+	t.Run("should require a keyring to store the refresh token in", func(t *testing.T) {
+		var b bytes.Buffer
+
+		err := hiveLogin(context.Background(), config.ThermostatConfig{Username: "user"}, strings.NewReader("password\n"), &b)
+
+		assert.EqualError(t, err, "thermostat.keyring.file and thermostat.keyring.passphrase must be set to log in")
+		assert.Empty(t, b.String())
+	})
+
+	t.Run("should read a piped username and password", func(t *testing.T) {
+		a := assert.New(t)
+		r := bufio.NewReader(strings.NewReader("user\r\npassword"))
+
+		username, err := readLine(r)
+		a.NoError(err)
+		a.Equal("user", username)
+
+		password, err := readPassword(r, r)
+		a.NoError(err)
+		a.Equal("password", password)
+
+		_, err = readLine(r)
+		a.Equal(io.EOF, err)
+	})
+
+	t.Run("should only suggest removing a password that is in the settings", func(t *testing.T) {
+		a := assert.New(t)
+		c := config.ThermostatConfig{Username: "user", Keyring: config.Keyring{File: "hive.keyring"}}
+
+		var b bytes.Buffer
+		printLogin(&b, c, false, true)
+		a.Equal(`Logged in to Hive as user, the refresh token has been saved to hive.keyring
+thermostat.password can now be removed from the settings
+`, b.String())
+
+		b.Reset()
+		printLogin(&b, c, true, false)
+		a.Equal(`Logged in to Hive as user, the refresh token has been saved to hive.keyring
+Hive has remembered this device, so an MFA code won't be needed to log in again
+`, b.String())
+	})
+}
@@ -1,136 +1,114 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/simondrake/home-stats/internal/config"
-	dbpkg "github.com/simondrake/home-stats/pkg/db"
-	hivepkg "github.com/simondrake/home-stats/pkg/hive"
-	weatherpkg "github.com/simondrake/home-stats/pkg/weather"
+	"github.com/simondrake/home-stats/pkg/logger"
 )
 
+const usage = `usage: home-stats <command> [flags]
+
+commands:
+  run             collect statistics on each collector's interval until stopped
+  once            run every enabled collector once and exit
+  hive login      log in to Hive and store a refresh token in the keyring
+  hive status     print the thermostat temperature, target, mode and heating state
+  hive boost      boost the heating
+  weather now     print the current weather
+  report cost     print the estimated heating cost for each day
+  config check    check the settings file for problems
+  config migrate  upgrade the settings file to the current version
+  healthcheck     check the health of a running home-stats using its API
+  version         print the build date and Go version
+
+run is the default when no command is given. Use home-stats <command> -h to list the flags of a command.`
+
 func main() {
-	conf, err := config.New("settings.json")
+	args := os.Args[1:]
+
+	// Earlier versions only ran the daemon, so a missing command, or only flags, still does
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelp(args[0])) {
+		args = append([]string{"run"}, args...)
+	}
+
+	switch args[0] {
+	case "run":
+		os.Exit(runDaemon(args[1:]))
+	case "once":
+		os.Exit(runOnce(args[1:]))
+	case "hive":
+		os.Exit(runHive(args[1:]))
+	case "weather":
+		os.Exit(runWeather(args[1:]))
+	case "report":
+		os.Exit(runReport(args[1:]))
+	case "config":
+		os.Exit(runConfig(args[1:]))
+	case "healthcheck":
+		os.Exit(runHealthcheck(args[1:]))
+	case "version":
+		printVersion(os.Stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// loadConfig reads and validates the settings file, returning it along with
+// a logger, writing to stderr, configured by its log section. Any warnings
+// about the settings file are logged
+func loadConfig(fileName string) (*config.Config, *logger.Logger, error) {
+	conf, err := config.New(fileName)
 	if err != nil {
-		log.Fatalf("unable to initialise config: %+v", err)
+		return nil, nil, fmt.Errorf("unable to initialise config: %w", err)
 	}
 
-	hive := hivepkg.New(hivepkg.Config{
-		Username:                 conf.Thermostat.Username,
-		Password:                 conf.Thermostat.Password,
-		SSOPoolID:                conf.Thermostat.HiveSSO.PoolID,
-		SSOPublicCognitoClientID: conf.Thermostat.HiveSSO.PublicCognitoClientID,
-	}, &http.Client{})
-
-	weather := weatherpkg.New(weatherpkg.Config{
-		City:    conf.Weather.City,
-		Country: conf.Weather.Country,
-		APIKey:  conf.Weather.APIKey,
-		Units:   conf.Weather.Units,
-	}, nil)
-
-	db := dbpkg.New(dbpkg.Config{
-		URI:      conf.Database.URI,
-		Username: conf.Database.Username,
-		Password: conf.Database.Password,
-		Database: conf.Database.Database,
-	})
-
-	thermostatInterval, err := time.ParseDuration(conf.Thermostat.Interval)
+	l := newLogger(conf.Log, os.Stderr)
+
+	for _, w := range conf.Warnings {
+		l.Warn(w, "file", fileName)
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("%w (run home-stats config check for details)", err)
+	}
+
+	return conf, l, nil
+}
+
+// newLogger creates a logger from the log section of the settings file.
+// Invalid settings are reported by Validate, so fall back to the defaults
+func newLogger(c config.LogConfig, w io.Writer) *logger.Logger {
+	level, err := logger.ParseLevel(c.Level)
 	if err != nil {
-		log.Fatalf("unable to parse thermostat interval: %+v", err)
+		level = logger.LevelInfo
 	}
 
-	weatherInterval, err := time.ParseDuration(conf.Weather.Interval)
+	format, err := logger.ParseFormat(c.Format)
 	if err != nil {
-		log.Fatalf("unable to parse weather interval: %+v", err)
+		format = logger.Logfmt
 	}
 
-	fmt.Printf(`Config Values set
-  Thermostat Enabled: %t
-  Thermostat Interval: %s
-  AutoBoost Enabled: %t
-  AutoBoost Min Temperature: %f
-  Weather Enabled: %t
-  Weather Interval: %s
-
-`,
-		conf.Thermostat.Enabled, conf.Thermostat.Interval, conf.Thermostat.AutoBoost.Enabled, conf.Thermostat.AutoBoost.MinTemperature, conf.Weather.Enabled, conf.Weather.Interval)
-
-	it := time.NewTicker(thermostatInterval)
-	wt := time.NewTicker(weatherInterval)
-
-	for {
-		select {
-		case <-it.C:
-			if conf.Thermostat.Enabled {
-				log.Println("Getting theromostat statistics")
-
-				if err := hive.GenerateToken(); err != nil {
-					fmt.Printf("error generating token: %+v", err)
-					log.Fatalf("error generating token: %+v", err)
-				}
-
-				thermostatTemp, err := hive.GetTempForNode(conf.Thermostat.ThermostatID)
-				if err != nil {
-					fmt.Printf("error getting temp for thermostat (%s): %+v", conf.Thermostat.ThermostatID, err)
-					log.Fatalf("error getting temp for thermostat (%s): %+v", conf.Thermostat.ThermostatID, err)
-				}
-
-				db.Write(context.Background(), dbpkg.WriteRequest{
-					Measurement: "thermostat",
-					Tags: map[string]string{
-						"unit": "temperature",
-					},
-					Fields: map[string]interface{}{
-						"current": thermostatTemp,
-					},
-					Timestamp: time.Now(),
-				})
-
-				// If AutoBoost is enabled, we check if the minimum temperature has been met.
-				// If it has we boost the heating
-				if conf.Thermostat.AutoBoost.Enabled && thermostatTemp <= conf.Thermostat.AutoBoost.MinTemperature {
-					log.Println("Boosting heating")
-
-					err := hive.BoostHeating(
-						conf.Thermostat.ThermostatID,
-						conf.Thermostat.AutoBoost.TargetDuration,
-						conf.Thermostat.AutoBoost.TargetTemperature,
-					)
-					if err != nil {
-						fmt.Printf("error boosting the heating: %+v", err)
-						log.Fatalf("error boosting the heating: %+v", err)
-					}
-				}
-			}
-
-		case <-wt.C:
-			if conf.Weather.Enabled {
-				log.Println("Getting weather statistics")
-
-				currentWeather, err := weather.GetCurrentWeather()
-				if err != nil {
-					fmt.Printf("error getting current weather: %+v \n", err)
-					log.Fatalf("error getting current weather: %+v", err)
-				}
-
-				db.Write(context.Background(), dbpkg.WriteRequest{
-					Measurement: "weather",
-					Tags: map[string]string{
-						"unit": "temperature",
-					},
-					Fields: map[string]interface{}{
-						"current": currentWeather.Main.Temperature,
-					},
-					Timestamp: time.Now(),
-				})
-			}
-
-		}
+	return logger.New(w, logger.WithLevel(level), logger.WithFormat(format))
+}
+
+// parseOptionalDuration parses an optional duration from the settings file,
+// returning zero when it isn't set
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
 	}
+
+	return time.ParseDuration(s)
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+// mqttController carries out the heating commands received over MQTT
+type mqttController struct {
+	d *daemon
+}
+
+// log returns the logger for a command, which identifies it as requested over MQTT
+func (c mqttController) log(ctx context.Context) *logger.Logger {
+	return logger.FromContext(ctx, c.d.log).With("requestedBy", "mqtt")
+}
+
+func (c mqttController) Boost(ctx context.Context, duration, temperature int32) error {
+	duration, temperature, err := c.d.boostTargets(duration, temperature)
+	if err != nil {
+		return err
+	}
+
+	c.log(ctx).Info("Boosting the heating", "duration", duration, "temperature", temperature)
+
+	return c.d.boost(ctx, duration, temperature)
+}
+
+func (c mqttController) SetMode(ctx context.Context, mode hivepkg.Mode) error {
+	c.log(ctx).Info("Setting the heating mode", "mode", mode)
+
+	return c.d.setMode(ctx, mode)
+}
+
+func (c mqttController) CancelBoost(ctx context.Context) error {
+	c.log(ctx).Info("Cancelling the boost")
+
+	return c.d.cancelBoost(ctx)
+}
+
+func (c mqttController) SetAutoBoostPaused(paused bool) error {
+	if err := c.d.setAutoBoostPaused(paused); err != nil {
+		return err
+	}
+
+	c.d.log.Info("AutoBoost paused", "paused", paused, "requestedBy", "mqtt")
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+)
+
+// runOnce implements the once command, which runs every enabled collector,
+// or a single one, once and exits. It's intended to be run by cron
+func runOnce(args []string) int {
+	fs := flag.NewFlagSet("once", flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, in JSON, YAML or TOML")
+	name := fs.String("collector", "", "only run this collector")
+
+	_ = fs.Parse(args)
+
+	conf, l, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		return 1
+	}
+
+	db := dbpkg.New(dbpkg.Config{
+		URI:      conf.Database.URI,
+		Username: conf.Database.Username,
+		Password: conf.Database.Password,
+		Database: conf.Database.Database,
+		Logger:   l,
+	})
+	defer db.Close()
+
+	collectors, err := collector.Enabled(conf, collector.Deps{History: db})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to initialise collectors: %+v\n", err)
+		return 1
+	}
+
+	d := newDaemon(conf, collectors, db)
+	d.log = l
+
+	names := d.collectorNames()
+	if *name != "" {
+		if _, ok := d.collector(*name); !ok {
+			fmt.Fprintf(os.Stderr, "%s collector is not enabled\n", *name)
+			return 1
+		}
+
+		names = []string{*name}
+	}
+
+	return d.once(context.Background(), os.Stderr, names)
+}
+
+// once runs the named collectors one after another, printing a summary to w
+// and returning 1 if any of them failed
+func (d *daemon) once(ctx context.Context, w io.Writer, names []string) int {
+	for _, n := range names {
+		d.collect(ctx, n)
+	}
+
+	statuses := d.status().Collectors
+
+	var failed int
+
+	for _, n := range names {
+		if statuses[n].LastError != "" {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "%d of %d collector(s) failed\n", failed, len(names))
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnce(t *testing.T) {
+	wr := dbpkg.WriteRequest{Measurement: "test", Fields: map[string]interface{}{"current": 1.0}}
+
+	t.Run("should run each collector and write its readings", func(t *testing.T) {
+		a := assert.New(t)
+		s := &fakeStore{}
+		d := newDaemon(&config.Config{}, []collector.Collector{
+			&fakeCollector{name: collector.WeatherName, wrs: []dbpkg.WriteRequest{wr}},
+			&fakeCollector{name: collector.SpeedtestName, wrs: []dbpkg.WriteRequest{wr}},
+		}, s)
+
+		var b bytes.Buffer
+
+		a.Equal(0, d.once(context.Background(), &b, d.collectorNames()))
+		a.Len(s.writes, 2)
+		a.Empty(b.String())
+	})
+
+	t.Run("should fail if any collector fails", func(t *testing.T) {
+		a := assert.New(t)
+		d := newDaemon(&config.Config{}, []collector.Collector{
+			&fakeCollector{name: collector.WeatherName, wrs: []dbpkg.WriteRequest{wr}},
+			&fakeCollector{name: collector.SpeedtestName, err: errors.New("something went wrong")},
+		}, &fakeStore{})
+
+		var b bytes.Buffer
+
+		a.Equal(1, d.once(context.Background(), &b, d.collectorNames()))
+		a.Equal("1 of 2 collector(s) failed\n", b.String())
+	})
+}
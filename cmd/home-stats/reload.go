@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+// restartSettings are the sections and settings of the settings file whose
+// changes are only applied when home-stats is restarted
+var restartSettings = []string{"database", "api", "mqtt", "alerts", "log.format"}
+
+// reloadFile reads and validates the settings file and applies it to the
+// running daemon. The current settings are kept if the file is invalid
+func (d *daemon) reloadFile(fileName string) {
+	conf, err := config.New(fileName)
+	if err == nil {
+		err = conf.Validate()
+	}
+
+	if err != nil {
+		d.log.Error("Unable to reload the settings, keeping the current settings", "file", fileName, "err", err)
+		return
+	}
+
+	for _, w := range conf.Warnings {
+		d.log.Warn(w, "file", fileName)
+	}
+
+	d.reload(conf)
+}
+
+// reload applies conf, which must already be valid, to the running daemon.
+// Collectors whose section has changed are reconfigured, or replaced if they
+// can't be, and rescheduled; collectors that have been enabled or disabled
+// are started or stopped. A collector that can't be replaced keeps running
+// with its current settings
+func (d *daemon) reload(conf *config.Config) {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	changes := config.Diff(d.config(), conf)
+	if len(changes) == 0 {
+		d.log.Info("Settings reloaded, nothing has changed")
+		return
+	}
+
+	restart := map[string]bool{}
+
+	for _, c := range changes {
+		d.log.Info("Setting changed", "change", c)
+
+		for _, s := range restartSettings {
+			if c.Path == s || strings.HasPrefix(c.Path, s+".") {
+				restart[s] = true
+			}
+		}
+	}
+
+	// The level is validated, so can't fail to parse
+	if level, err := logger.ParseLevel(conf.Log.Level); err == nil {
+		d.log.SetLevel(level)
+	}
+
+	sections := conf.Collectors()
+
+	for _, name := range collector.Names() {
+		if err := d.reloadCollector(name, sections[name], conf, changes); err != nil {
+			d.log.Error("Unable to apply the new settings, keeping the current collector", "collector", name, "err", err)
+		}
+	}
+
+	d.mu.Lock()
+	d.conf = conf
+	d.mu.Unlock()
+
+	if len(restart) > 0 {
+		var names []string
+		for s := range restart {
+			names = append(names, s)
+		}
+
+		sort.Strings(names)
+
+		d.log.Warn("Some changes will only be applied when home-stats is restarted", "settings", strings.Join(names, ", "))
+	}
+}
+
+func (d *daemon) reloadCollector(name string, section config.CollectorConfig, conf *config.Config, changes []config.Change) error {
+	current, running := d.collector(name)
+
+	if !section.Enabled {
+		if !running {
+			return nil
+		}
+
+		if err := d.scheduler.Remove(name); err != nil {
+			return err
+		}
+
+		d.setCollector(name, nil, section)
+		d.log.Info("Stopped the collector", "collector", name)
+
+		return nil
+	}
+
+	if running && !sectionChanged(name, changes) {
+		return nil
+	}
+
+	reconfigured := false
+
+	if r, ok := current.(collector.Reconfigurable); ok && running {
+		var err error
+		if reconfigured, err = r.Reconfigure(conf); err != nil {
+			return err
+		}
+	}
+
+	if !reconfigured {
+		c, err := collector.New(name, conf, collector.Deps{History: d.db})
+		if err != nil {
+			return err
+		}
+
+		// Pausing AutoBoost isn't a setting, so it survives the thermostat being replaced
+		if old, ok := current.(*collector.Thermostat); ok {
+			if t, ok := c.(*collector.Thermostat); ok {
+				t.SetAutoBoostPaused(old.AutoBoostPaused())
+			}
+		}
+
+		current = c
+	}
+
+	d.setCollector(name, current, section)
+
+	// The job is added again, as its interval or jitter may have changed
+	if running {
+		if err := d.scheduler.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	if err := d.scheduleCollector(name, section, !running && section.RunOnStartup); err != nil {
+		return err
+	}
+
+	if running {
+		d.log.Info("Applied the new settings", "collector", name, "replaced", !reconfigured)
+	} else {
+		d.log.Info("Started the collector", "collector", name)
+	}
+
+	return nil
+}
+
+// setCollector replaces the named collector, removing it if c is nil
+func (d *daemon) setCollector(name string, c collector.Collector, section config.CollectorConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c == nil {
+		delete(d.collectors, name)
+	} else {
+		d.collectors[name] = c
+	}
+
+	if name == collector.ThermostatName {
+		d.thermostat, _ = c.(*collector.Thermostat)
+	}
+
+	if s, ok := d.statuses[name]; ok {
+		s.Enabled = section.Enabled
+		s.Interval = section.Interval
+	} else {
+		d.statuses[name] = &collectorStatus{Enabled: section.Enabled, Interval: section.Interval}
+	}
+}
+
+// sectionChanged reports whether any of changes are to the named section
+func sectionChanged(name string, changes []config.Change) bool {
+	for _, c := range changes {
+		if strings.HasPrefix(c.Path, name+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchConfig calls reload whenever the modification time or size of the
+// settings file changes, checking every interval until ctx is cancelled
+func watchConfig(ctx context.Context, l *logger.Logger, fileName string, interval time.Duration, reload func()) {
+	last, _ := os.Stat(fileName)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		// The file may briefly be missing while an editor replaces it
+		fi, err := os.Stat(fileName)
+		if err != nil {
+			continue
+		}
+
+		if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+			continue
+		}
+
+		last = fi
+
+		l.Info("The settings file has changed, reloading it", "file", fileName)
+		reload()
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/pkg/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func reloadTestConfig() *config.Config {
+	c := &config.Config{}
+
+	c.Thermostat.Enabled = true
+	c.Thermostat.Interval = "10m"
+	c.Thermostat.Username = "user"
+	c.Thermostat.Password = "password"
+	c.Thermostat.AutoBoost.Enabled = true
+	c.Thermostat.AutoBoost.MinTemperature = 16
+
+	c.Weather.Enabled = true
+	c.Weather.Interval = "1h"
+	c.Weather.City = "London"
+	c.Weather.APIKey = "key"
+
+	return c
+}
+
+func newReloadTestDaemon(t *testing.T, conf *config.Config) *daemon {
+	s := &fakeStore{}
+
+	collectors, err := collector.Enabled(conf, collector.Deps{History: s})
+	assert.NoError(t, err)
+
+	d := newDaemon(conf, collectors, s)
+	assert.NoError(t, d.schedule())
+
+	return d
+}
+
+func TestReload(t *testing.T) {
+	t.Run("should stop a collector that has been disabled", func(t *testing.T) {
+		a := assert.New(t)
+		d := newReloadTestDaemon(t, reloadTestConfig())
+
+		conf := reloadTestConfig()
+		conf.Weather.Enabled = false
+
+		d.reload(conf)
+
+		_, ok := d.collector(collector.WeatherName)
+		a.False(ok)
+		a.False(d.status().Collectors[collector.WeatherName].Enabled)
+		a.True(errors.Is(d.scheduler.Trigger(collector.WeatherName), scheduler.ErrUnknownJob))
+		a.Same(conf, d.config())
+	})
+
+	t.Run("should start a collector that has been enabled", func(t *testing.T) {
+		a := assert.New(t)
+
+		old := reloadTestConfig()
+		old.Weather.Enabled = false
+		d := newReloadTestDaemon(t, old)
+
+		d.reload(reloadTestConfig())
+
+		c, ok := d.collector(collector.WeatherName)
+		if a.True(ok) {
+			a.Equal("1h0m0s", c.Interval().String())
+		}
+
+		a.True(d.status().Collectors[collector.WeatherName].Enabled)
+		a.NoError(d.scheduler.Trigger(collector.WeatherName))
+	})
+
+	t.Run("should reconfigure the thermostat when only AutoBoost has changed", func(t *testing.T) {
+		a := assert.New(t)
+		d := newReloadTestDaemon(t, reloadTestConfig())
+		before := d.thermostatCollector()
+
+		conf := reloadTestConfig()
+		conf.Thermostat.AutoBoost.MinTemperature = 18
+		conf.Thermostat.Interval = "5m"
+
+		d.reload(conf)
+
+		a.Same(before, d.thermostatCollector())
+		a.Equal("5m0s", d.thermostatCollector().Interval().String())
+		a.Equal("5m", d.status().Collectors[collector.ThermostatName].Interval)
+	})
+
+	t.Run("should replace the thermostat when the Hive login has changed, keeping AutoBoost paused", func(t *testing.T) {
+		a := assert.New(t)
+		d := newReloadTestDaemon(t, reloadTestConfig())
+		before := d.thermostatCollector()
+		before.SetAutoBoostPaused(true)
+
+		conf := reloadTestConfig()
+		conf.Thermostat.Password = "new password"
+
+		d.reload(conf)
+
+		after := d.thermostatCollector()
+		a.NotSame(before, after)
+		a.True(after.AutoBoostPaused())
+	})
+
+	t.Run("should keep the current collector when the new one can't be created", func(t *testing.T) {
+		a := assert.New(t)
+		d := newReloadTestDaemon(t, reloadTestConfig())
+		before, _ := d.collector(collector.WeatherName)
+
+		conf := reloadTestConfig()
+		conf.Weather.Timeout = "soon"
+
+		d.reload(conf)
+
+		after, ok := d.collector(collector.WeatherName)
+		a.True(ok)
+		a.Same(before, after)
+		a.NoError(d.scheduler.Trigger(collector.WeatherName))
+	})
+}
+
+func TestReloadFile(t *testing.T) {
+	t.Run("should keep the current settings when the file is invalid", func(t *testing.T) {
+		a := assert.New(t)
+		conf := reloadTestConfig()
+		d := newReloadTestDaemon(t, conf)
+
+		d.reloadFile(writeConfig(t, `{"version": 2, "weather": {"enabled": true}}`))
+
+		a.Same(conf, d.config())
+		_, ok := d.collector(collector.WeatherName)
+		a.True(ok)
+	})
+}
+
+func TestWatchConfig(t *testing.T) {
+	t.Run("should reload when the settings file changes", func(t *testing.T) {
+		path := writeConfig(t, `{"version": 2}`)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		reloaded := make(chan struct{}, 1)
+
+		go watchConfig(ctx, nil, path, 10*time.Millisecond, func() {
+			reloaded <- struct{}{}
+		})
+
+		select {
+		case <-reloaded:
+			t.Fatal("reloaded before the settings file changed")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		assert.NoError(t, ioutil.WriteFile(path, []byte(`{"version": 2, "weather": {}}`), 0600))
+
+		select {
+		case <-reloaded:
+		case <-time.After(time.Second):
+			t.Fatal("did not reload after the settings file changed")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/internal/cost"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+)
+
+const (
+	reportDateFormat = "2006-01-02"
+	reportTimeout    = time.Minute
+)
+
+// runReport implements the report subcommand. The only report is cost, which
+// prints the estimated heating usage and cost for each day in a date range
+func runReport(args []string) int {
+	if len(args) == 0 || args[0] != "cost" {
+		fmt.Fprintln(os.Stderr, "usage: home-stats report cost [-from 2006-01-02] [-to 2006-01-02]")
+		return 2
+	}
+
+	today := time.Now().Format(reportDateFormat)
+
+	fs := flag.NewFlagSet("report cost", flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, in JSON, YAML or TOML")
+	fromFlag := fs.String("from", today, "first day of the report")
+	toFlag := fs.String("to", today, "last day of the report, inclusive")
+
+	_ = fs.Parse(args[1:])
+
+	from, err := time.ParseInLocation(reportDateFormat, *fromFlag, time.Local)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to parse -from: %+v\n", err)
+		return 2
+	}
+
+	to, err := time.ParseInLocation(reportDateFormat, *toFlag, time.Local)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to parse -to: %+v\n", err)
+		return 2
+	}
+
+	conf, err := config.New(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to initialise config: %+v\n", err)
+		return 1
+	}
+
+	e, err := cost.New(conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create cost estimator: %+v\n", err)
+		return 1
+	}
+
+	db := dbpkg.New(dbpkg.Config{
+		URI:      conf.Database.URI,
+		Username: conf.Database.Username,
+		Password: conf.Database.Password,
+		Database: conf.Database.Database,
+	})
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+
+	days, err := collector.EstimateCost(ctx, db, e, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to estimate cost: %+v\n", err)
+		return 1
+	}
+
+	printCostReport(os.Stdout, days)
+
+	return 0
+}
+
+func printCostReport(out io.Writer, days []cost.Day) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "Date\tBoiler on\tGas (kWh)\tCost")
+
+	var total cost.Day
+
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\n", d.Date.Format(reportDateFormat), d.BoilerOn.Round(time.Minute), d.KWh, d.Cost)
+
+		total.BoilerOn += d.BoilerOn
+		total.KWh += d.KWh
+		total.Cost += d.Cost
+	}
+
+	fmt.Fprintf(w, "Total\t%s\t%.2f\t%.2f\n", total.BoilerOn.Round(time.Minute), total.KWh, total.Cost)
+
+	w.Flush()
+}
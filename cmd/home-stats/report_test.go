@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/cost"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintCostReport(t *testing.T) {
+	var b bytes.Buffer
+
+	printCostReport(&b, []cost.Day{
+		{Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), BoilerOn: 90 * time.Minute, KWh: 36, Cost: 1.8},
+		{Date: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), BoilerOn: 30 * time.Minute, KWh: 12, Cost: 0.6},
+	})
+
+	assert.Equal(t, `Date        Boiler on  Gas (kWh)  Cost
+2021-01-01  1h30m0s    36.00      1.80
+2021-01-02  30m0s      12.00      0.60
+Total       2h0m0s     48.00      2.40
+`, b.String())
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/alert"
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/internal/mqtt"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+// runDaemon implements the run command, collecting statistics on each
+// collector's interval until SIGINT or SIGTERM is received
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, in JSON, YAML (.yaml or .yml) or TOML (.toml)")
+	watch := fs.Duration("watch", 10*time.Second, "how often to check the settings file for changes, or 0 to only reload it on SIGHUP")
+
+	_ = fs.Parse(args)
+
+	conf, l, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		return 1
+	}
+
+	// Libraries that log with the standard library logger are logged as info
+	log.SetFlags(0)
+	log.SetOutput(l.StdLogger(logger.LevelInfo).Writer())
+
+	logSettings(l, *configFile, conf)
+
+	db := dbpkg.New(dbpkg.Config{
+		URI:      conf.Database.URI,
+		Username: conf.Database.Username,
+		Password: conf.Database.Password,
+		Database: conf.Database.Database,
+		Logger:   l,
+	})
+
+	collectors, err := collector.Enabled(conf, collector.Deps{History: db})
+	if err != nil {
+		l.Error("Unable to initialise the collectors", "err", err)
+		return 1
+	}
+
+	d := newDaemon(conf, collectors, db)
+	d.log = l
+
+	if conf.Alerts.Enabled {
+		if d.alerts, err = alert.New(conf.Alerts, d.failureThreshold(), l); err != nil {
+			l.Error("Unable to initialise alerts", "err", err)
+			return 1
+		}
+	}
+
+	var publisher *mqtt.Publisher
+
+	if conf.MQTT.Enabled {
+		publisher = mqtt.New(conf, mqttController{d: d}, l)
+
+		if err := publisher.Connect(); err != nil {
+			l.Error("Unable to connect to the MQTT broker", "broker", conf.MQTT.Broker, "err", err)
+			return 1
+		}
+
+		d.sinks = append(d.sinks, publisher)
+	}
+
+	if err := d.schedule(); err != nil {
+		l.Error("Unable to schedule the collectors", "err", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		l.Info("Shutting down", "signal", sig)
+		cancel()
+	}()
+
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-hups:
+				l.Info("Received SIGHUP, reloading the settings")
+				d.reloadFile(*configFile)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if *watch > 0 {
+		go watchConfig(ctx, l, *configFile, *watch, func() {
+			d.reloadFile(*configFile)
+		})
+	}
+
+	var srv *http.Server
+
+	if conf.API.Enabled {
+		srv = newAPIServer(d, conf.API)
+		srv.ErrorLog = l.StdLogger(logger.LevelWarn)
+
+		go func() {
+			l.Info("API listening", "address", srv.Addr)
+
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				l.Error("Unable to run the API server", "err", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	d.run(ctx)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	if srv != nil {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			l.Error("Unable to shut down the API server", "err", err)
+		}
+	}
+
+	if publisher != nil {
+		publisher.Close()
+	}
+
+	db.Close()
+
+	l.Info("Shutdown complete")
+
+	return 0
+}
+
+// logSettings logs a summary of the settings that are in use
+func logSettings(l *logger.Logger, fileName string, conf *config.Config) {
+	l.Info("Settings loaded",
+		"file", fileName,
+		"autoBoost", conf.Thermostat.AutoBoost.Enabled,
+		"autoBoostMinTemperature", conf.Thermostat.AutoBoost.MinTemperature,
+		"api", conf.API.Enabled,
+		"mqtt", conf.MQTT.Enabled,
+		"alerts", conf.Alerts.Enabled,
+	)
+
+	sections := conf.Collectors()
+
+	for _, name := range collector.Names() {
+		l.Info("Collector settings", "collector", name, "enabled", sections[name].Enabled, "interval", sections[name].Interval)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// date is the time the binary was built, set by the Makefile and Dockerfile with -ldflags "-X main.date=..."
+var date string
+
+// printVersion prints the build date and Go version to w
+func printVersion(w io.Writer) {
+	built := date
+	if built == "" {
+		built = "from source"
+	}
+
+	fmt.Fprintf(w, "home-stats built %s with %s\n", built, runtime.Version())
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintVersion(t *testing.T) {
+	t.Run("should print the build date", func(t *testing.T) {
+		defer func(d string) { date = d }(date)
+		date = "2021-01-02T03:04:05Z"
+
+		var b bytes.Buffer
+
+		printVersion(&b)
+
+		assert.Equal(t, "home-stats built 2021-01-02T03:04:05Z with "+runtime.Version()+"\n", b.String())
+	})
+
+	t.Run("should say it was built from source without a date", func(t *testing.T) {
+		defer func(d string) { date = d }(date)
+		date = ""
+
+		var b bytes.Buffer
+
+		printVersion(&b)
+
+		assert.Equal(t, "home-stats built from source with "+runtime.Version()+"\n", b.String())
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/simondrake/home-stats/internal/collector"
+	"github.com/simondrake/home-stats/pkg/logger"
+	weatherpkg "github.com/simondrake/home-stats/pkg/weather"
+)
+
+const weatherUsage = "usage: home-stats weather now [-config settings.json]"
+
+// runWeather implements the weather command, printing the current weather from OpenWeatherMap
+func runWeather(args []string) int {
+	if len(args) == 0 || args[0] != "now" {
+		fmt.Fprintln(os.Stderr, weatherUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("weather now", flag.ExitOnError)
+	configFile := fs.String("config", "settings.json", "path to the settings file, in JSON, YAML or TOML")
+
+	_ = fs.Parse(args[1:])
+
+	conf, l, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		return 1
+	}
+
+	if !conf.Weather.Enabled {
+		fmt.Fprintln(os.Stderr, "weather collector is not enabled")
+		return 1
+	}
+
+	w, err := collector.NewWeather(conf.Weather)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create weather client: %+v\n", err)
+		return 1
+	}
+
+	cw, err := w.Current(logger.NewContext(context.Background(), l))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		return 1
+	}
+
+	printWeather(os.Stdout, cw, conf.Weather.Units)
+
+	return 0
+}
+
+func printWeather(out io.Writer, cw weatherpkg.CurrentWeather, units string) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	unit := temperatureUnit(units)
+
+	var conditions []string
+	for _, c := range cw.WeatherConditions {
+		conditions = append(conditions, c.Description)
+	}
+
+	fmt.Fprintf(w, "Location\t%s, %s\n", cw.Name, cw.Sys.Country)
+	fmt.Fprintf(w, "Temperature\t%.1f%s (feels like %.1f%s)\n", cw.Main.Temperature, unit, cw.Main.FeelsLike, unit)
+	fmt.Fprintf(w, "Humidity\t%d%%\n", cw.Main.Humidity)
+
+	if len(conditions) > 0 {
+		fmt.Fprintf(w, "Conditions\t%s\n", strings.Join(conditions, ", "))
+	}
+
+	w.Flush()
+}
+
+// temperatureUnit returns the unit of temperatures returned by OpenWeatherMap for units
+func temperatureUnit(units string) string {
+	switch units {
+	case "metric":
+		return "°C"
+	case "imperial":
+		return "°F"
+	default:
+		return "K"
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	weatherpkg "github.com/simondrake/home-stats/pkg/weather"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintWeather(t *testing.T) {
+	cw := weatherpkg.CurrentWeather{
+		Name:              "London",
+		Sys:               weatherpkg.Sys{Country: "GB"},
+		Main:              weatherpkg.Main{Temperature: 12.34, FeelsLike: 10.1, Humidity: 80},
+		WeatherConditions: []weatherpkg.WeatherCondition{{Description: "light rain"}, {Description: "mist"}},
+	}
+
+	t.Run("should print the temperature in the configured units", func(t *testing.T) {
+		var b bytes.Buffer
+
+		printWeather(&b, cw, "metric")
+
+		assert.Equal(t, `Location     London, GB
+Temperature  12.3°C (feels like 10.1°C)
+Humidity     80%
+Conditions   light rain, mist
+`, b.String())
+	})
+
+	t.Run("should default to kelvin", func(t *testing.T) {
+		var b bytes.Buffer
+
+		printWeather(&b, weatherpkg.CurrentWeather{Main: weatherpkg.Main{Temperature: 285.5}}, "")
+
+		assert.Contains(t, b.String(), "285.5K")
+		assert.NotContains(t, b.String(), "Conditions")
+	})
+}
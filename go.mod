@@ -3,8 +3,13 @@ module github.com/simondrake/home-stats
 go 1.15
 
 require (
-	github.com/aws/aws-sdk-go v1.36.2
+	github.com/BurntSushi/toml v0.3.0
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/influxdata/influxdb-client-go/v2 v2.2.0
 	github.com/openlyinc/pointy v1.1.2
 	github.com/stretchr/testify v1.5.1
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b // indirect
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
+	gopkg.in/yaml.v2 v2.3.0
 )
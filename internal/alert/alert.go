@@ -0,0 +1,367 @@
+// Package alert notifies when readings breach a threshold or the daemon
+// becomes unhealthy, and again once the problem has resolved
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/internal/notifiers"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/simondrake/home-stats/pkg/logger"
+	"github.com/simondrake/home-stats/pkg/notify"
+)
+
+const (
+	ruleReading   = "reading"
+	ruleCollector = "collector"
+	ruleToken     = "token"
+	ruleDatabase  = "database"
+
+	defaultInterval = time.Minute
+)
+
+// Health is the state of the daemon checked by the health rules
+type Health struct {
+	// Collectors is the status of each enabled collector, keyed by name
+	Collectors map[string]CollectorHealth
+	// TokenError is the most recent Hive token error, if any
+	TokenError string
+	// DatabaseError is set when the database couldn't be reached
+	DatabaseError string
+}
+
+// CollectorHealth is the outcome of the most recent runs of a collector
+type CollectorHealth struct {
+	ConsecutiveFailures int
+	LastError           string
+}
+
+type rule struct {
+	name        string
+	typ         string
+	measurement string
+	field       string
+	below       *float64
+	above       *float64
+	forDuration time.Duration
+	collector   string
+	failures    int
+}
+
+// state tracks a rule, or a rule for a single collector, whose condition is currently met
+type state struct {
+	since    time.Time
+	firing   bool
+	notified time.Time
+}
+
+// Manager evaluates the alert rules and sends notifications
+type Manager struct {
+	interval  time.Duration
+	repeat    time.Duration
+	rules     []rule
+	notifiers []notify.Notifier
+	log       *logger.Logger
+	now       func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*state
+}
+
+// New creates a Manager from the alerts section of the settings file. failureThreshold
+// is used by collector rules that don't set their own number of failures
+func New(c config.AlertsConfig, failureThreshold int, l *logger.Logger) (*Manager, error) {
+	m := &Manager{
+		interval:  defaultInterval,
+		notifiers: notifiers.New(c.Notifiers),
+		log:       l,
+		now:       time.Now,
+		states:    map[string]*state{},
+	}
+
+	var err error
+
+	if c.Interval != "" {
+		if m.interval, err = time.ParseDuration(c.Interval); err != nil {
+			return nil, fmt.Errorf("unable to parse interval: %w", err)
+		}
+	}
+
+	if c.RepeatInterval != "" {
+		if m.repeat, err = time.ParseDuration(c.RepeatInterval); err != nil {
+			return nil, fmt.Errorf("unable to parse repeatInterval: %w", err)
+		}
+	}
+
+	names := map[string]bool{}
+
+	for _, rc := range c.Rules {
+		r, err := newRule(rc, failureThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", rc.Name, err)
+		}
+
+		if names[r.name] {
+			return nil, fmt.Errorf("duplicate rule %q", r.name)
+		}
+
+		names[r.name] = true
+		m.rules = append(m.rules, r)
+	}
+
+	return m, nil
+}
+
+func newRule(c config.AlertRule, failureThreshold int) (rule, error) {
+	r := rule{
+		name:        c.Name,
+		typ:         c.Type,
+		measurement: c.Measurement,
+		field:       c.Field,
+		below:       c.Below,
+		above:       c.Above,
+		collector:   c.Collector,
+		failures:    c.Failures,
+	}
+
+	if r.name == "" {
+		return r, errors.New("name must be set")
+	}
+
+	switch r.typ {
+	case ruleReading:
+		if r.measurement == "" || r.field == "" {
+			return r, errors.New("measurement and field must be set")
+		}
+
+		if r.below == nil && r.above == nil {
+			return r, errors.New("below or above must be set")
+		}
+	case ruleCollector:
+		if r.failures <= 0 {
+			r.failures = failureThreshold
+		}
+	case ruleToken, ruleDatabase:
+	default:
+		return r, fmt.Errorf("unknown type %q", r.typ)
+	}
+
+	if c.For != "" {
+		d, err := time.ParseDuration(c.For)
+		if err != nil {
+			return r, fmt.Errorf("unable to parse for: %w", err)
+		}
+
+		r.forDuration = d
+	}
+
+	return r, nil
+}
+
+// Interval is how often ObserveHealth should be called
+func (m *Manager) Interval() time.Duration {
+	return m.interval
+}
+
+// ObserveReadings evaluates the reading rules against newly collected readings
+func (m *Manager) ObserveReadings(ctx context.Context, wrs []dbpkg.WriteRequest) {
+	var ns []notify.Notification
+
+	m.mu.Lock()
+
+	for _, r := range m.rules {
+		if r.typ != ruleReading {
+			continue
+		}
+
+		for _, wr := range wrs {
+			if wr.Measurement != r.measurement {
+				continue
+			}
+
+			v, ok := toFloat(wr.Fields[r.field])
+			if !ok {
+				continue
+			}
+
+			breached, threshold := r.breached(v)
+			msg := fmt.Sprintf("%s %s is %g, %s", r.measurement, r.field, v, threshold)
+
+			if n, ok := m.update(r.name, r, breached, msg); ok {
+				ns = append(ns, n)
+			}
+		}
+	}
+
+	m.mu.Unlock()
+
+	m.send(ctx, ns)
+}
+
+// ObserveHealth evaluates the collector, token and database rules
+func (m *Manager) ObserveHealth(ctx context.Context, h Health) {
+	var ns []notify.Notification
+
+	m.mu.Lock()
+
+	for _, r := range m.rules {
+		var (
+			n  notify.Notification
+			ok bool
+		)
+
+		switch r.typ {
+		case ruleCollector:
+			names := make([]string, 0, len(h.Collectors))
+			for name := range h.Collectors {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			for _, name := range names {
+				if r.collector != "" && r.collector != name {
+					continue
+				}
+
+				c := h.Collectors[name]
+				msg := fmt.Sprintf("%s collector has failed %d consecutive times: %s", name, c.ConsecutiveFailures, c.LastError)
+				if c.ConsecutiveFailures == 0 {
+					msg = fmt.Sprintf("%s collector is running successfully", name)
+				}
+
+				if n, ok := m.update(r.name+"/"+name, r, c.ConsecutiveFailures >= r.failures, msg); ok {
+					ns = append(ns, n)
+				}
+			}
+
+			continue
+		case ruleToken:
+			msg := "hive token generated successfully"
+			if h.TokenError != "" {
+				msg = "unable to generate hive token: " + h.TokenError
+			}
+
+			n, ok = m.update(r.name, r, h.TokenError != "", msg)
+		case ruleDatabase:
+			msg := "database is reachable"
+			if h.DatabaseError != "" {
+				msg = "database is unreachable: " + h.DatabaseError
+			}
+
+			n, ok = m.update(r.name, r, h.DatabaseError != "", msg)
+		default:
+			continue
+		}
+
+		if ok {
+			ns = append(ns, n)
+		}
+	}
+
+	m.mu.Unlock()
+
+	m.send(ctx, ns)
+}
+
+// update records whether the condition of the alert with the given key is met,
+// returning a notification if the alert has started firing, is due a repeat
+// notification or has resolved. The caller must hold mu
+func (m *Manager) update(key string, r rule, active bool, msg string) (notify.Notification, bool) {
+	now := m.now()
+	s, ok := m.states[key]
+
+	if !active {
+		if !ok {
+			return notify.Notification{}, false
+		}
+
+		delete(m.states, key)
+
+		if !s.firing {
+			return notify.Notification{}, false
+		}
+
+		return notify.Notification{Title: fmt.Sprintf("[RESOLVED] %s", r.name), Message: msg, Resolved: true}, true
+	}
+
+	if !ok {
+		s = &state{since: now}
+		m.states[key] = s
+	}
+
+	firing := notify.Notification{Title: fmt.Sprintf("[FIRING] %s", r.name), Message: msg}
+
+	if !s.firing {
+		if now.Sub(s.since) < r.forDuration {
+			return notify.Notification{}, false
+		}
+
+		s.firing = true
+		s.notified = now
+
+		return firing, true
+	}
+
+	if m.repeat > 0 && now.Sub(s.notified) >= m.repeat {
+		s.notified = now
+		return firing, true
+	}
+
+	return notify.Notification{}, false
+}
+
+func (m *Manager) send(ctx context.Context, ns []notify.Notification) {
+	for _, n := range ns {
+		if n.Resolved {
+			m.log.Info("Alert resolved", "title", n.Title, "message", n.Message)
+		} else {
+			m.log.Warn("Alert firing", "title", n.Title, "message", n.Message)
+		}
+
+		for _, nt := range m.notifiers {
+			if err := nt.Notify(ctx, n); err != nil {
+				m.log.Error("Unable to send alert notification", "title", n.Title, "err", err)
+			}
+		}
+	}
+}
+
+// breached reports whether v breaches the threshold of a reading rule,
+// along with a description of the threshold
+func (r rule) breached(v float64) (bool, string) {
+	if r.below != nil && v < *r.below {
+		return true, fmt.Sprintf("below %g", *r.below)
+	}
+
+	if r.above != nil && v > *r.above {
+		return true, fmt.Sprintf("above %g", *r.above)
+	}
+
+	if r.below != nil {
+		return false, fmt.Sprintf("no longer below %g", *r.below)
+	}
+
+	return false, fmt.Sprintf("no longer above %g", *r.above)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,184 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/simondrake/home-stats/pkg/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotifier struct {
+	sent []notify.Notification
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func newTestManager(t *testing.T, c config.AlertsConfig) (*Manager, *fakeNotifier, *fakeClock) {
+	m, err := New(c, 3, nil)
+	assert.NoError(t, err)
+
+	n := &fakeNotifier{}
+	clock := &fakeClock{now: time.Date(2021, 1, 10, 8, 0, 0, 0, time.UTC)}
+
+	m.notifiers = []notify.Notifier{n}
+	m.now = clock.Now
+
+	return m, n, clock
+}
+
+func thermostatReading(temp float64) []dbpkg.WriteRequest {
+	return []dbpkg.WriteRequest{{Measurement: "thermostat", Fields: map[string]interface{}{"current": temp}}}
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		rule config.AlertRule
+		err  string
+	}{
+		{config.AlertRule{Type: "token"}, `invalid rule "": name must be set`},
+		{config.AlertRule{Name: "a", Type: "humidity"}, `invalid rule "a": unknown type "humidity"`},
+		{config.AlertRule{Name: "a", Type: "reading", Field: "current", Below: float(1)}, `invalid rule "a": measurement and field must be set`},
+		{config.AlertRule{Name: "a", Type: "reading", Measurement: "weather", Field: "current"}, `invalid rule "a": below or above must be set`},
+		{config.AlertRule{Name: "a", Type: "database", For: "soon"}, `invalid rule "a": unable to parse for: time: invalid duration "soon"`},
+	} {
+		_, err := New(config.AlertsConfig{Rules: []config.AlertRule{tc.rule}}, 3, nil)
+		assert.EqualError(t, err, tc.err)
+	}
+
+	_, err := New(config.AlertsConfig{Rules: []config.AlertRule{{Name: "a", Type: "token"}, {Name: "a", Type: "database"}}}, 3, nil)
+	assert.EqualError(t, err, `duplicate rule "a"`)
+}
+
+func TestObserveReadings(t *testing.T) {
+	rules := []config.AlertRule{{Name: "indoor-cold", Type: "reading", Measurement: "thermostat", Field: "current", Below: float(16), For: "30m"}}
+
+	t.Run("should fire once the threshold has been breached for long enough", func(t *testing.T) {
+		a := assert.New(t)
+		m, n, clock := newTestManager(t, config.AlertsConfig{Rules: rules})
+
+		m.ObserveReadings(context.Background(), thermostatReading(15))
+		a.Empty(n.sent)
+
+		clock.now = clock.now.Add(20 * time.Minute)
+		m.ObserveReadings(context.Background(), thermostatReading(15.5))
+		a.Empty(n.sent)
+
+		clock.now = clock.now.Add(10 * time.Minute)
+		m.ObserveReadings(context.Background(), thermostatReading(15.5))
+		a.Equal([]notify.Notification{{Title: "[FIRING] indoor-cold", Message: "thermostat current is 15.5, below 16"}}, n.sent)
+	})
+
+	t.Run("should not fire if the reading recovers in time", func(t *testing.T) {
+		m, n, clock := newTestManager(t, config.AlertsConfig{Rules: rules})
+
+		m.ObserveReadings(context.Background(), thermostatReading(15))
+		clock.now = clock.now.Add(20 * time.Minute)
+		m.ObserveReadings(context.Background(), thermostatReading(17))
+		clock.now = clock.now.Add(20 * time.Minute)
+		m.ObserveReadings(context.Background(), thermostatReading(15))
+
+		assert.Empty(t, n.sent)
+	})
+
+	t.Run("should de-duplicate and resolve", func(t *testing.T) {
+		a := assert.New(t)
+		m, n, clock := newTestManager(t, config.AlertsConfig{Rules: []config.AlertRule{
+			{Name: "freezing", Type: "reading", Measurement: "weather", Field: "current", Below: float(0)},
+		}})
+
+		weather := func(temp float32) []dbpkg.WriteRequest {
+			return []dbpkg.WriteRequest{{Measurement: "weather", Fields: map[string]interface{}{"current": temp}}}
+		}
+
+		m.ObserveReadings(context.Background(), weather(-1))
+		clock.now = clock.now.Add(time.Hour)
+		m.ObserveReadings(context.Background(), weather(-2))
+		m.ObserveReadings(context.Background(), weather(1))
+
+		a.Equal([]notify.Notification{
+			{Title: "[FIRING] freezing", Message: "weather current is -1, below 0"},
+			{Title: "[RESOLVED] freezing", Message: "weather current is 1, no longer below 0", Resolved: true},
+		}, n.sent)
+	})
+
+	t.Run("should repeat while firing", func(t *testing.T) {
+		m, n, clock := newTestManager(t, config.AlertsConfig{RepeatInterval: "1h", Rules: []config.AlertRule{
+			{Name: "hot", Type: "reading", Measurement: "thermostat", Field: "current", Above: float(25)},
+		}})
+
+		m.ObserveReadings(context.Background(), thermostatReading(26))
+		clock.now = clock.now.Add(30 * time.Minute)
+		m.ObserveReadings(context.Background(), thermostatReading(26))
+		clock.now = clock.now.Add(30 * time.Minute)
+		m.ObserveReadings(context.Background(), thermostatReading(26))
+
+		assert.Len(t, n.sent, 2)
+	})
+}
+
+func TestObserveHealth(t *testing.T) {
+	t.Run("should alert on each failing collector", func(t *testing.T) {
+		a := assert.New(t)
+		m, n, _ := newTestManager(t, config.AlertsConfig{Rules: []config.AlertRule{{Name: "collector-failing", Type: "collector"}}})
+
+		m.ObserveHealth(context.Background(), Health{Collectors: map[string]CollectorHealth{
+			"thermostat": {ConsecutiveFailures: 3, LastError: "timeout"},
+			"weather":    {ConsecutiveFailures: 2, LastError: "timeout"},
+		}})
+
+		a.Equal([]notify.Notification{{Title: "[FIRING] collector-failing", Message: "thermostat collector has failed 3 consecutive times: timeout"}}, n.sent)
+
+		m.ObserveHealth(context.Background(), Health{Collectors: map[string]CollectorHealth{
+			"thermostat": {},
+			"weather":    {},
+		}})
+
+		a.Len(n.sent, 2)
+		a.Equal(notify.Notification{Title: "[RESOLVED] collector-failing", Message: "thermostat collector is running successfully", Resolved: true}, n.sent[1])
+	})
+
+	t.Run("should only alert on the configured collector", func(t *testing.T) {
+		m, n, _ := newTestManager(t, config.AlertsConfig{Rules: []config.AlertRule{{Name: "weather-failing", Type: "collector", Collector: "weather", Failures: 1}}})
+
+		m.ObserveHealth(context.Background(), Health{Collectors: map[string]CollectorHealth{
+			"thermostat": {ConsecutiveFailures: 5},
+			"weather":    {ConsecutiveFailures: 1, LastError: "timeout"},
+		}})
+
+		assert.Equal(t, []notify.Notification{{Title: "[FIRING] weather-failing", Message: "weather collector has failed 1 consecutive times: timeout"}}, n.sent)
+	})
+
+	t.Run("should alert on token and database errors", func(t *testing.T) {
+		a := assert.New(t)
+		m, n, _ := newTestManager(t, config.AlertsConfig{Rules: []config.AlertRule{
+			{Name: "token", Type: "token"},
+			{Name: "database", Type: "database"},
+		}})
+
+		m.ObserveHealth(context.Background(), Health{TokenError: "bad password", DatabaseError: "connection refused"})
+
+		a.Equal([]notify.Notification{
+			{Title: "[FIRING] token", Message: "unable to generate hive token: bad password"},
+			{Title: "[FIRING] database", Message: "database is unreachable: connection refused"},
+		}, n.sent)
+	})
+}
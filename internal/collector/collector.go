@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+)
+
+// Collector gathers readings from a single data source
+type Collector interface {
+	// Name is the name the collector is registered with, which is
+	// also the name of its section in the settings file
+	Name() string
+	// Interval is the time between collections
+	Interval() time.Duration
+	// Collect gathers the current readings, which are written to the database by the caller
+	Collect(ctx context.Context) ([]dbpkg.WriteRequest, error)
+}
+
+// Reconfigurable is implemented by collectors that can apply changes to the
+// settings file without being replaced, e.g. to keep a login
+type Reconfigurable interface {
+	// Reconfigure applies conf, returning false if the changes can't be
+	// applied and a new Collector is needed instead
+	Reconfigure(conf *config.Config) (bool, error)
+}
+
+// Committer is implemented by collectors that only return readings they
+// haven't returned before, so need to know when those readings are stored
+type Committer interface {
+	// Commit is called once every reading returned by the last Collect has
+	// been written. Until then, the same readings are returned again
+	Commit()
+}
+
+// Deps are the resources shared by the collectors, which are created once by
+// the caller rather than by each collector
+type Deps struct {
+	// History reads back the measurements that have been written
+	History History
+}
+
+// Factory creates a Collector from the settings file
+type Factory func(conf *config.Config, deps Deps) (Collector, error)
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Factory{}
+)
+
+// Register makes a collector available by name. It panics if
+// Register is called twice with the same name
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("collector %s already registered", name))
+	}
+
+	registry[name] = f
+}
+
+// Names returns the sorted names of every registered collector
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates the named collector from the settings file
+func New(name string, conf *config.Config, deps Deps) (Collector, error) {
+	mu.RLock()
+	f, ok := registry[name]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown collector: %s", name)
+	}
+
+	return f(conf, deps)
+}
+
+// Enabled creates every registered collector that is enabled in the settings file
+func Enabled(conf *config.Config, deps Deps) ([]Collector, error) {
+	sections := conf.Collectors()
+
+	var collectors []Collector
+
+	for _, name := range Names() {
+		section, ok := sections[name]
+		if !ok {
+			return nil, fmt.Errorf("no settings section for collector: %s", name)
+		}
+
+		if !section.Enabled {
+			continue
+		}
+
+		c, err := New(name, conf, deps)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create %s collector: %w", name, err)
+		}
+
+		collectors = append(collectors, c)
+	}
+
+	return collectors, nil
+}
+
+// parseDuration parses an optional duration from the settings file,
+// returning zero when it isn't set
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// parseInterval parses the interval of a collector section
+func parseInterval(c config.CollectorConfig) (time.Duration, error) {
+	i, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse interval: %w", err)
+	}
+
+	return i, nil
+}
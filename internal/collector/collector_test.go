@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, []string{CostName, EnergyName, SpeedtestName, ThermostatName, WeatherName}, Names())
+}
+
+func TestNew(t *testing.T) {
+	t.Run("should error for an unknown collector", func(t *testing.T) {
+		c, err := New("unknown", &config.Config{}, Deps{})
+
+		assert.Nil(t, c)
+		assert.EqualError(t, err, "unknown collector: unknown")
+	})
+
+	t.Run("should error when the interval can't be parsed", func(t *testing.T) {
+		c, err := New(WeatherName, &config.Config{}, Deps{})
+
+		assert.Nil(t, c)
+		assert.EqualError(t, err, `unable to parse interval: time: invalid duration ""`)
+	})
+
+	t.Run("should create the cost collector with the shared history", func(t *testing.T) {
+		a := assert.New(t)
+		conf := &config.Config{Cost: config.CostConfig{CollectorConfig: config.CollectorConfig{Interval: "1h"}, BoilerOutput: 24}}
+		h := &fakeHistory{}
+
+		c, err := New(CostName, conf, Deps{History: h})
+		a.NoError(err)
+		a.Equal(h, c.(*Cost).history)
+
+		_, err = New(CostName, conf, Deps{})
+		a.EqualError(err, "the cost collector needs the database to read the boiler state from")
+	})
+}
+
+func TestEnabled(t *testing.T) {
+	t.Run("should have a settings section for every collector", func(t *testing.T) {
+		a := assert.New(t)
+
+		sections := (&config.Config{}).Collectors()
+
+		for _, name := range Names() {
+			a.Contains(sections, name)
+		}
+	})
+
+	t.Run("should only create enabled collectors", func(t *testing.T) {
+		a := assert.New(t)
+
+		collectors, err := Enabled(&config.Config{
+			Weather: config.WeatherConfig{
+				CollectorConfig: config.CollectorConfig{Enabled: true, Interval: "3h"},
+			},
+		}, Deps{})
+
+		a.NoError(err)
+		a.Len(collectors, 1)
+		a.Equal(WeatherName, collectors[0].Name())
+		a.Equal("3h0m0s", collectors[0].Interval().String())
+	})
+
+	t.Run("should return an error when an enabled collector is misconfigured", func(t *testing.T) {
+		_, err := Enabled(&config.Config{
+			Thermostat: config.ThermostatConfig{
+				CollectorConfig: config.CollectorConfig{Enabled: true, Interval: "nope"},
+			},
+		}, Deps{})
+
+		assert.EqualError(t, err, `unable to create thermostat collector: unable to parse interval: time: invalid duration "nope"`)
+	})
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/internal/cost"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+)
+
+// CostName is the name of the heating cost estimation collector
+const CostName = "cost"
+
+func init() {
+	Register(CostName, func(conf *config.Config, deps Deps) (Collector, error) {
+		return NewCost(conf, deps.History)
+	})
+}
+
+// History is the subset of the database client used to read recorded measurements
+type History interface {
+	Query(ctx context.Context, measurement, field string, from, to time.Time) ([]dbpkg.Point, error)
+}
+
+// Cost writes a daily estimate of the gas used by, and cost of, the heating.
+// Each run updates the estimates for yesterday and today so far
+type Cost struct {
+	interval  time.Duration
+	estimator *cost.Estimator
+	history   History
+}
+
+// NewCost creates a Cost collector from the settings file. It reads the boiler
+// state recorded by the thermostat collector from h
+func NewCost(conf *config.Config, h History) (*Cost, error) {
+	if h == nil {
+		return nil, errors.New("the cost collector needs the database to read the boiler state from")
+	}
+
+	interval, err := parseInterval(conf.Cost.CollectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := cost.New(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cost{interval: interval, estimator: e, history: h}, nil
+}
+
+// Name implements Collector
+func (c *Cost) Name() string {
+	return CostName
+}
+
+// Interval implements Collector
+func (c *Cost) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect implements Collector. Each day is written at midnight, so later
+// runs overwrite the estimate for the same day
+func (c *Cost) Collect(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	now := time.Now().In(c.estimator.Location)
+	y, m, d := now.AddDate(0, 0, -1).Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	days, err := EstimateCost(ctx, c.history, c.estimator, from, now)
+	if err != nil {
+		return nil, err
+	}
+
+	wrs := make([]dbpkg.WriteRequest, 0, len(days))
+
+	for _, day := range days {
+		wrs = append(wrs, dbpkg.WriteRequest{
+			Measurement: "heating_cost",
+			Fields: map[string]interface{}{
+				"boilerOnMinutes": day.BoilerOn.Minutes(),
+				"kwh":             day.KWh,
+				"cost":            day.Cost,
+			},
+			Timestamp: day.Date,
+		})
+	}
+
+	return wrs, nil
+}
+
+// EstimateCost reads the boiler state recorded between from and to and
+// returns the estimated usage for each day
+func EstimateCost(ctx context.Context, h History, e *cost.Estimator, from, to time.Time) ([]cost.Day, error) {
+	// Include the state just before from, as it may extend into the period
+	ps, err := h.Query(ctx, BoilerMeasurement, BoilerOnField, from.Add(-e.MaxGap), to)
+	if err != nil {
+		return nil, fmt.Errorf("error reading boiler state: %w", err)
+	}
+
+	states, err := cost.States(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Estimate(states, from, to), nil
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/cost"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeHistory struct {
+	ps       []dbpkg.Point
+	err      error
+	from, to time.Time
+}
+
+func (f *fakeHistory) Query(ctx context.Context, measurement, field string, from, to time.Time) ([]dbpkg.Point, error) {
+	f.from, f.to = from, to
+	return f.ps, f.err
+}
+
+func TestEstimateCost(t *testing.T) {
+	e := &cost.Estimator{BoilerOutput: 12, Tariff: cost.Tariff{UnitRate: 0.1}, MaxGap: 20 * time.Minute, Location: time.UTC}
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	t.Run("should include the state before the period", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHistory{ps: []dbpkg.Point{
+			{Time: from.Add(-10 * time.Minute), Value: int64(1)},
+			{Time: from.Add(10 * time.Minute), Value: int64(0)},
+		}}
+
+		days, err := EstimateCost(context.Background(), h, e, from, to)
+
+		a.NoError(err)
+		a.Equal(from.Add(-20*time.Minute), h.from)
+		a.Len(days, 1)
+		a.Equal(10*time.Minute, days[0].BoilerOn)
+		a.InDelta(2.0, days[0].KWh, 1e-9)
+	})
+
+	t.Run("should return an error when the query fails", func(t *testing.T) {
+		_, err := EstimateCost(context.Background(), &fakeHistory{err: errors.New("something went wrong")}, e, from, to)
+
+		assert.EqualError(t, err, "error reading boiler state: something went wrong")
+	})
+}
+
+func TestCostCollect(t *testing.T) {
+	a := assert.New(t)
+	c := &Cost{
+		interval:  time.Hour,
+		estimator: &cost.Estimator{BoilerOutput: 12, MaxGap: 20 * time.Minute, Location: time.UTC},
+		history:   &fakeHistory{},
+	}
+
+	wrs, err := c.Collect(context.Background())
+
+	a.NoError(err)
+	a.Len(wrs, 2)
+	a.Equal("heating_cost", wrs[0].Measurement)
+	a.Equal(wrs[0].Timestamp.AddDate(0, 0, 1), wrs[1].Timestamp)
+	a.Equal(0.0, wrs[1].Fields["kwh"])
+}
@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	energypkg "github.com/simondrake/home-stats/pkg/energy"
+)
+
+// EnergyName is the name of the gas and electricity consumption collector
+const EnergyName = "energy"
+
+const (
+	energySourceHTTP = "http"
+	energySourceCSV  = "csv"
+)
+
+func init() {
+	Register(EnergyName, func(conf *config.Config, deps Deps) (Collector, error) {
+		return NewEnergy(conf.Energy)
+	})
+}
+
+// meterClient is the subset of the smart meter bridge client used by the energy collector
+type meterClient interface {
+	GetMeterReadingsWithContext(ctx context.Context) ([]energypkg.MeterReading, error)
+}
+
+// Energy collects gas and electricity consumption, either from a smart
+// meter bridge or from supplier consumption exports
+type Energy struct {
+	interval time.Duration
+	meter    meterClient
+	files    []config.EnergyFile
+
+	mu sync.Mutex
+	// written is the start of the latest period written from each file,
+	// so that only new periods are written on subsequent runs
+	written map[string]time.Time
+	// pending is the start of the latest period returned from each file
+	// by the last Collect, which becomes written once it's committed
+	pending map[string]time.Time
+}
+
+// NewEnergy creates an Energy collector from its section of the settings file
+func NewEnergy(c config.EnergyConfig) (*Energy, error) {
+	interval, err := parseInterval(c.CollectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Energy{interval: interval, written: map[string]time.Time{}, pending: map[string]time.Time{}}
+
+	switch c.Source {
+	case energySourceHTTP:
+		timeout, err := parseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse timeout: %w", err)
+		}
+
+		if c.URL == "" {
+			return nil, errors.New("url must be set for the http source")
+		}
+
+		e.meter = energypkg.New(energypkg.Config{URL: c.URL, Timeout: timeout}, nil)
+	case energySourceCSV:
+		if len(c.Files) == 0 {
+			return nil, errors.New("at least one file must be set for the csv source")
+		}
+
+		for _, f := range c.Files {
+			if fuel := energypkg.Fuel(f.Fuel); fuel != energypkg.Gas && fuel != energypkg.Electricity {
+				return nil, fmt.Errorf("unknown fuel %q for %s", f.Fuel, f.Path)
+			}
+		}
+
+		e.files = c.Files
+	default:
+		return nil, fmt.Errorf("unknown source %q", c.Source)
+	}
+
+	return e, nil
+}
+
+// Name implements Collector
+func (e *Energy) Name() string {
+	return EnergyName
+}
+
+// Interval implements Collector
+func (e *Energy) Interval() time.Duration {
+	return e.interval
+}
+
+// Collect implements Collector. Meter readings are stored with the cumulative
+// and daily import in kWh and the current demand in kW, while consumption
+// exports are stored as the kWh used in each period, timestamped at its start
+func (e *Energy) Collect(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	if e.meter != nil {
+		return e.collectMeter(ctx)
+	}
+
+	return e.collectFiles()
+}
+
+func (e *Energy) collectMeter(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	mrs, err := e.meter.GetMeterReadingsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting meter readings: %w", err)
+	}
+
+	wrs := make([]dbpkg.WriteRequest, 0, len(mrs))
+
+	for _, mr := range mrs {
+		wrs = append(wrs, dbpkg.WriteRequest{
+			Measurement: "energy",
+			Tags: map[string]string{
+				"fuel":   string(mr.Fuel),
+				"source": energySourceHTTP,
+			},
+			Fields: map[string]interface{}{
+				"cumulative": mr.Cumulative,
+				"day":        mr.Day,
+				"power":      mr.Power,
+			},
+			Timestamp: mr.Timestamp,
+		})
+	}
+
+	return wrs, nil
+}
+
+// Commit implements Committer, so that periods are returned again until they're written
+func (e *Energy) Commit() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for path, latest := range e.pending {
+		if latest.After(e.written[path]) {
+			e.written[path] = latest
+		}
+	}
+
+	e.pending = map[string]time.Time{}
+}
+
+func (e *Energy) collectFiles() ([]dbpkg.WriteRequest, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var wrs []dbpkg.WriteRequest
+
+	e.pending = map[string]time.Time{}
+
+	for _, f := range e.files {
+		cs, err := readConsumptionFile(f)
+		if err != nil {
+			return wrs, err
+		}
+
+		latest := e.written[f.Path]
+
+		for _, c := range cs {
+			if !c.Start.After(latest) {
+				continue
+			}
+
+			wrs = append(wrs, dbpkg.WriteRequest{
+				Measurement: "energy",
+				Tags: map[string]string{
+					"fuel":   string(c.Fuel),
+					"source": energySourceCSV,
+				},
+				Fields: map[string]interface{}{
+					"consumption": c.Consumption,
+				},
+				Timestamp: c.Start,
+			})
+
+			if c.Start.After(e.pending[f.Path]) {
+				e.pending[f.Path] = c.Start
+			}
+		}
+	}
+
+	return wrs, nil
+}
+
+func readConsumptionFile(f config.EnergyFile) ([]energypkg.Consumption, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file: %w", err)
+	}
+
+	defer file.Close()
+
+	cs, err := energypkg.ReadCSV(file, energypkg.CSVOptions{
+		Fuel:              energypkg.Fuel(f.Fuel),
+		TimestampColumn:   f.TimestampColumn,
+		ConsumptionColumn: f.ConsumptionColumn,
+		TimestampFormat:   f.TimestampFormat,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", f.Path, err)
+	}
+
+	return cs, nil
+}
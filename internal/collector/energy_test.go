@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	energypkg "github.com/simondrake/home-stats/pkg/energy"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMeter struct {
+	mrs []energypkg.MeterReading
+	err error
+}
+
+func (f *fakeMeter) GetMeterReadingsWithContext(ctx context.Context) ([]energypkg.MeterReading, error) {
+	return f.mrs, f.err
+}
+
+func TestNewEnergy(t *testing.T) {
+	t.Run("should error for an unknown source", func(t *testing.T) {
+		_, err := NewEnergy(config.EnergyConfig{CollectorConfig: config.CollectorConfig{Interval: "1h"}, Source: "mqtt"})
+
+		assert.EqualError(t, err, `unknown source "mqtt"`)
+	})
+
+	t.Run("should error for an unknown fuel", func(t *testing.T) {
+		_, err := NewEnergy(config.EnergyConfig{
+			CollectorConfig: config.CollectorConfig{Interval: "1h"},
+			Source:          "csv",
+			Files:           []config.EnergyFile{{Path: "oil.csv", Fuel: "oil"}},
+		})
+
+		assert.EqualError(t, err, `unknown fuel "oil" for oil.csv`)
+	})
+}
+
+func TestEnergyCollect(t *testing.T) {
+	t.Run("should return meter readings", func(t *testing.T) {
+		a := assert.New(t)
+		ts := time.Date(2021, 1, 10, 18, 30, 0, 0, time.UTC)
+		e := &Energy{interval: time.Hour, meter: &fakeMeter{mrs: []energypkg.MeterReading{
+			{Fuel: energypkg.Gas, Timestamp: ts, Cumulative: 100, Day: 10, Power: 1.5},
+		}}}
+
+		wrs, err := e.Collect(context.Background())
+
+		a.NoError(err)
+		a.Len(wrs, 1)
+		a.Equal("energy", wrs[0].Measurement)
+		a.Equal(map[string]string{"fuel": "gas", "source": "http"}, wrs[0].Tags)
+		a.Equal(map[string]interface{}{"cumulative": 100.0, "day": 10.0, "power": 1.5}, wrs[0].Fields)
+		a.Equal(ts, wrs[0].Timestamp)
+	})
+
+	t.Run("should return an error when the meter request fails", func(t *testing.T) {
+		e := &Energy{interval: time.Hour, meter: &fakeMeter{err: errors.New("something went wrong")}}
+
+		wrs, err := e.Collect(context.Background())
+
+		assert.EqualError(t, err, "error getting meter readings: something went wrong")
+		assert.Nil(t, wrs)
+	})
+
+	t.Run("should only return new periods from consumption exports", func(t *testing.T) {
+		a := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "energy")
+		a.NoError(err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "gas.csv")
+		a.NoError(ioutil.WriteFile(path, []byte("Consumption (kWh),Start\n1.5,2021-01-09T00:00:00Z\n2.5,2021-01-09T00:30:00Z\n"), 0600))
+
+		e, err := NewEnergy(config.EnergyConfig{
+			CollectorConfig: config.CollectorConfig{Interval: "1h"},
+			Source:          "csv",
+			Files:           []config.EnergyFile{{Path: path, Fuel: "gas"}},
+		})
+		a.NoError(err)
+
+		wrs, err := e.Collect(context.Background())
+		a.NoError(err)
+		a.Len(wrs, 2)
+		a.Equal(map[string]string{"fuel": "gas", "source": "csv"}, wrs[0].Tags)
+		a.Equal(2.5, wrs[1].Fields["consumption"])
+
+		// Until they're committed, e.g. because writing them failed, the same periods are returned again
+		wrs, err = e.Collect(context.Background())
+		a.NoError(err)
+		a.Len(wrs, 2)
+
+		e.Commit()
+
+		a.NoError(ioutil.WriteFile(path, []byte("Consumption (kWh),Start\n1.5,2021-01-09T00:00:00Z\n2.5,2021-01-09T00:30:00Z\n0.5,2021-01-09T01:00:00Z\n"), 0600))
+
+		wrs, err = e.Collect(context.Background())
+		a.NoError(err)
+		a.Len(wrs, 1)
+		a.Equal(0.5, wrs[0].Fields["consumption"])
+
+		e.Commit()
+
+		wrs, err = e.Collect(context.Background())
+		a.NoError(err)
+		a.Empty(wrs)
+	})
+}
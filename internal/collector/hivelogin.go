@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/keyring"
+	"github.com/simondrake/home-stats/pkg/logger"
+	"github.com/simondrake/home-stats/pkg/totp"
+)
+
+// ErrNoMFAChallenge is returned by SubmitMFACode when logging in to Hive isn't waiting for a code
+var ErrNoMFAChallenge = errors.New("logging in to Hive isn't waiting for an MFA code")
+
+// credentialKey is the key of one of the Hive credentials for username in the keyring
+func credentialKey(username, name string) string {
+	return "hive/" + username + "/" + name
+}
+
+// LoadCredentials reads the Hive refresh token and remembered device stored
+// by SaveCredentials. Both are empty if there's no keyring or nothing has
+// been stored in it
+func LoadCredentials(c config.ThermostatConfig) (string, hivepkg.Device, error) {
+	var device hivepkg.Device
+
+	if c.Keyring.File == "" {
+		return "", device, nil
+	}
+
+	k := keyring.NewFile(c.Keyring.File, c.Keyring.Passphrase)
+
+	token, err := k.Get(credentialKey(c.Username, "refreshToken"))
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return "", device, fmt.Errorf("unable to read the Hive refresh token: %w", err)
+	}
+
+	d, err := k.Get(credentialKey(c.Username, "device"))
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return "", device, fmt.Errorf("unable to read the remembered Hive device: %w", err)
+	}
+
+	if d != "" {
+		if err := json.Unmarshal([]byte(d), &device); err != nil {
+			return "", device, fmt.Errorf("unable to unmarshal the remembered Hive device: %w", err)
+		}
+	}
+
+	return token, device, nil
+}
+
+// SaveCredentials stores a Hive refresh token and remembered device in the
+// keyring, so that the thermostat can log in to Hive without the password
+// or an MFA code
+func SaveCredentials(c config.ThermostatConfig, refreshToken string, device hivepkg.Device) error {
+	if c.Keyring.File == "" {
+		return errors.New("thermostat.keyring.file must be set")
+	}
+
+	k := keyring.NewFile(c.Keyring.File, c.Keyring.Passphrase)
+
+	if err := k.Set(credentialKey(c.Username, "refreshToken"), refreshToken); err != nil {
+		return fmt.Errorf("unable to save the Hive refresh token: %w", err)
+	}
+
+	if device.Key == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("unable to marshal the remembered Hive device: %w", err)
+	}
+
+	if err := k.Set(credentialKey(c.Username, "device"), string(b)); err != nil {
+		return fmt.Errorf("unable to save the remembered Hive device: %w", err)
+	}
+
+	return nil
+}
+
+// saveCredentials stores the credentials returned after logging in with the
+// password, if there's a keyring to store them in
+func (t *Thermostat) saveCredentials(refreshToken string, device hivepkg.Device) error {
+	if t.conf.Keyring.File == "" {
+		return nil
+	}
+
+	return SaveCredentials(t.conf, refreshToken, device)
+}
+
+// mfaCode answers an MFA challenge while logging in to Hive. Authenticator
+// app codes are generated from the TOTP secret, if there is one. Otherwise
+// the code submitted with SubmitMFACode is used and, until there is one,
+// logging in fails straight away. The caller must hold hiveMu
+func (t *Thermostat) mfaCode(ctx context.Context, challenge, destination string) (string, error) {
+	if challenge == hivepkg.ChallengeSoftwareTokenMFA && t.conf.MFA.TOTPSecret != "" {
+		return totp.Code(t.conf.MFA.TOTPSecret, time.Now())
+	}
+
+	if t.mfaSubmitted != "" {
+		t.mfaWaiting = false
+		return t.mfaSubmitted, nil
+	}
+
+	logger.FromContext(ctx, nil).Warn("Hive requires an MFA code to log in, submit it with the API", "challenge", challenge, "destination", destination)
+
+	t.mfaWaiting = true
+
+	return "", hivepkg.ErrMFACodePending
+}
+
+// SubmitMFACode logs in to Hive again, answering the MFA challenge that the
+// last login failed on with code
+func (t *Thermostat) SubmitMFACode(ctx context.Context, code string) error {
+	t.hiveMu.Lock()
+	defer t.hiveMu.Unlock()
+
+	if !t.mfaWaiting {
+		return ErrNoMFAChallenge
+	}
+
+	// The code is only good for this login
+	t.mfaSubmitted = code
+	defer func() { t.mfaSubmitted = "" }()
+
+	return t.generateToken(ctx)
+}
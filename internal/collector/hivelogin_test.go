@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func keyringConfig(t *testing.T) config.ThermostatConfig {
+	dir, err := ioutil.TempDir("", "thermostat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	c := testThermostatConfig()
+	c.Username = "user"
+	c.Keyring = config.Keyring{File: filepath.Join(dir, "hive.keyring"), Passphrase: "passphrase"}
+
+	return c
+}
+
+func TestCredentials(t *testing.T) {
+	t.Run("should load the credentials saved for the username", func(t *testing.T) {
+		a := assert.New(t)
+		c := keyringConfig(t)
+		device := hivepkg.Device{Key: "eu-west-1_key", GroupKey: "group", Password: "device-password"}
+
+		a.NoError(SaveCredentials(c, "a-refresh-token", device))
+
+		token, d, err := LoadCredentials(c)
+		a.NoError(err)
+		a.Equal("a-refresh-token", token)
+		a.Equal(device, d)
+
+		c.Username = "someone-else"
+		token, d, err = LoadCredentials(c)
+		a.NoError(err)
+		a.Empty(token)
+		a.Empty(d)
+	})
+
+	t.Run("should keep the remembered device when a refresh token is saved without one", func(t *testing.T) {
+		a := assert.New(t)
+		c := keyringConfig(t)
+		device := hivepkg.Device{Key: "eu-west-1_key", GroupKey: "group", Password: "device-password"}
+
+		a.NoError(SaveCredentials(c, "a-refresh-token", device))
+		a.NoError(SaveCredentials(c, "another-refresh-token", hivepkg.Device{}))
+
+		token, d, err := LoadCredentials(c)
+		a.NoError(err)
+		a.Equal("another-refresh-token", token)
+		a.Equal(device, d)
+	})
+
+	t.Run("should error with the wrong passphrase", func(t *testing.T) {
+		c := keyringConfig(t)
+		assert.NoError(t, SaveCredentials(c, "a-refresh-token", hivepkg.Device{}))
+
+		c.Keyring.Passphrase = "wrong"
+		_, _, err := LoadCredentials(c)
+		assert.EqualError(t, err, "unable to read the Hive refresh token: incorrect passphrase, or the file has been modified")
+	})
+
+	t.Run("should require a refresh token without a password", func(t *testing.T) {
+		c := keyringConfig(t)
+		c.Interval = "10m"
+
+		_, err := NewThermostat(c)
+		assert.EqualError(t, err, "there's no Hive refresh token for user in "+c.Keyring.File+", run home-stats hive login")
+	})
+}
+
+func TestMFACode(t *testing.T) {
+	t.Run("should generate authenticator app codes from the TOTP secret", func(t *testing.T) {
+		c := testThermostatConfig()
+		c.MFA.TOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+		th := newThermostat(c, time.Minute, &fakeHive{})
+
+		code, err := th.mfaCode(context.Background(), hivepkg.ChallengeSoftwareTokenMFA, "")
+		assert.NoError(t, err)
+
+		want, _ := totp.Code(c.MFA.TOTPSecret, time.Now())
+		assert.Equal(t, want, code)
+	})
+
+	t.Run("should fail straight away until a code is submitted", func(t *testing.T) {
+		a := assert.New(t)
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{})
+
+		a.Equal(ErrNoMFAChallenge, th.SubmitMFACode(context.Background(), "123456"))
+
+		_, err := th.mfaCode(context.Background(), hivepkg.ChallengeSMSMFA, "+********1234")
+		a.EqualError(err, "MFA code required")
+		a.True(errors.Is(err, hivepkg.ErrMFACodePending))
+	})
+
+	t.Run("should log in again with the submitted code", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{temp: 20}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+		h.mfaCode = th.mfaCode
+
+		_, err := th.Collect(context.Background())
+		a.EqualError(err, "error generating token: MFA code required")
+		a.Equal("MFA code required", th.TokenStatus().LastError)
+
+		a.NoError(th.SubmitMFACode(context.Background(), "123456"))
+		a.Equal([]string{"123456"}, h.mfaCodes)
+		a.Empty(th.TokenStatus().LastError)
+
+		// The code isn't used again once the login has succeeded
+		a.Equal(ErrNoMFAChallenge, th.SubmitMFACode(context.Background(), "654321"))
+	})
+}
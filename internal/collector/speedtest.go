@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	speedtestpkg "github.com/simondrake/home-stats/pkg/speedtest"
+)
+
+// SpeedtestName is the name of the internet speed test collector
+const SpeedtestName = "speedtest"
+
+func init() {
+	Register(SpeedtestName, func(conf *config.Config, deps Deps) (Collector, error) {
+		return NewSpeedtest(conf.Speedtest)
+	})
+}
+
+// speedtestClient is the subset of the speed test client used by the speedtest collector
+type speedtestClient interface {
+	Run(ctx context.Context) (speedtestpkg.Result, error)
+}
+
+// Speedtest collects download and upload throughput and latency
+type Speedtest struct {
+	interval  time.Duration
+	server    string
+	speedtest speedtestClient
+}
+
+// NewSpeedtest creates a Speedtest collector from its section of the settings file
+func NewSpeedtest(c config.SpeedtestConfig) (*Speedtest, error) {
+	interval, err := parseInterval(c.CollectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseDuration(c.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse timeout: %w", err)
+	}
+
+	s := speedtestpkg.New(speedtestpkg.Config{
+		DownloadURL:    c.DownloadURL,
+		UploadURL:      c.UploadURL,
+		UploadBytes:    c.UploadBytes,
+		LatencyURL:     c.LatencyURL,
+		LatencySamples: c.LatencySamples,
+		Timeout:        timeout,
+	}, nil)
+
+	u, err := url.Parse(s.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse downloadURL: %w", err)
+	}
+
+	return &Speedtest{interval: interval, server: u.Host, speedtest: s}, nil
+}
+
+// Name implements Collector
+func (s *Speedtest) Name() string {
+	return SpeedtestName
+}
+
+// Interval implements Collector
+func (s *Speedtest) Interval() time.Duration {
+	return s.interval
+}
+
+// Collect implements Collector. Download and upload are stored in
+// megabits per second and latency in milliseconds
+func (s *Speedtest) Collect(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	r, err := s.speedtest.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error running speed test: %w", err)
+	}
+
+	return []dbpkg.WriteRequest{{
+		Measurement: "network",
+		Tags: map[string]string{
+			"server": s.server,
+		},
+		Fields: map[string]interface{}{
+			"download": r.Download / 1e6,
+			"upload":   r.Upload / 1e6,
+			"latency":  float64(r.Latency) / float64(time.Millisecond),
+		},
+		Timestamp: time.Now(),
+	}}, nil
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	speedtestpkg "github.com/simondrake/home-stats/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSpeedtest struct {
+	r   speedtestpkg.Result
+	err error
+}
+
+func (f *fakeSpeedtest) Run(ctx context.Context) (speedtestpkg.Result, error) {
+	return f.r, f.err
+}
+
+func TestNewSpeedtest(t *testing.T) {
+	a := assert.New(t)
+
+	s, err := NewSpeedtest(config.SpeedtestConfig{
+		CollectorConfig: config.CollectorConfig{Interval: "1h"},
+		DownloadURL:     "http://localhost:8000/download",
+	})
+
+	a.NoError(err)
+	a.Equal(time.Hour, s.Interval())
+	a.Equal("localhost:8000", s.server)
+}
+
+func TestSpeedtestCollect(t *testing.T) {
+	t.Run("should return the network measurement", func(t *testing.T) {
+		a := assert.New(t)
+		s := &Speedtest{interval: time.Hour, server: "localhost", speedtest: &fakeSpeedtest{r: speedtestpkg.Result{
+			Download: 50e6,
+			Upload:   10e6,
+			Latency:  15 * time.Millisecond,
+		}}}
+
+		wrs, err := s.Collect(context.Background())
+
+		a.NoError(err)
+		a.Len(wrs, 1)
+		a.Equal("network", wrs[0].Measurement)
+		a.Equal("localhost", wrs[0].Tags["server"])
+		a.Equal(50.0, wrs[0].Fields["download"])
+		a.Equal(10.0, wrs[0].Fields["upload"])
+		a.Equal(15.0, wrs[0].Fields["latency"])
+	})
+
+	t.Run("should return an error when the speed test fails", func(t *testing.T) {
+		s := &Speedtest{interval: time.Hour, speedtest: &fakeSpeedtest{err: errors.New("something went wrong")}}
+
+		wrs, err := s.Collect(context.Background())
+
+		assert.EqualError(t, err, "error running speed test: something went wrong")
+		assert.Nil(t, wrs)
+	})
+}
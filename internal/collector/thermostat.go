@@ -0,0 +1,388 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/internal/notifiers"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/logger"
+	"github.com/simondrake/home-stats/pkg/notify"
+)
+
+// ThermostatName is the name of the Hive thermostat collector
+const ThermostatName = "thermostat"
+
+// BoilerMeasurement and BoilerOnField are where the heating relay state is
+// stored, as 1 while the boiler is firing and 0 otherwise
+const (
+	BoilerMeasurement = "boiler"
+	BoilerOnField     = "on"
+)
+
+// tokenRefreshMargin is how long before the Hive token expires that a new one is generated
+const tokenRefreshMargin = 5 * time.Minute
+
+func init() {
+	Register(ThermostatName, func(conf *config.Config, deps Deps) (Collector, error) {
+		return NewThermostat(conf.Thermostat)
+	})
+}
+
+// hiveClient is the subset of the Hive client used by the thermostat collector
+type hiveClient interface {
+	GenerateTokenWithContext(ctx context.Context) error
+	GetNodeStatusWithContext(ctx context.Context, nodeID string) (hivepkg.NodeStatus, error)
+	BoostHeatingWithContext(ctx context.Context, nodeID string, targetDuration int32, targetTemperature int32) error
+	SetModeWithContext(ctx context.Context, nodeID string, mode hivepkg.Mode) error
+	CancelBoostWithContext(ctx context.Context, nodeID string) error
+	TokenExpiry() time.Time
+}
+
+// TokenStatus describes the outcome of the most recent Hive token generation
+type TokenStatus struct {
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Thermostat collects the temperature from a Hive thermostat and,
+// if AutoBoost is enabled, boosts the heating when it is too cold
+type Thermostat struct {
+	conf     config.ThermostatConfig
+	interval time.Duration
+
+	// hiveMu serialises access to the hive client, as it stores
+	// the generated token between calls
+	hiveMu sync.Mutex
+	hive   hiveClient
+
+	// notifiers are told whenever AutoBoost boosts the heating, or fails to
+	notifiers []notify.Notifier
+
+	// mfaWaiting is set while logging in to Hive needs an MFA code, and
+	// mfaSubmitted holds the code submitted for it. Both are guarded by hiveMu
+	mfaWaiting   bool
+	mfaSubmitted string
+
+	mu              sync.RWMutex
+	autoBoostPaused bool
+	token           TokenStatus
+}
+
+// NewThermostat creates a Thermostat collector from its section of the settings file
+func NewThermostat(c config.ThermostatConfig) (*Thermostat, error) {
+	interval, err := parseInterval(c.CollectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseDuration(c.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse timeout: %w", err)
+	}
+
+	refreshToken, device, err := LoadCredentials(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Keyring.File != "" && refreshToken == "" && c.Password == "" {
+		return nil, fmt.Errorf("there's no Hive refresh token for %s in %s, run home-stats hive login", c.Username, c.Keyring.File)
+	}
+
+	t := newThermostat(c, interval, nil)
+	t.notifiers = notifiers.New(c.AutoBoost.Notifiers)
+
+	t.hive = hivepkg.New(hivepkg.Config{
+		Username:                 c.Username,
+		Password:                 c.Password,
+		SSOPoolID:                c.HiveSSO.PoolID,
+		SSOPublicCognitoClientID: c.HiveSSO.PublicCognitoClientID,
+		RefreshToken:             refreshToken,
+		Device:                   device,
+		MFACode:                  t.mfaCode,
+		OnCredentials:            t.saveCredentials,
+		Timeout:                  timeout,
+	}, &http.Client{})
+
+	return t, nil
+}
+
+func newThermostat(c config.ThermostatConfig, interval time.Duration, h hiveClient) *Thermostat {
+	return &Thermostat{
+		conf:     c,
+		interval: interval,
+		hive:     h,
+	}
+}
+
+// Name implements Collector
+func (t *Thermostat) Name() string {
+	return ThermostatName
+}
+
+// Interval implements Collector
+func (t *Thermostat) Interval() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.interval
+}
+
+// Reconfigure implements Reconfigurable. Changes to anything other than the
+// Hive login or timeout are applied without logging in to Hive again
+func (t *Thermostat) Reconfigure(conf *config.Config) (bool, error) {
+	c := conf.Thermostat
+
+	t.hiveMu.Lock()
+	defer t.hiveMu.Unlock()
+
+	if c.Username != t.conf.Username || c.Password != t.conf.Password || c.HiveSSO != t.conf.HiveSSO || c.Keyring != t.conf.Keyring || c.MFA != t.conf.MFA || c.Timeout != t.conf.Timeout {
+		return false, nil
+	}
+
+	interval, err := parseInterval(c.CollectorConfig)
+	if err != nil {
+		return false, err
+	}
+
+	t.conf = c
+	t.notifiers = notifiers.New(c.AutoBoost.Notifiers)
+
+	t.mu.Lock()
+	t.interval = interval
+	t.mu.Unlock()
+
+	return true, nil
+}
+
+// Collect implements Collector. It returns the current thermostat temperature,
+// target, mode and heating relay state, and boosts the heating if AutoBoost is enabled, not paused and the
+// temperature is at or below the minimum
+func (t *Thermostat) Collect(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	t.hiveMu.Lock()
+	wrs, n, err := t.collect(ctx)
+	notifiers := t.notifiers
+	t.hiveMu.Unlock()
+
+	// Notifications are sent once hiveMu is released, so a slow notifier
+	// doesn't hold up other Hive requests
+	if n != nil {
+		sendNotification(ctx, notifiers, *n)
+	}
+
+	return wrs, err
+}
+
+// collect gets the thermostat readings and runs AutoBoost, returning the
+// notification to send, if any. The caller must hold hiveMu
+func (t *Thermostat) collect(ctx context.Context) ([]dbpkg.WriteRequest, *notify.Notification, error) {
+	if err := t.generateToken(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	ns, err := t.hive.GetNodeStatusWithContext(ctx, t.conf.ThermostatID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting status for thermostat (%s): %w", t.conf.ThermostatID, err)
+	}
+
+	thermostatTemp := ns.Temperature
+	now := time.Now()
+
+	wrs := []dbpkg.WriteRequest{
+		{
+			Measurement: "thermostat",
+			Tags: map[string]string{
+				"unit": "temperature",
+			},
+			Fields: map[string]interface{}{
+				"current": thermostatTemp,
+				"target":  ns.TargetTemperature,
+				"mode":    ns.Mode,
+			},
+			Timestamp: now,
+		},
+	}
+
+	// Not every node reports its relay state, and guessing would skew the cost estimate
+	if ns.HeatingKnown {
+		boilerOn := int64(0)
+		if ns.HeatingOn {
+			boilerOn = 1
+		}
+
+		wrs = append(wrs, dbpkg.WriteRequest{
+			Measurement: BoilerMeasurement,
+			Fields: map[string]interface{}{
+				BoilerOnField: boilerOn,
+			},
+			Timestamp: now,
+		})
+	}
+
+	// If AutoBoost is enabled, we check if the minimum temperature has been met.
+	// If it has we boost the heating
+	if t.conf.AutoBoost.Enabled && !t.AutoBoostPaused() && thermostatTemp <= t.conf.AutoBoost.MinTemperature {
+		logger.FromContext(ctx, nil).Info("AutoBoost is boosting the heating",
+			"temperature", thermostatTemp,
+			"minTemperature", t.conf.AutoBoost.MinTemperature,
+			"targetTemperature", t.conf.AutoBoost.TargetTemperature,
+			"targetDuration", t.conf.AutoBoost.TargetDuration,
+		)
+
+		err := t.hive.BoostHeatingWithContext(
+			ctx,
+			t.conf.ThermostatID,
+			t.conf.AutoBoost.TargetDuration,
+			t.conf.AutoBoost.TargetTemperature,
+		)
+		if err != nil {
+			// Return the reading so it is still stored
+			return wrs, &notify.Notification{
+				Title:   "AutoBoost failed to boost the heating",
+				Message: fmt.Sprintf("%s, but the boost failed: %s", t.autoBoostReason(thermostatTemp), err),
+				Urgent:  true,
+			}, fmt.Errorf("error boosting the heating: %w", err)
+		}
+
+		return wrs, &notify.Notification{
+			Title: "AutoBoost boosted the heating",
+			Message: fmt.Sprintf("%s, so the heating has been boosted to %d°C for %d minutes",
+				t.autoBoostReason(thermostatTemp), t.conf.AutoBoost.TargetTemperature, t.conf.AutoBoost.TargetDuration),
+		}, nil
+	}
+
+	return wrs, nil, nil
+}
+
+// autoBoostReason describes the AutoBoost rule that was triggered by temp
+func (t *Thermostat) autoBoostReason(temp float64) string {
+	return fmt.Sprintf("The temperature is %.1f°C, which is at or below the AutoBoost minimum of %.1f°C", temp, t.conf.AutoBoost.MinTemperature)
+}
+
+// sendNotification sends n to each of the AutoBoost notifiers. Failures are only logged,
+// as a notification shouldn't fail the collection
+func sendNotification(ctx context.Context, notifiers []notify.Notifier, n notify.Notification) {
+	for _, nt := range notifiers {
+		if err := nt.Notify(ctx, n); err != nil {
+			logger.FromContext(ctx, nil).Error("Unable to send AutoBoost notification", "title", n.Title, "err", err)
+		}
+	}
+}
+
+// Status returns the current temperature, target, mode and heating relay state of the thermostat
+func (t *Thermostat) Status(ctx context.Context) (hivepkg.NodeStatus, error) {
+	t.hiveMu.Lock()
+	defer t.hiveMu.Unlock()
+
+	if err := t.generateToken(ctx); err != nil {
+		return hivepkg.NodeStatus{}, err
+	}
+
+	ns, err := t.hive.GetNodeStatusWithContext(ctx, t.conf.ThermostatID)
+	if err != nil {
+		return hivepkg.NodeStatus{}, fmt.Errorf("error getting status for thermostat (%s): %w", t.conf.ThermostatID, err)
+	}
+
+	return ns, nil
+}
+
+// Boost boosts the heating, regardless of whether AutoBoost is enabled or paused
+func (t *Thermostat) Boost(ctx context.Context, targetDuration, targetTemperature int32) error {
+	t.hiveMu.Lock()
+	defer t.hiveMu.Unlock()
+
+	if err := t.generateToken(ctx); err != nil {
+		return err
+	}
+
+	if err := t.hive.BoostHeatingWithContext(ctx, t.conf.ThermostatID, targetDuration, targetTemperature); err != nil {
+		return fmt.Errorf("error boosting the heating: %w", err)
+	}
+
+	return nil
+}
+
+// SetMode sets the heating mode
+func (t *Thermostat) SetMode(ctx context.Context, mode hivepkg.Mode) error {
+	t.hiveMu.Lock()
+	defer t.hiveMu.Unlock()
+
+	if err := t.generateToken(ctx); err != nil {
+		return err
+	}
+
+	if err := t.hive.SetModeWithContext(ctx, t.conf.ThermostatID, mode); err != nil {
+		return fmt.Errorf("error setting the heating mode: %w", err)
+	}
+
+	return nil
+}
+
+// CancelBoost ends a boost, returning the heating to its schedule
+func (t *Thermostat) CancelBoost(ctx context.Context) error {
+	t.hiveMu.Lock()
+	defer t.hiveMu.Unlock()
+
+	if err := t.generateToken(ctx); err != nil {
+		return err
+	}
+
+	if err := t.hive.CancelBoostWithContext(ctx, t.conf.ThermostatID); err != nil {
+		return fmt.Errorf("error cancelling the boost: %w", err)
+	}
+
+	return nil
+}
+
+// SetAutoBoostPaused pauses or resumes AutoBoost
+func (t *Thermostat) SetAutoBoostPaused(paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.autoBoostPaused = paused
+}
+
+// AutoBoostPaused reports whether AutoBoost has been paused
+func (t *Thermostat) AutoBoostPaused() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.autoBoostPaused
+}
+
+// TokenStatus returns the outcome of the most recent Hive token generation
+func (t *Thermostat) TokenStatus() TokenStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.token
+}
+
+// generateToken generates a new Hive token, unless the current one is valid for
+// at least tokenRefreshMargin, and records the outcome. The caller must hold hiveMu
+func (t *Thermostat) generateToken(ctx context.Context) error {
+	if time.Until(t.hive.TokenExpiry()) > tokenRefreshMargin {
+		return nil
+	}
+
+	err := t.hive.GenerateTokenWithContext(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		t.token.LastError = err.Error()
+		return fmt.Errorf("error generating token: %w", err)
+	}
+
+	t.token = TokenStatus{ExpiresAt: t.hive.TokenExpiry()}
+	t.mfaWaiting = false
+
+	return nil
+}
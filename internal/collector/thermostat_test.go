@@ -0,0 +1,377 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeHive struct {
+	tokenErr    error
+	tokens      int
+	tokenExpiry time.Time
+	mfaCode     hivepkg.MFACodeFunc
+	mfaCodes    []string
+	temp        float64
+	on          bool
+	// relayUnknown leaves the heating relay state out of the node status
+	relayUnknown bool
+	boostErr     error
+	boosts       []int32
+	modes        []hivepkg.Mode
+	cancels      int
+}
+
+func (f *fakeHive) GenerateTokenWithContext(ctx context.Context) error {
+	f.tokens++
+	if f.tokenErr != nil {
+		return f.tokenErr
+	}
+
+	if f.mfaCode != nil {
+		code, err := f.mfaCode(ctx, hivepkg.ChallengeSMSMFA, "+********1234")
+		if err != nil {
+			return err
+		}
+
+		f.mfaCodes = append(f.mfaCodes, code)
+	}
+
+	f.tokenExpiry = time.Now().Add(time.Hour)
+
+	return nil
+}
+
+func (f *fakeHive) GetNodeStatusWithContext(ctx context.Context, nodeID string) (hivepkg.NodeStatus, error) {
+	return hivepkg.NodeStatus{Temperature: f.temp, HeatingOn: f.on, HeatingKnown: !f.relayUnknown}, nil
+}
+
+func (f *fakeHive) BoostHeatingWithContext(ctx context.Context, nodeID string, targetDuration int32, targetTemperature int32) error {
+	f.boosts = append(f.boosts, targetDuration, targetTemperature)
+	return f.boostErr
+}
+
+func (f *fakeHive) SetModeWithContext(ctx context.Context, nodeID string, mode hivepkg.Mode) error {
+	f.modes = append(f.modes, mode)
+	return nil
+}
+
+func (f *fakeHive) CancelBoostWithContext(ctx context.Context, nodeID string) error {
+	f.cancels++
+	return nil
+}
+
+func (f *fakeHive) TokenExpiry() time.Time {
+	return f.tokenExpiry
+}
+
+// tokenlessHive is a real Hive client which doesn't need a token
+type tokenlessHive struct {
+	*hivepkg.Hive
+}
+
+func (h tokenlessHive) GenerateTokenWithContext(ctx context.Context) error {
+	return nil
+}
+
+// hiveAPI answers the requests made by a Hive client
+type hiveAPI func(req *http.Request) *http.Response
+
+func (f hiveAPI) Do(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+type fakeNotifier struct {
+	notifications []notify.Notification
+	err           error
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	f.notifications = append(f.notifications, n)
+	return f.err
+}
+
+// notifierFunc adapts a function to a Notifier
+type notifierFunc func(ctx context.Context, n notify.Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, n notify.Notification) error {
+	return f(ctx, n)
+}
+
+func testThermostatConfig() config.ThermostatConfig {
+	return config.ThermostatConfig{
+		ThermostatID: "000-111",
+		AutoBoost: config.AutoBoost{
+			Enabled:           true,
+			MinTemperature:    18,
+			TargetDuration:    30,
+			TargetTemperature: 22,
+		},
+	}
+}
+
+func TestThermostatCollect(t *testing.T) {
+	t.Run("should return the current temperature and boiler state", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{temp: 20, on: true}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		wrs, err := th.Collect(context.Background())
+
+		a.NoError(err)
+		a.Len(wrs, 2)
+		a.Equal("thermostat", wrs[0].Measurement)
+		a.Equal(20.0, wrs[0].Fields["current"])
+		a.Equal("boiler", wrs[1].Measurement)
+		a.Equal(int64(1), wrs[1].Fields["on"])
+		a.Empty(h.boosts)
+	})
+
+	t.Run("should leave out the boiler state when the relay state is unknown", func(t *testing.T) {
+		a := assert.New(t)
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{temp: 20, relayUnknown: true})
+
+		wrs, err := th.Collect(context.Background())
+
+		a.NoError(err)
+		a.Len(wrs, 1)
+		a.Equal("thermostat", wrs[0].Measurement)
+		a.Equal(20.0, wrs[0].Fields["current"])
+	})
+
+	t.Run("should boost the heating when at or below the minimum temperature", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{temp: 18}
+		n := &fakeNotifier{}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+		th.notifiers = []notify.Notifier{n}
+
+		_, err := th.Collect(context.Background())
+
+		a.NoError(err)
+		a.Equal([]int32{30, 22}, h.boosts)
+		a.Equal([]notify.Notification{{
+			Title:   "AutoBoost boosted the heating",
+			Message: "The temperature is 18.0°C, which is at or below the AutoBoost minimum of 18.0°C, so the heating has been boosted to 22°C for 30 minutes",
+		}}, n.notifications)
+	})
+
+	t.Run("should not fail the collection when a notification fails", func(t *testing.T) {
+		n := &fakeNotifier{err: errors.New("something went wrong")}
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{temp: 18})
+		th.notifiers = []notify.Notifier{n}
+
+		_, err := th.Collect(context.Background())
+
+		assert.NoError(t, err)
+		assert.Len(t, n.notifications, 1)
+	})
+
+	t.Run("should send notifications without holding the Hive lock", func(t *testing.T) {
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{temp: 18})
+
+		statusErr := make(chan error, 1)
+		th.notifiers = []notify.Notifier{notifierFunc(func(ctx context.Context, n notify.Notification) error {
+			go func() {
+				_, err := th.Status(ctx)
+				statusErr <- err
+			}()
+
+			select {
+			case err := <-statusErr:
+				return err
+			case <-time.After(time.Second):
+				t.Error("the Hive lock is held while notifying")
+				return nil
+			}
+		})}
+
+		_, err := th.Collect(context.Background())
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("should not boost the heating when AutoBoost is paused", func(t *testing.T) {
+		h := &fakeHive{temp: 10}
+		n := &fakeNotifier{}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+		th.notifiers = []notify.Notifier{n}
+		th.SetAutoBoostPaused(true)
+
+		_, err := th.Collect(context.Background())
+
+		assert.NoError(t, err)
+		assert.Empty(t, h.boosts)
+		assert.Empty(t, n.notifications)
+	})
+
+	t.Run("should return the reading alongside a boost error", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{temp: 10, boostErr: errors.New("something went wrong")}
+		n := &fakeNotifier{}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+		th.notifiers = []notify.Notifier{n}
+
+		wrs, err := th.Collect(context.Background())
+
+		a.EqualError(err, "error boosting the heating: something went wrong")
+		a.Len(wrs, 2)
+		a.Equal([]notify.Notification{{
+			Title:   "AutoBoost failed to boost the heating",
+			Message: "The temperature is 10.0°C, which is at or below the AutoBoost minimum of 18.0°C, but the boost failed: something went wrong",
+			Urgent:  true,
+		}}, n.notifications)
+	})
+
+	t.Run("should send an urgent notification when Hive rejects the boost", func(t *testing.T) {
+		a := assert.New(t)
+		api := hiveAPI(func(req *http.Request) *http.Response {
+			if req.Method == http.MethodPut {
+				return &http.Response{StatusCode: http.StatusInternalServerError, Body: ioutil.NopCloser(strings.NewReader("Internal Server Error"))}
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(`{"nodes": [{"attributes": {
+				"temperature": {"reportedValue": 10},
+				"stateHeatingRelay": {"reportedValue": "OFF"}
+			}}]}`))}
+		})
+		n := &fakeNotifier{}
+		th := newThermostat(testThermostatConfig(), time.Minute, tokenlessHive{hivepkg.New(hivepkg.Config{}, api)})
+		th.notifiers = []notify.Notifier{n}
+
+		wrs, err := th.Collect(context.Background())
+
+		a.EqualError(err, "error boosting the heating: unexpected status code 500: Internal Server Error")
+		a.Len(wrs, 2)
+		a.Equal([]notify.Notification{{
+			Title:   "AutoBoost failed to boost the heating",
+			Message: "The temperature is 10.0°C, which is at or below the AutoBoost minimum of 18.0°C, but the boost failed: unexpected status code 500: Internal Server Error",
+			Urgent:  true,
+		}}, n.notifications)
+	})
+
+	t.Run("should reuse the token until it's about to expire", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{temp: 20}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		_, err := th.Collect(context.Background())
+		a.NoError(err)
+		_, err = th.Collect(context.Background())
+		a.NoError(err)
+		a.Equal(1, h.tokens)
+
+		h.tokenExpiry = time.Now().Add(time.Minute)
+
+		_, err = th.Collect(context.Background())
+		a.NoError(err)
+		a.Equal(2, h.tokens)
+	})
+
+	t.Run("should record token errors", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{tokenErr: errors.New("something went wrong")}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		wrs, err := th.Collect(context.Background())
+
+		a.EqualError(err, "error generating token: something went wrong")
+		a.Nil(wrs)
+		a.Equal("something went wrong", th.TokenStatus().LastError)
+	})
+}
+
+func TestThermostatControl(t *testing.T) {
+	t.Run("should set the mode", func(t *testing.T) {
+		h := &fakeHive{}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		assert.NoError(t, th.SetMode(context.Background(), hivepkg.ModeOff))
+		assert.Equal(t, []hivepkg.Mode{hivepkg.ModeOff}, h.modes)
+	})
+
+	t.Run("should cancel a boost", func(t *testing.T) {
+		h := &fakeHive{}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		assert.NoError(t, th.CancelBoost(context.Background()))
+		assert.Equal(t, 1, h.cancels)
+	})
+
+	t.Run("should return the status", func(t *testing.T) {
+		a := assert.New(t)
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{temp: 19.5, on: true})
+
+		ns, err := th.Status(context.Background())
+		a.NoError(err)
+		a.Equal(19.5, ns.Temperature)
+		a.True(ns.HeatingOn)
+		a.False(th.TokenStatus().ExpiresAt.IsZero())
+	})
+
+	t.Run("should not control the heating without a token", func(t *testing.T) {
+		h := &fakeHive{tokenErr: errors.New("something went wrong")}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		assert.EqualError(t, th.CancelBoost(context.Background()), "error generating token: something went wrong")
+		assert.Equal(t, 0, h.cancels)
+	})
+}
+
+func TestThermostatReconfigure(t *testing.T) {
+	t.Run("should apply AutoBoost and interval changes", func(t *testing.T) {
+		a := assert.New(t)
+		h := &fakeHive{temp: 17}
+		th := newThermostat(testThermostatConfig(), time.Minute, h)
+
+		c := testThermostatConfig()
+		c.Interval = "5m"
+		c.AutoBoost.MinTemperature = 16
+
+		ok, err := th.Reconfigure(&config.Config{Thermostat: c})
+
+		a.NoError(err)
+		a.True(ok)
+		a.Equal(5*time.Minute, th.Interval())
+
+		_, err = th.Collect(context.Background())
+
+		a.NoError(err)
+		a.Empty(h.boosts)
+	})
+
+	t.Run("should not apply changes to the Hive login", func(t *testing.T) {
+		a := assert.New(t)
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{})
+
+		c := testThermostatConfig()
+		c.Interval = "5m"
+		c.Password = "new-password"
+
+		ok, err := th.Reconfigure(&config.Config{Thermostat: c})
+
+		a.NoError(err)
+		a.False(ok)
+		a.Equal(time.Minute, th.Interval())
+	})
+
+	t.Run("should error with an invalid interval", func(t *testing.T) {
+		th := newThermostat(testThermostatConfig(), time.Minute, &fakeHive{})
+
+		c := testThermostatConfig()
+		c.Interval = "soon"
+
+		_, err := th.Reconfigure(&config.Config{Thermostat: c})
+
+		assert.EqualError(t, err, `unable to parse interval: time: invalid duration "soon"`)
+	})
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	weatherpkg "github.com/simondrake/home-stats/pkg/weather"
+)
+
+// WeatherName is the name of the OpenWeatherMap collector
+const WeatherName = "weather"
+
+func init() {
+	Register(WeatherName, func(conf *config.Config, deps Deps) (Collector, error) {
+		return NewWeather(conf.Weather)
+	})
+}
+
+// weatherClient is the subset of the OpenWeatherMap client used by the weather collector
+type weatherClient interface {
+	GetCurrentWeatherWithContext(ctx context.Context) (weatherpkg.CurrentWeather, error)
+}
+
+// Weather collects the current outdoor temperature from OpenWeatherMap
+type Weather struct {
+	interval time.Duration
+	weather  weatherClient
+}
+
+// NewWeather creates a Weather collector from its section of the settings file
+func NewWeather(c config.WeatherConfig) (*Weather, error) {
+	interval, err := parseInterval(c.CollectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseDuration(c.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse timeout: %w", err)
+	}
+
+	w := weatherpkg.New(weatherpkg.Config{
+		City:    c.City,
+		Country: c.Country,
+		APIKey:  c.APIKey,
+		Units:   c.Units,
+		Timeout: timeout,
+	}, nil)
+
+	return &Weather{interval: interval, weather: w}, nil
+}
+
+// Current returns the current weather for the configured city
+func (w *Weather) Current(ctx context.Context) (weatherpkg.CurrentWeather, error) {
+	cw, err := w.weather.GetCurrentWeatherWithContext(ctx)
+	if err != nil {
+		return weatherpkg.CurrentWeather{}, fmt.Errorf("error getting current weather: %w", err)
+	}
+
+	return cw, nil
+}
+
+// Name implements Collector
+func (w *Weather) Name() string {
+	return WeatherName
+}
+
+// Interval implements Collector
+func (w *Weather) Interval() time.Duration {
+	return w.interval
+}
+
+// Collect implements Collector
+func (w *Weather) Collect(ctx context.Context) ([]dbpkg.WriteRequest, error) {
+	currentWeather, err := w.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []dbpkg.WriteRequest{{
+		Measurement: "weather",
+		Tags: map[string]string{
+			"unit": "temperature",
+		},
+		Fields: map[string]interface{}{
+			"current": currentWeather.Main.Temperature,
+		},
+		Timestamp: time.Now(),
+	}}, nil
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	weatherpkg "github.com/simondrake/home-stats/pkg/weather"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWeather struct {
+	cw  weatherpkg.CurrentWeather
+	err error
+}
+
+func (f *fakeWeather) GetCurrentWeatherWithContext(ctx context.Context) (weatherpkg.CurrentWeather, error) {
+	return f.cw, f.err
+}
+
+func TestWeatherCollect(t *testing.T) {
+	t.Run("should return the current temperature", func(t *testing.T) {
+		a := assert.New(t)
+		w := &Weather{interval: time.Hour, weather: &fakeWeather{cw: weatherpkg.CurrentWeather{Main: weatherpkg.Main{Temperature: 12.5}}}}
+
+		wrs, err := w.Collect(context.Background())
+
+		a.NoError(err)
+		a.Len(wrs, 1)
+		a.Equal("weather", wrs[0].Measurement)
+		a.Equal(float32(12.5), wrs[0].Fields["current"])
+	})
+
+	t.Run("should return an error when the request fails", func(t *testing.T) {
+		w := &Weather{interval: time.Hour, weather: &fakeWeather{err: errors.New("something went wrong")}}
+
+		wrs, err := w.Collect(context.Background())
+
+		assert.EqualError(t, err, "error getting current weather: something went wrong")
+		assert.Nil(t, wrs)
+	})
+}
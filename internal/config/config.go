@@ -1,26 +1,52 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 )
 
 type Config struct {
+	// Version is the layout of the settings file, see CurrentVersion
+	Version    int              `json:"version,omitempty"`
 	Thermostat ThermostatConfig `json:"thermostat,omitempty"`
 	Weather    WeatherConfig    `json:"weather,omitempty"`
+	Speedtest  SpeedtestConfig  `json:"speedtest,omitempty"`
+	Energy     EnergyConfig     `json:"energy,omitempty"`
+	Cost       CostConfig       `json:"cost,omitempty"`
 	Database   DatabaseConfig   `json:"database,omitempty"`
+	API        APIConfig        `json:"api,omitempty"`
+	MQTT       MQTTConfig       `json:"mqtt,omitempty"`
+	Alerts     AlertsConfig     `json:"alerts,omitempty"`
+	Log        LogConfig        `json:"log,omitempty"`
+
+	// Warnings describe any changes made when migrating the settings file
+	Warnings []string `json:"-"`
+}
+
+// CollectorConfig holds the settings common to every collector
+type CollectorConfig struct {
+	Enabled      bool   `json:"enabled,omitempty"`
+	Interval     string `json:"interval,omitempty"`
+	Jitter       string `json:"jitter,omitempty"`
+	RunOnStartup bool   `json:"runOnStartup,omitempty"`
+	Timeout      string `json:"timeout,omitempty"`
 }
 
 type ThermostatConfig struct {
-	Enabled      bool      `json:"enabled,omitempty"`
-	Interval     string    `json:"interval,omitempty"`
+	CollectorConfig
 	Username     string    `json:"username,omitempty"`
 	Password     string    `json:"password,omitempty"`
 	ThermostatID string    `json:"thermostatID,omitempty"`
 	AutoBoost    AutoBoost `json:"autoBoost,omitempty"`
 	HiveSSO      HiveSSO   `json:"hiveSSO,omitempty"`
+	// Keyring is where home-stats hive login stores the Hive refresh token,
+	// which is used instead of the password
+	Keyring Keyring `json:"keyring,omitempty"`
+	// MFA is used to answer MFA challenges when logging in with the password
+	MFA MFAConfig `json:"mfa,omitempty"`
 }
 
 type AutoBoost struct {
@@ -28,6 +54,8 @@ type AutoBoost struct {
 	MinTemperature    float64 `json:"minTemperature,omitempty"`
 	TargetDuration    int32   `json:"targetDuration,omitempty"`
 	TargetTemperature int32   `json:"targetTemperature,omitempty"`
+	// Notifiers are sent a notification whenever AutoBoost boosts the heating
+	Notifiers NotifiersConfig `json:"notifiers,omitempty"`
 }
 
 type HiveSSO struct {
@@ -35,13 +63,72 @@ type HiveSSO struct {
 	PublicCognitoClientID string `json:"publicCognitoClientID,omitempty"`
 }
 
+// Keyring is a file, encrypted with a passphrase, that holds secrets
+type Keyring struct {
+	File       string `json:"file,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// MFAConfig holds what's needed to answer Hive MFA challenges without a person.
+// SMS codes can be submitted through the API instead
+type MFAConfig struct {
+	// TOTPSecret is the base32 secret shown when adding an authenticator app,
+	// used to generate the codes for SOFTWARE_TOKEN_MFA challenges
+	TOTPSecret string `json:"totpSecret,omitempty"`
+}
+
 type WeatherConfig struct {
-	Enabled  bool   `json:"enabled,omitempty"`
-	Interval string `json:"interval,omitempty"`
-	City     string `json:"city,omitempty"`
-	Country  string `json:"country,omitempty"`
-	APIKey   string `json:"apiKey,omitempty"`
-	Units    string `json:"units,omitempty"`
+	CollectorConfig
+	City    string `json:"city,omitempty"`
+	Country string `json:"country,omitempty"`
+	APIKey  string `json:"apiKey,omitempty"`
+	Units   string `json:"units,omitempty"`
+}
+
+type SpeedtestConfig struct {
+	CollectorConfig
+	DownloadURL    string `json:"downloadURL,omitempty"`
+	UploadURL      string `json:"uploadURL,omitempty"`
+	UploadBytes    int64  `json:"uploadBytes,omitempty"`
+	LatencyURL     string `json:"latencyURL,omitempty"`
+	LatencySamples int    `json:"latencySamples,omitempty"`
+}
+
+type EnergyConfig struct {
+	CollectorConfig
+	// Source is either "http", to read a smart meter bridge at URL,
+	// or "csv", to read supplier consumption exports from Files
+	Source string       `json:"source,omitempty"`
+	URL    string       `json:"url,omitempty"`
+	Files  []EnergyFile `json:"files,omitempty"`
+}
+
+type EnergyFile struct {
+	Path              string `json:"path,omitempty"`
+	Fuel              string `json:"fuel,omitempty"`
+	TimestampColumn   string `json:"timestampColumn,omitempty"`
+	ConsumptionColumn string `json:"consumptionColumn,omitempty"`
+	TimestampFormat   string `json:"timestampFormat,omitempty"`
+}
+
+type CostConfig struct {
+	CollectorConfig
+	// BoilerOutput is the output of the boiler in kW
+	BoilerOutput float64      `json:"boilerOutput,omitempty"`
+	Tariff       TariffConfig `json:"tariff,omitempty"`
+}
+
+type TariffConfig struct {
+	// UnitRate is the price per kWh outside of any of Rates
+	UnitRate float64         `json:"unitRate,omitempty"`
+	Rates    []TimeOfUseRate `json:"rates,omitempty"`
+}
+
+type TimeOfUseRate struct {
+	// From and To are times of day in the form 15:04
+	From     string  `json:"from,omitempty"`
+	To       string  `json:"to,omitempty"`
+	UnitRate float64 `json:"unitRate,omitempty"`
 }
 
 type DatabaseConfig struct {
@@ -51,6 +138,120 @@ type DatabaseConfig struct {
 	Database string `json:"database,omitempty"`
 }
 
+type APIConfig struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Address string `json:"address,omitempty"`
+	Token   string `json:"token,omitempty"`
+	// FailureThreshold is the number of consecutive failed runs after
+	// which a collector is reported as unhealthy
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+}
+
+type MQTTConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Broker is the URI of the broker, e.g. tcp://localhost:1883
+	Broker   string `json:"broker,omitempty"`
+	ClientID string `json:"clientID,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// TopicPrefix is prepended to the topic of every reading
+	TopicPrefix string `json:"topicPrefix,omitempty"`
+	// Topics overrides the topic, below TopicPrefix, of a measurement
+	Topics    map[string]string `json:"topics,omitempty"`
+	QoS       byte              `json:"qos,omitempty"`
+	Retain    bool              `json:"retain,omitempty"`
+	Discovery MQTTDiscovery     `json:"discovery,omitempty"`
+	// Commands subscribes to command topics that control the heating
+	Commands bool `json:"commands,omitempty"`
+}
+
+// MQTTDiscovery configures Home Assistant MQTT discovery
+type MQTTDiscovery struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Prefix is the Home Assistant discovery prefix
+	Prefix string `json:"prefix,omitempty"`
+}
+
+type AlertsConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Interval is how often the health rules are checked
+	Interval string `json:"interval,omitempty"`
+	// RepeatInterval is how often a notification is repeated while an alert is
+	// firing. If it isn't set, each alert is only notified once
+	RepeatInterval string          `json:"repeatInterval,omitempty"`
+	Rules          []AlertRule     `json:"rules,omitempty"`
+	Notifiers      NotifiersConfig `json:"notifiers,omitempty"`
+}
+
+type AlertRule struct {
+	Name string `json:"name,omitempty"`
+	// Type is one of reading, collector, token or database
+	Type string `json:"type,omitempty"`
+	// Measurement, Field, Below and Above are used by reading rules
+	Measurement string   `json:"measurement,omitempty"`
+	Field       string   `json:"field,omitempty"`
+	Below       *float64 `json:"below,omitempty"`
+	Above       *float64 `json:"above,omitempty"`
+	// For is how long a reading must breach the threshold before the alert fires
+	For string `json:"for,omitempty"`
+	// Collector limits a collector rule to a single collector
+	Collector string `json:"collector,omitempty"`
+	// Failures is the number of consecutive failures after which a
+	// collector rule fires. Defaults to api.failureThreshold
+	Failures int `json:"failures,omitempty"`
+}
+
+type NotifiersConfig struct {
+	Webhooks []WebhookConfig  `json:"webhooks,omitempty"`
+	Email    []EmailConfig    `json:"email,omitempty"`
+	Ntfy     []NtfyConfig     `json:"ntfy,omitempty"`
+	Gotify   []GotifyConfig   `json:"gotify,omitempty"`
+	Telegram []TelegramConfig `json:"telegram,omitempty"`
+}
+
+type WebhookConfig struct {
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type EmailConfig struct {
+	Host     string   `json:"host,omitempty"`
+	Port     int      `json:"port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+type NtfyConfig struct {
+	URL      string `json:"url,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Priority string `json:"priority,omitempty"`
+}
+
+type GotifyConfig struct {
+	URL      string `json:"url,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+type TelegramConfig struct {
+	// URL is only needed for a self-hosted Bot API server
+	URL    string `json:"url,omitempty"`
+	Token  string `json:"token,omitempty"`
+	ChatID string `json:"chatID,omitempty"`
+}
+
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error. Defaults to info
+	Level string `json:"level,omitempty"`
+	// Format is logfmt or json. Defaults to logfmt
+	Format string `json:"format,omitempty"`
+}
+
+// New reads the settings file, in the format given by its extension,
+// migrates it to CurrentVersion if needed and then applies any environment
+// variable overrides
 func New(fileName string) (*Config, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
@@ -64,10 +265,59 @@ func New(fileName string) (*Config, error) {
 		return nil, fmt.Errorf("unable to read file: %w", err)
 	}
 
-	c := &Config{}
-	if err := json.Unmarshal(b, c); err != nil {
-		return nil, fmt.Errorf("unable to unmarshal to Config: %w", err)
+	if b, err = toJSON(FormatOf(fileName), b); err != nil {
+		return nil, err
+	}
+
+	migrated, changes, err := migrate(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+
+	if migrated != nil {
+		b = migrated
+		warnings = append([]string{fmt.Sprintf("the settings file has been read as version %d, run home-stats config migrate to upgrade it", CurrentVersion)}, changes...)
+	}
+
+	c, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Warnings = warnings
+
+	if err := c.applyEnv(os.Environ()); err != nil {
+		return nil, fmt.Errorf("unable to apply environment variables: %w", err)
 	}
 
 	return c, nil
 }
+
+// Collectors returns the common settings of each collector, keyed by the
+// collector name, which is also the name of its section in the settings file.
+// A section belongs to a collector if it embeds CollectorConfig
+func (c *Config) Collectors() map[string]CollectorConfig {
+	sections := map[string]CollectorConfig{}
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.Struct {
+			continue
+		}
+
+		cc, ok := f.Type.FieldByName("CollectorConfig")
+		if !ok || !cc.Anonymous || len(cc.Index) != 1 {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		sections[name] = v.Field(i).Field(cc.Index[0]).Interface().(CollectorConfig)
+	}
+
+	return sections
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,11 +17,32 @@ func TestNew(t *testing.T) {
 		assert.EqualError(t, err, "unable to open file: open non-existent: no such file or directory")
 	})
 
+	t.Run("should error with unknown fields", func(t *testing.T) {
+		c, err := New(writeTestConfig(t, `{"version": 2, "thermostat": {"enabled": true, "thermostatIdentifier": "000-111"}}`))
+
+		assert.Nil(t, c)
+		assert.EqualError(t, err, `unable to unmarshal to Config: json: unknown field "thermostatIdentifier"`)
+	})
+
+	t.Run("should migrate a legacy file with warnings", func(t *testing.T) {
+		a := assert.New(t)
+
+		c, err := New(writeTestConfig(t, legacyConfig))
+
+		a.NoError(err)
+		a.Equal(CurrentVersion, c.Version)
+		a.Equal("10m", c.Thermostat.Interval)
+		a.Equal("http://localhost:8086", c.Database.URI)
+		a.Len(c.Warnings, 4)
+		a.Equal("the settings file has been read as version 2, run home-stats config migrate to upgrade it", c.Warnings[0])
+	})
+
 	t.Run("should not erorr with valid file", func(t *testing.T) {
 		c, err := New("test_config.json")
 
 		assert.NoError(t, err)
 		assert.NotNil(t, c)
+		assert.Empty(t, c.Warnings)
 	})
 
 	t.Run("should set correct values", func(t *testing.T) {
@@ -32,6 +56,9 @@ func TestNew(t *testing.T) {
 		// Thermostat config values
 		a.True(c.Thermostat.Enabled)
 		a.Equal("10m", c.Thermostat.Interval)
+		a.Equal("30s", c.Thermostat.Jitter)
+		a.True(c.Thermostat.RunOnStartup)
+		a.Equal("20s", c.Thermostat.Timeout)
 		a.Equal("user", c.Thermostat.Username)
 		a.Equal("password", c.Thermostat.Password)
 		a.Equal("000-111", c.Thermostat.ThermostatID)
@@ -41,19 +68,127 @@ func TestNew(t *testing.T) {
 		a.Equal(18.0, c.Thermostat.AutoBoost.MinTemperature)
 		a.Equal(int32(30), c.Thermostat.AutoBoost.TargetDuration)
 		a.Equal(int32(24), c.Thermostat.AutoBoost.TargetTemperature)
+		a.Equal([]TelegramConfig{{URL: "http://localhost:8081", Token: "456:def", ChatID: "@home"}}, c.Thermostat.AutoBoost.Notifiers.Telegram)
 
 		// Weather config values
 		a.False(c.Weather.Enabled)
 		a.Equal("3h", c.Weather.Interval)
+		a.Equal("5s", c.Weather.Timeout)
 		a.Equal("London", c.Weather.City)
 		a.Equal("United Kingdom", c.Weather.Country)
 		a.Equal("2222", c.Weather.APIKey)
 		a.Equal("metric", c.Weather.Units)
 
+		// Speedtest config values
+		a.True(c.Speedtest.Enabled)
+		a.Equal("1h", c.Speedtest.Interval)
+		a.Equal("http://localhost:8000/download", c.Speedtest.DownloadURL)
+		a.Equal("http://localhost:8000/upload", c.Speedtest.UploadURL)
+		a.Equal(int64(1000000), c.Speedtest.UploadBytes)
+		a.Equal("http://localhost:8000/ping", c.Speedtest.LatencyURL)
+		a.Equal(3, c.Speedtest.LatencySamples)
+
+		// Energy config values
+		a.False(c.Energy.Enabled)
+		a.Equal("30m", c.Energy.Interval)
+		a.Equal("csv", c.Energy.Source)
+		a.Equal("http://localhost:8001/meters", c.Energy.URL)
+		a.Equal([]EnergyFile{{
+			Path:              "gas.csv",
+			Fuel:              "gas",
+			TimestampColumn:   "Date",
+			ConsumptionColumn: "Usage",
+			TimestampFormat:   "2006-01-02 15:04",
+		}}, c.Energy.Files)
+
+		// Cost config values
+		a.True(c.Cost.Enabled)
+		a.Equal("1h", c.Cost.Interval)
+		a.Equal(24.0, c.Cost.BoilerOutput)
+		a.Equal(0.1, c.Cost.Tariff.UnitRate)
+		a.Equal([]TimeOfUseRate{{From: "00:30", To: "04:30", UnitRate: 0.05}}, c.Cost.Tariff.Rates)
+
 		// Database config values
 		a.Equal("http://localhost:3000", c.Database.URI)
 		a.Equal("dbUser", c.Database.Username)
 		a.Equal("dbPassword", c.Database.Password)
 		a.Equal("db", c.Database.Database)
+
+		// API config values
+		a.True(c.API.Enabled)
+		a.Equal(":8080", c.API.Address)
+		a.Equal("apiToken", c.API.Token)
+
+		// MQTT config values
+		a.True(c.MQTT.Enabled)
+		a.Equal("tcp://localhost:1883", c.MQTT.Broker)
+		a.Equal("home-stats-test", c.MQTT.ClientID)
+		a.Equal("mqttUser", c.MQTT.Username)
+		a.Equal("mqttPassword", c.MQTT.Password)
+		a.Equal("house", c.MQTT.TopicPrefix)
+		a.Equal(map[string]string{"weather": "outside/weather"}, c.MQTT.Topics)
+		a.Equal(byte(1), c.MQTT.QoS)
+		a.True(c.MQTT.Retain)
+		a.True(c.MQTT.Commands)
+		a.True(c.MQTT.Discovery.Enabled)
+		a.Equal("ha", c.MQTT.Discovery.Prefix)
+
+		// Alerts config values
+		below := 16.0
+		a.True(c.Alerts.Enabled)
+		a.Equal("1m", c.Alerts.Interval)
+		a.Equal("6h", c.Alerts.RepeatInterval)
+		a.Equal([]AlertRule{
+			{Name: "indoor-cold", Type: "reading", Measurement: "thermostat", Field: "current", Below: &below, For: "30m"},
+			{Name: "collector-failing", Type: "collector", Collector: "weather", Failures: 5},
+		}, c.Alerts.Rules)
+		a.Equal([]WebhookConfig{{URL: "http://localhost:9000/hook", Headers: map[string]string{"X-Api-Key": "key"}}}, c.Alerts.Notifiers.Webhooks)
+		a.Equal([]EmailConfig{{
+			Host:     "smtp.example.com",
+			Port:     587,
+			Username: "smtpUser",
+			Password: "smtpPassword",
+			From:     "home-stats@example.com",
+			To:       []string{"me@example.com"},
+		}}, c.Alerts.Notifiers.Email)
+		a.Equal([]NtfyConfig{{URL: "https://ntfy.sh/home-stats", Token: "ntfyToken", Priority: "high"}}, c.Alerts.Notifiers.Ntfy)
+		a.Equal([]GotifyConfig{{URL: "https://gotify.example.com", Token: "gotifyToken", Priority: 5}}, c.Alerts.Notifiers.Gotify)
+		a.Equal([]TelegramConfig{{Token: "123:abc", ChatID: "-100200"}}, c.Alerts.Notifiers.Telegram)
 	})
 }
+
+func Test_Collectors(t *testing.T) {
+	t.Run("should return the section of every collector by name", func(t *testing.T) {
+		a := assert.New(t)
+
+		c, err := New("test_config.json")
+		a.NoError(err)
+
+		sections := c.Collectors()
+
+		a.Len(sections, 5)
+		a.Equal(c.Thermostat.CollectorConfig, sections["thermostat"])
+		a.Equal(c.Weather.CollectorConfig, sections["weather"])
+		a.Equal(c.Speedtest.CollectorConfig, sections["speedtest"])
+		a.Equal(c.Energy.CollectorConfig, sections["energy"])
+		a.Equal(c.Cost.CollectorConfig, sections["cost"])
+	})
+}
+
+// writeTestConfig writes s to a temporary settings file, named settings.json unless a name is given
+func writeTestConfig(t *testing.T, s string, name ...string) string {
+	dir, err := ioutil.TempDir("", "home-stats")
+	assert.NoError(t, err)
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fileName := "settings.json"
+	if len(name) > 0 {
+		fileName = name[0]
+	}
+
+	path := filepath.Join(dir, fileName)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(s), 0600))
+
+	return path
+}
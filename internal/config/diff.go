@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// secretSettings are settings whose values are never included in a Change
+var secretSettings = []string{"password", "passphrase", "token", "apikey", "totpsecret"}
+
+// Change is a setting that differs between two Configs
+type Change struct {
+	// Path is the path to the setting in the settings file, e.g. thermostat.autoBoost.minTemperature
+	Path string
+	Old  interface{}
+	New  interface{}
+	// Secret is set for passwords, tokens and keys, whose values shouldn't be logged
+	Secret bool
+}
+
+func (c Change) String() string {
+	if c.Secret {
+		return c.Path + " has changed"
+	}
+
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+}
+
+// Section returns the top-level section of the setting, e.g. thermostat
+func (c Change) Section() string {
+	return strings.SplitN(c.Path, ".", 2)[0]
+}
+
+// Diff returns every setting that differs between old and new. Lists are
+// compared as a whole, and so are reported as a single Change
+func Diff(old, new *Config) []Change {
+	var changes []Change
+
+	diffStruct(&changes, "", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem())
+
+	return changes
+}
+
+func diffStruct(changes *[]Change, prefix string, old, new reflect.Value) {
+	t := old.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// Embedded structs, such as CollectorConfig, share the prefix of their parent
+		if f.Anonymous {
+			diffStruct(changes, prefix, old.Field(i), new.Field(i))
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		o, n := old.Field(i), new.Field(i)
+
+		if o.Kind() == reflect.Struct {
+			diffStruct(changes, path, o, n)
+			continue
+		}
+
+		if reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+
+		*changes = append(*changes, Change{
+			Path:   path,
+			Old:    o.Interface(),
+			New:    n.Interface(),
+			Secret: isSecret(name),
+		})
+	}
+}
+
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, s := range secretSettings {
+		if name == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatValue(v interface{}) string {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", v)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "unset"
+		}
+
+		return formatValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Map:
+		return fmt.Sprintf("%d item(s)", rv.Len())
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("should return no changes for equal settings", func(t *testing.T) {
+		a, err := New("test_config.json")
+		assert.NoError(t, err)
+
+		b, err := New("test_config.json")
+		assert.NoError(t, err)
+
+		assert.Empty(t, Diff(a, b))
+	})
+
+	t.Run("should return every changed setting", func(t *testing.T) {
+		a := assert.New(t)
+
+		old, err := New("test_config.json")
+		a.NoError(err)
+
+		new, err := New("test_config.json")
+		a.NoError(err)
+
+		new.Thermostat.Interval = "5m"
+		new.Thermostat.Password = "new-password"
+		new.Thermostat.AutoBoost.MinTemperature = 17.5
+		new.Weather.Enabled = true
+		new.Alerts.Rules = nil
+
+		changes := Diff(old, new)
+
+		a.Equal([]string{
+			`thermostat.interval: "10m" -> "5m"`,
+			"thermostat.password has changed",
+			"thermostat.autoBoost.minTemperature: 18 -> 17.5",
+			"weather.enabled: false -> true",
+			"alerts.rules: 2 item(s) -> 0 item(s)",
+		}, changeStrings(changes))
+		a.Equal("thermostat", changes[0].Section())
+		a.Equal("alerts", changes[4].Section())
+	})
+}
+
+func changeStrings(changes []Change) []string {
+	s := make([]string, len(changes))
+	for i, c := range changes {
+		s[i] = c.String()
+	}
+
+	return s
+}
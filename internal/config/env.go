@@ -0,0 +1,230 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// EnvPrefix is the prefix of every environment variable that overrides the settings file
+	EnvPrefix = "HOMESTATS"
+
+	// fileSuffix marks an environment variable holding the path to a file containing the value
+	fileSuffix = "_FILE"
+)
+
+// applyEnv overrides the fields of c with any matching variables in environ,
+// which is in the KEY=value form returned by os.Environ.
+//
+// The name of a variable is EnvPrefix followed by the path to the field in
+// the settings file, in upper snake case, e.g. HOMESTATS_THERMOSTAT_PASSWORD
+// or HOMESTATS_THERMOSTAT_AUTO_BOOST_MIN_TEMPERATURE. Elements of a list are
+// addressed by their index, e.g. HOMESTATS_ALERTS_RULES_0_BELOW. Lists of
+// strings are comma separated and maps are JSON objects.
+//
+// Appending _FILE to a name reads the value from that file instead, with any
+// trailing newline removed. A variable takes precedence over its _FILE variant,
+// and both take precedence over the settings file
+func (c *Config) applyEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 && strings.HasPrefix(kv, EnvPrefix+"_") {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	if len(env) == 0 {
+		return nil
+	}
+
+	return applyEnvStruct(env, EnvPrefix, reflect.ValueOf(c).Elem())
+}
+
+func applyEnvStruct(env map[string]string, prefix string, v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// Embedded structs, such as CollectorConfig, share the prefix of their parent
+		if f.Anonymous {
+			if err := applyEnvStruct(env, prefix, v.Field(i)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		if err := applyEnvValue(env, prefix+"_"+envName(name), v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyEnvValue(env map[string]string, name string, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.Struct:
+		return applyEnvStruct(env, name, v)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		return applyEnvSlice(env, name, v)
+	}
+
+	s, ok, err := lookupEnv(env, name)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := setValue(v, s); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// applyEnvSlice overrides the elements of a list of sections, growing it
+// when there are variables for an index past its end
+func applyEnvSlice(env map[string]string, name string, v reflect.Value) error {
+	for i := 0; i < v.Len() || hasEnvPrefix(env, fmt.Sprintf("%s_%d_", name, i)); i++ {
+		if i >= v.Len() {
+			v.Set(reflect.Append(v, reflect.New(v.Type().Elem()).Elem()))
+		}
+
+		if err := applyEnvStruct(env, fmt.Sprintf("%s_%d", name, i), v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookupEnv returns the value of the named variable, or the contents of the file named by its _FILE variant
+func lookupEnv(env map[string]string, name string) (string, bool, error) {
+	if s, ok := env[name]; ok {
+		return s, true, nil
+	}
+
+	path, ok := env[name+fileSuffix]
+	if !ok {
+		return "", false, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read %s%s: %w", name, fileSuffix, err)
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+func hasEnvPrefix(env map[string]string, prefix string) bool {
+	for k := range env {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setValue parses s into v according to the kind of v
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+
+		v.Set(p)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+
+		var ss []string
+		for _, e := range strings.Split(s, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				ss = append(ss, e)
+			}
+		}
+
+		v.Set(reflect.ValueOf(ss))
+	case reflect.Map:
+		m := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(s), m.Interface()); err != nil {
+			return err
+		}
+
+		v.Set(m.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// envName converts a camel case settings name to upper snake case,
+// keeping acronyms together, e.g. hiveSSO to HIVE_SSO and poolID to POOL_ID
+func envName(s string) string {
+	r := []rune(s)
+
+	var b strings.Builder
+
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prevLower := unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1])
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+
+			if prevLower || (unicode.IsUpper(r[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+
+		b.WriteRune(unicode.ToUpper(c))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvName(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("PASSWORD", envName("password"))
+	a.Equal("AUTO_BOOST", envName("autoBoost"))
+	a.Equal("THERMOSTAT_ID", envName("thermostatID"))
+	a.Equal("HIVE_SSO", envName("hiveSSO"))
+	a.Equal("PUBLIC_COGNITO_CLIENT_ID", envName("publicCognitoClientID"))
+	a.Equal("QOS", envName("qos"))
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Run("should override fields from the environment", func(t *testing.T) {
+		a := assert.New(t)
+
+		c, err := New("test_config.json")
+		a.NoError(err)
+
+		a.NoError(c.applyEnv([]string{
+			"HOMESTATS_THERMOSTAT_PASSWORD=env-password",
+			"HOMESTATS_THERMOSTAT_ENABLED=false",
+			"HOMESTATS_THERMOSTAT_AUTO_BOOST_MIN_TEMPERATURE=16.5",
+			"HOMESTATS_THERMOSTAT_AUTO_BOOST_TARGET_DURATION=45",
+			"HOMESTATS_THERMOSTAT_HIVE_SSO_POOL_ID=pool",
+			"HOMESTATS_WEATHER_API_KEY=key=with=equals",
+			"HOMESTATS_MQTT_QOS=2",
+			"HOMESTATS_MQTT_TOPICS={\"weather\": \"outside\"}",
+			"HOMESTATS_ALERTS_RULES_0_ABOVE=30",
+			"HOMESTATS_ALERTS_NOTIFIERS_EMAIL_0_TO=a@example.com, b@example.com",
+			"HOMESTATS_ALERTS_NOTIFIERS_TELEGRAM_1_TOKEN=789:ghi",
+			"PATH=/usr/bin",
+		}))
+
+		a.Equal("env-password", c.Thermostat.Password)
+		a.False(c.Thermostat.Enabled)
+		a.Equal("user", c.Thermostat.Username)
+		a.Equal(16.5, c.Thermostat.AutoBoost.MinTemperature)
+		a.Equal(int32(45), c.Thermostat.AutoBoost.TargetDuration)
+		a.Equal("pool", c.Thermostat.HiveSSO.PoolID)
+		a.Equal("key=with=equals", c.Weather.APIKey)
+		a.Equal(byte(2), c.MQTT.QoS)
+		a.Equal(map[string]string{"weather": "outside"}, c.MQTT.Topics)
+		a.Equal(30.0, *c.Alerts.Rules[0].Above)
+		a.Equal([]string{"a@example.com", "b@example.com"}, c.Alerts.Notifiers.Email[0].To)
+		a.Len(c.Alerts.Notifiers.Telegram, 2)
+		a.Equal("123:abc", c.Alerts.Notifiers.Telegram[0].Token)
+		a.Equal("789:ghi", c.Alerts.Notifiers.Telegram[1].Token)
+	})
+
+	t.Run("should read secrets from files", func(t *testing.T) {
+		a := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "home-stats")
+		a.NoError(err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "password")
+		a.NoError(ioutil.WriteFile(path, []byte("file-password\n"), 0600))
+
+		c := &Config{}
+		a.NoError(c.applyEnv([]string{
+			"HOMESTATS_THERMOSTAT_PASSWORD_FILE=" + path,
+			"HOMESTATS_DATABASE_PASSWORD_FILE=" + path,
+			"HOMESTATS_DATABASE_PASSWORD=env-password",
+		}))
+
+		a.Equal("file-password", c.Thermostat.Password)
+		a.Equal("env-password", c.Database.Password)
+	})
+
+	t.Run("should error with a missing secret file", func(t *testing.T) {
+		err := (&Config{}).applyEnv([]string{"HOMESTATS_WEATHER_API_KEY_FILE=non-existent"})
+
+		assert.EqualError(t, err, "unable to read HOMESTATS_WEATHER_API_KEY_FILE: open non-existent: no such file or directory")
+	})
+
+	t.Run("should error with an invalid value", func(t *testing.T) {
+		err := (&Config{}).applyEnv([]string{"HOMESTATS_API_ENABLED=maybe"})
+
+		assert.EqualError(t, err, `unable to parse HOMESTATS_API_ENABLED: strconv.ParseBool: parsing "maybe": invalid syntax`)
+	})
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is the format of a settings file
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+// FormatOf returns the format of a settings file from its extension. Files
+// without a .yaml, .yml or .toml extension are JSON
+func FormatOf(fileName string) Format {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		return YAML
+	case ".toml":
+		return TOML
+	default:
+		return JSON
+	}
+}
+
+// toJSON converts a settings file in format f to JSON, so that every format
+// shares the JSON schema, migrations and validation
+func toJSON(f Format, b []byte) ([]byte, error) {
+	var v interface{}
+
+	switch f {
+	case JSON:
+		return b, nil
+	case YAML:
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("unable to parse YAML: %w", err)
+		}
+	case TOML:
+		m := map[string]interface{}{}
+		if _, err := toml.Decode(string(b), &m); err != nil {
+			return nil, fmt.Errorf("unable to parse TOML: %w", err)
+		}
+
+		v = m
+	default:
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+
+	// An empty YAML document is an empty settings file
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+
+	v, err := stringKeys(v)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert %s to JSON: %w", f, err)
+	}
+
+	return b, nil
+}
+
+// fromJSON converts a JSON settings file to format f
+func fromJSON(f Format, b []byte) ([]byte, error) {
+	if f == JSON {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal to Config: %w", err)
+	}
+
+	v = jsonNumbers(v)
+
+	switch f {
+	case YAML:
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal YAML: %w", err)
+		}
+
+		return out, nil
+	case TOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, fmt.Errorf("unable to marshal TOML: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+}
+
+// stringKeys converts the map[interface{}]interface{} decoded by YAML to
+// map[string]interface{}, which can be marshalled to JSON
+func stringKeys(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k, e := range t {
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("setting names must be strings, got %v", k)
+			}
+
+			var err error
+			if m[s], err = stringKeys(e); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	case map[string]interface{}:
+		for k, e := range t {
+			var err error
+			if t[k], err = stringKeys(e); err != nil {
+				return nil, err
+			}
+		}
+
+		return t, nil
+	case []interface{}:
+		for i, e := range t {
+			var err error
+			if t[i], err = stringKeys(e); err != nil {
+				return nil, err
+			}
+		}
+
+		return t, nil
+	case []map[string]interface{}:
+		// TOML arrays of tables
+		s := make([]interface{}, len(t))
+		for i, e := range t {
+			s[i] = e
+		}
+
+		return stringKeys(s)
+	default:
+		return v, nil
+	}
+}
+
+// jsonNumbers converts the json.Numbers in v to int64 or float64, so they
+// are marshalled as numbers rather than strings
+func jsonNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = jsonNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonNumbers(e)
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+
+		f, _ := t.Float64()
+
+		return f
+	}
+
+	return v
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatOf(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(JSON, FormatOf("settings.json"))
+	a.Equal(JSON, FormatOf("settings"))
+	a.Equal(YAML, FormatOf("settings.yaml"))
+	a.Equal(YAML, FormatOf("/etc/home-stats/settings.YML"))
+	a.Equal(TOML, FormatOf("settings.toml"))
+}
+
+func TestFormats(t *testing.T) {
+	want, err := New("test_config.json")
+	assert.NoError(t, err)
+
+	for _, fileName := range []string{"test_config.yaml", "test_config.toml"} {
+		fileName := fileName
+
+		t.Run("should read "+fileName+" the same as JSON", func(t *testing.T) {
+			c, err := New(fileName)
+
+			assert.NoError(t, err)
+			assert.Equal(t, want, c)
+		})
+	}
+
+	t.Run("should reject unknown fields in YAML", func(t *testing.T) {
+		_, err := New(writeTestConfig(t, "version: 2\nweather:\n  intervall: 1h\n", "settings.yaml"))
+
+		assert.EqualError(t, err, `unable to unmarshal to Config: json: unknown field "intervall"`)
+	})
+
+	t.Run("should migrate a legacy TOML file", func(t *testing.T) {
+		a := assert.New(t)
+
+		c, err := New(writeTestConfig(t, "interval = \"10m\"\n\n[weather]\nenabled = true\n\n[influxDBConfig]\nuri = \"http://localhost:8086\"\n", "settings.toml"))
+
+		a.NoError(err)
+		a.Equal("10m", c.Weather.Interval)
+		a.Equal("http://localhost:8086", c.Database.URI)
+	})
+
+	t.Run("should read an empty YAML file", func(t *testing.T) {
+		c, err := New(writeTestConfig(t, "", "settings.yaml"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, &Config{Version: CurrentVersion, Warnings: c.Warnings}, c)
+	})
+
+	t.Run("should error with invalid YAML", func(t *testing.T) {
+		_, err := New(writeTestConfig(t, "weather: [", "settings.yaml"))
+
+		assert.Contains(t, err.Error(), "unable to parse YAML: ")
+	})
+
+	t.Run("should error with invalid TOML", func(t *testing.T) {
+		_, err := New(writeTestConfig(t, "[weather", "settings.toml"))
+
+		assert.Contains(t, err.Error(), "unable to parse TOML: ")
+	})
+}
+
+func TestMigrateFormats(t *testing.T) {
+	t.Run("should migrate YAML to YAML", func(t *testing.T) {
+		b, changes, err := Migrate(YAML, []byte("# comment\ninterval: 10m\nweather:\n  enabled: true\n  units: metric\n"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"interval has been moved to weather.interval"}, changes)
+		assert.Equal(t, "version: 2\nweather:\n  enabled: true\n  interval: 10m\n  units: metric\n", string(b))
+	})
+
+	t.Run("should migrate TOML to TOML", func(t *testing.T) {
+		b, _, err := Migrate(TOML, []byte("[influxDBConfig]\nuri = \"http://localhost:8086\"\n"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "version = 2\n\n[database]\n  uri = \"http://localhost:8086\"\n", string(b))
+	})
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CurrentVersion is the version of the settings file layout read by Config
+const CurrentVersion = 2
+
+// legacyVersion is assumed for a settings file without a version
+const legacyVersion = 1
+
+// migrations upgrade a settings file from version i+1 to i+2, returning a description of each change made
+var migrations = []func(m map[string]interface{}) ([]string, error){
+	migrateV1,
+}
+
+// Migrate upgrades a settings file in format f to CurrentVersion, returning
+// the upgraded file, in the same format, and a description of each change.
+// The upgraded file is nil if the settings file is already at CurrentVersion
+func Migrate(f Format, b []byte) ([]byte, []string, error) {
+	b, err := toJSON(f, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrated, changes, err := migrate(b)
+	if err != nil || migrated == nil {
+		return nil, nil, err
+	}
+
+	if _, err := decode(migrated); err != nil {
+		return nil, nil, err
+	}
+
+	if migrated, err = fromJSON(f, migrated); err != nil {
+		return nil, nil, err
+	}
+
+	return migrated, changes, nil
+}
+
+func migrate(b []byte) ([]byte, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	m := map[string]interface{}{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("unable to unmarshal to Config: %w", err)
+	}
+
+	version, err := fileVersion(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if version == CurrentVersion {
+		return nil, nil, nil
+	}
+
+	var changes []string
+
+	for v := version; v < CurrentVersion; v++ {
+		cs, err := migrations[v-1](m)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to migrate from version %d: %w", v, err)
+		}
+
+		changes = append(changes, cs...)
+	}
+
+	m["version"] = CurrentVersion
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(m); err != nil {
+		return nil, nil, fmt.Errorf("unable to marshal migrated settings: %w", err)
+	}
+
+	return buf.Bytes(), changes, nil
+}
+
+func fileVersion(m map[string]interface{}) (int, error) {
+	raw, ok := m["version"]
+	if !ok {
+		return legacyVersion, nil
+	}
+
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("version must be a number, got %v", raw)
+	}
+
+	v, err := n.Int64()
+	if err != nil || v < legacyVersion {
+		return 0, fmt.Errorf("invalid version %s", n)
+	}
+
+	if v > CurrentVersion {
+		return 0, fmt.Errorf("the settings file is version %d, but only versions up to %d are supported", v, CurrentVersion)
+	}
+
+	return int(v), nil
+}
+
+// migrateV1 moves the top-level interval into the thermostat and weather
+// sections and renames influxDBConfig to database
+func migrateV1(m map[string]interface{}) ([]string, error) {
+	var changes []string
+
+	if interval, ok := m["interval"]; ok {
+		var moved []string
+
+		for _, name := range []string{"thermostat", "weather"} {
+			section, ok := m[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if _, ok := section["interval"]; !ok {
+				section["interval"] = interval
+				moved = append(moved, name+".interval")
+			}
+		}
+
+		delete(m, "interval")
+
+		if len(moved) > 0 {
+			changes = append(changes, fmt.Sprintf("interval has been moved to %s", strings.Join(moved, " and ")))
+		} else {
+			changes = append(changes, "interval has been removed, as every section sets its own")
+		}
+	}
+
+	if db, ok := m["influxDBConfig"]; ok {
+		if _, ok := m["database"]; ok {
+			return nil, errors.New("both influxDBConfig and database are set, remove influxDBConfig")
+		}
+
+		m["database"] = db
+		delete(m, "influxDBConfig")
+
+		changes = append(changes, "influxDBConfig has been renamed to database")
+	}
+
+	if t, ok := m["thermostat"].(map[string]interface{}); ok {
+		if _, ok := t["hiveSSO"]; !ok {
+			changes = append(changes, "thermostat.hiveSSO is missing and must be added, with the poolID and publicCognitoClientID used by the Hive login page")
+		}
+	}
+
+	return changes, nil
+}
+
+// decode strictly unmarshals a settings file at CurrentVersion, rejecting unknown fields
+func decode(b []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	c := &Config{}
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal to Config: %w", err)
+	}
+
+	return c, nil
+}
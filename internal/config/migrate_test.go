@@ -0,0 +1,98 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const legacyConfig = `{
+  "interval": "10m",
+  "thermostat": {
+    "enabled": true,
+    "username": "user",
+    "autoBoost": {"minTemperature": 16.5}
+  },
+  "weather": {
+    "enabled": true,
+    "interval": "3h",
+    "city": "london"
+  },
+  "influxDBConfig": {
+    "uri": "http://localhost:8086",
+    "database": "home"
+  }
+}`
+
+func TestMigrate(t *testing.T) {
+	t.Run("should migrate a legacy settings file", func(t *testing.T) {
+		a := assert.New(t)
+
+		b, changes, err := Migrate(JSON, []byte(legacyConfig))
+
+		a.NoError(err)
+		a.Equal([]string{
+			"interval has been moved to thermostat.interval",
+			"influxDBConfig has been renamed to database",
+			"thermostat.hiveSSO is missing and must be added, with the poolID and publicCognitoClientID used by the Hive login page",
+		}, changes)
+		a.JSONEq(`{
+			"version": 2,
+			"thermostat": {
+				"enabled": true,
+				"interval": "10m",
+				"username": "user",
+				"autoBoost": {"minTemperature": 16.5}
+			},
+			"weather": {
+				"enabled": true,
+				"interval": "3h",
+				"city": "london"
+			},
+			"database": {
+				"uri": "http://localhost:8086",
+				"database": "home"
+			}
+		}`, string(b))
+	})
+
+	t.Run("should return nil for a settings file at the current version", func(t *testing.T) {
+		b, changes, err := Migrate(JSON, []byte(`{"version": 2, "weather": {"interval": "1h"}}`))
+
+		assert.NoError(t, err)
+		assert.Nil(t, b)
+		assert.Nil(t, changes)
+	})
+
+	t.Run("should add the version to an unversioned settings file", func(t *testing.T) {
+		b, changes, err := Migrate(JSON, []byte(`{"weather": {"interval": "1h"}}`))
+
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.JSONEq(t, `{"version": 2, "weather": {"interval": "1h"}}`, string(b))
+	})
+
+	t.Run("should error when influxDBConfig and database are both set", func(t *testing.T) {
+		_, _, err := Migrate(JSON, []byte(`{"influxDBConfig": {}, "database": {}}`))
+
+		assert.EqualError(t, err, "unable to migrate from version 1: both influxDBConfig and database are set, remove influxDBConfig")
+	})
+
+	t.Run("should error with a newer version", func(t *testing.T) {
+		_, _, err := Migrate(JSON, []byte(`{"version": 3}`))
+
+		assert.EqualError(t, err, "the settings file is version 3, but only versions up to 2 are supported")
+	})
+
+	t.Run("should error with an invalid version", func(t *testing.T) {
+		_, _, err := Migrate(JSON, []byte(`{"version": "two"}`))
+
+		assert.EqualError(t, err, "version must be a number, got two")
+	})
+
+	t.Run("should error with unknown fields", func(t *testing.T) {
+		_, _, err := Migrate(JSON, []byte(`{"weather": {"intervall": "1h"}}`))
+
+		assert.EqualError(t, err, `unable to unmarshal to Config: json: unknown field "intervall"`)
+	})
+}
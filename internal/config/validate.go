@@ -0,0 +1,412 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/totp"
+)
+
+const (
+	// minHiveTemperature and maxHiveTemperature are the limits of a Hive target temperature
+	minHiveTemperature = 5
+	maxHiveTemperature = 32
+
+	maxBoostDuration = 24 * 60
+)
+
+var (
+	// poolIDPattern matches a Cognito user pool ID, e.g. eu-west-1_AbCdEf123
+	poolIDPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+_[0-9A-Za-z]+$`)
+
+	weatherUnits  = []string{"standard", "metric", "imperial"}
+	energySources = []string{"http", "csv"}
+	energyFuels   = []string{"electricity", "gas"}
+	alertTypes    = []string{"reading", "collector", "token", "database"}
+	ntfyPriority  = []string{"min", "low", "default", "high", "urgent"}
+	logLevels     = []string{"debug", "info", "warn", "error"}
+	logFormats    = []string{"logfmt", "json"}
+)
+
+// ValidationError lists every problem found by Validate
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid settings: " + strings.Join(e.Problems, "; ")
+}
+
+// validator collects problems, each prefixed with the path to the setting in the settings file
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf(field, "must be set")
+	}
+}
+
+// duration checks an optional duration, which must be positive when set
+func (v *validator) duration(field, value string) {
+	if value == "" {
+		return
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		v.addf(field, "%q is not a duration, e.g. 30s, 10m or 1h", value)
+		return
+	}
+
+	if d <= 0 {
+		v.addf(field, "must be greater than zero")
+	}
+}
+
+// url checks an optional URL, which must be absolute when set
+func (v *validator) url(field, value string) {
+	if value == "" {
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		v.addf(field, "%q is not a URL, e.g. http://localhost:8080", value)
+	}
+}
+
+func (v *validator) timeOfDay(field, value string) {
+	if _, err := time.Parse("15:04", value); err != nil {
+		v.addf(field, "%q must be a time of day, e.g. 00:30", value)
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+
+	v.addf(field, "%q must be one of %s", value, strings.Join(allowed, ", "))
+}
+
+// Validate checks the settings needed by each enabled feature, returning
+// a *ValidationError listing every problem found
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	c.validateThermostat(v)
+	c.validateWeather(v)
+	c.validateSpeedtest(v)
+	c.validateEnergy(v)
+	c.validateCost(v)
+	c.validateDatabase(v)
+	c.validateAPI(v)
+	c.validateMQTT(v)
+	c.validateAlerts(v)
+	c.validateLog(v)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func (v *validator) collector(section string, c CollectorConfig) {
+	v.required(section+".interval", c.Interval)
+	v.duration(section+".interval", c.Interval)
+	v.duration(section+".jitter", c.Jitter)
+	v.duration(section+".timeout", c.Timeout)
+}
+
+func (c *Config) validateThermostat(v *validator) {
+	t := c.Thermostat
+	if !t.Enabled {
+		return
+	}
+
+	v.collector("thermostat", t.CollectorConfig)
+	v.required("thermostat.username", t.Username)
+
+	// The password isn't needed once home-stats hive login has stored a refresh token in the keyring
+	if t.Keyring.File == "" {
+		v.required("thermostat.password", t.Password)
+	} else {
+		v.required("thermostat.keyring.passphrase", t.Keyring.Passphrase)
+	}
+
+	if t.MFA.TOTPSecret != "" {
+		if _, err := totp.Decode(t.MFA.TOTPSecret); err != nil {
+			v.addf("thermostat.mfa.totpSecret", "must be base32 encoded, e.g. JBSWY3DPEHPK3PXP")
+		}
+	}
+
+	v.required("thermostat.thermostatID", t.ThermostatID)
+	v.required("thermostat.hiveSSO.publicCognitoClientID", t.HiveSSO.PublicCognitoClientID)
+
+	if t.HiveSSO.PoolID == "" {
+		v.addf("thermostat.hiveSSO.poolID", "must be set")
+	} else if !poolIDPattern.MatchString(t.HiveSSO.PoolID) {
+		v.addf("thermostat.hiveSSO.poolID", "%q must be in the form <region>_<pool name>, e.g. eu-west-1_AbCdEf123", t.HiveSSO.PoolID)
+	}
+
+	ab := t.AutoBoost
+	if !ab.Enabled {
+		return
+	}
+
+	if ab.MinTemperature < 0 || ab.MinTemperature >= maxHiveTemperature {
+		v.addf("thermostat.autoBoost.minTemperature", "%g must be between 0 and %d", ab.MinTemperature, maxHiveTemperature)
+	}
+
+	if ab.TargetTemperature < minHiveTemperature || ab.TargetTemperature > maxHiveTemperature {
+		v.addf("thermostat.autoBoost.targetTemperature", "%d must be between %d and %d", ab.TargetTemperature, minHiveTemperature, maxHiveTemperature)
+	} else if float64(ab.TargetTemperature) <= ab.MinTemperature {
+		v.addf("thermostat.autoBoost.targetTemperature", "%d must be above minTemperature (%g)", ab.TargetTemperature, ab.MinTemperature)
+	}
+
+	if ab.TargetDuration <= 0 || ab.TargetDuration > maxBoostDuration {
+		v.addf("thermostat.autoBoost.targetDuration", "%d must be between 1 and %d minutes", ab.TargetDuration, maxBoostDuration)
+	}
+
+	v.notifiers("thermostat.autoBoost.notifiers", ab.Notifiers)
+}
+
+func (c *Config) validateWeather(v *validator) {
+	w := c.Weather
+	if !w.Enabled {
+		return
+	}
+
+	v.collector("weather", w.CollectorConfig)
+	v.required("weather.city", w.City)
+	v.required("weather.apiKey", w.APIKey)
+
+	if w.Units != "" {
+		v.oneOf("weather.units", w.Units, weatherUnits)
+	}
+}
+
+func (c *Config) validateSpeedtest(v *validator) {
+	s := c.Speedtest
+	if !s.Enabled {
+		return
+	}
+
+	v.collector("speedtest", s.CollectorConfig)
+	v.url("speedtest.downloadURL", s.DownloadURL)
+	v.url("speedtest.uploadURL", s.UploadURL)
+	v.url("speedtest.latencyURL", s.LatencyURL)
+
+	if s.UploadBytes < 0 {
+		v.addf("speedtest.uploadBytes", "must not be negative")
+	}
+
+	if s.LatencySamples < 0 {
+		v.addf("speedtest.latencySamples", "must not be negative")
+	}
+}
+
+func (c *Config) validateEnergy(v *validator) {
+	e := c.Energy
+	if !e.Enabled {
+		return
+	}
+
+	v.collector("energy", e.CollectorConfig)
+	v.oneOf("energy.source", e.Source, energySources)
+
+	switch e.Source {
+	case "http":
+		v.required("energy.url", e.URL)
+		v.url("energy.url", e.URL)
+	case "csv":
+		if len(e.Files) == 0 {
+			v.addf("energy.files", "must list at least one file")
+		}
+
+		for i, f := range e.Files {
+			field := fmt.Sprintf("energy.files[%d]", i)
+
+			v.required(field+".path", f.Path)
+			v.oneOf(field+".fuel", f.Fuel, energyFuels)
+		}
+	}
+}
+
+func (c *Config) validateCost(v *validator) {
+	co := c.Cost
+	if !co.Enabled {
+		return
+	}
+
+	v.collector("cost", co.CollectorConfig)
+
+	if co.BoilerOutput <= 0 {
+		v.addf("cost.boilerOutput", "must be greater than zero")
+	}
+
+	if co.Tariff.UnitRate < 0 {
+		v.addf("cost.tariff.unitRate", "must not be negative")
+	}
+
+	for i, r := range co.Tariff.Rates {
+		field := fmt.Sprintf("cost.tariff.rates[%d]", i)
+
+		v.timeOfDay(field+".from", r.From)
+		v.timeOfDay(field+".to", r.To)
+
+		if r.UnitRate < 0 {
+			v.addf(field+".unitRate", "must not be negative")
+		}
+	}
+}
+
+func (c *Config) validateDatabase(v *validator) {
+	v.required("database.uri", c.Database.URI)
+	v.url("database.uri", c.Database.URI)
+	v.required("database.database", c.Database.Database)
+}
+
+func (c *Config) validateAPI(v *validator) {
+	a := c.API
+	if !a.Enabled {
+		return
+	}
+
+	v.required("api.address", a.Address)
+	v.required("api.token", a.Token)
+
+	if a.FailureThreshold < 0 {
+		v.addf("api.failureThreshold", "must not be negative")
+	}
+}
+
+func (c *Config) validateMQTT(v *validator) {
+	m := c.MQTT
+	if !m.Enabled {
+		return
+	}
+
+	v.required("mqtt.broker", m.Broker)
+	v.url("mqtt.broker", m.Broker)
+
+	if m.QoS > 2 {
+		v.addf("mqtt.qos", "%d must be 0, 1 or 2", m.QoS)
+	}
+}
+
+func (c *Config) validateAlerts(v *validator) {
+	a := c.Alerts
+	if !a.Enabled {
+		return
+	}
+
+	v.duration("alerts.interval", a.Interval)
+	v.duration("alerts.repeatInterval", a.RepeatInterval)
+
+	names := map[string]bool{}
+
+	for i, r := range a.Rules {
+		field := fmt.Sprintf("alerts.rules[%d]", i)
+
+		if r.Name == "" {
+			v.addf(field+".name", "must be set")
+		} else if names[r.Name] {
+			v.addf(field+".name", "%q is used by another rule", r.Name)
+		}
+
+		names[r.Name] = true
+
+		v.oneOf(field+".type", r.Type, alertTypes)
+		v.duration(field+".for", r.For)
+
+		switch r.Type {
+		case "reading":
+			v.required(field+".measurement", r.Measurement)
+			v.required(field+".field", r.Field)
+
+			if r.Below == nil && r.Above == nil {
+				v.addf(field, "below or above must be set")
+			}
+		case "collector":
+			if _, ok := c.Collectors()[r.Collector]; r.Collector != "" && !ok {
+				v.addf(field+".collector", "%q is not a collector", r.Collector)
+			}
+		}
+	}
+
+	v.notifiers("alerts.notifiers", a.Notifiers)
+}
+
+func (c *Config) validateLog(v *validator) {
+	if c.Log.Level != "" {
+		v.oneOf("log.level", c.Log.Level, logLevels)
+	}
+
+	if c.Log.Format != "" {
+		v.oneOf("log.format", c.Log.Format, logFormats)
+	}
+}
+
+func (v *validator) notifiers(field string, n NotifiersConfig) {
+	for i, w := range n.Webhooks {
+		f := fmt.Sprintf("%s.webhooks[%d]", field, i)
+
+		v.required(f+".url", w.URL)
+		v.url(f+".url", w.URL)
+	}
+
+	for i, e := range n.Email {
+		f := fmt.Sprintf("%s.email[%d]", field, i)
+
+		v.required(f+".host", e.Host)
+		v.required(f+".from", e.From)
+
+		if e.Port <= 0 || e.Port > 65535 {
+			v.addf(f+".port", "%d is not a port", e.Port)
+		}
+
+		if len(e.To) == 0 {
+			v.addf(f+".to", "must list at least one address")
+		}
+	}
+
+	for i, nt := range n.Ntfy {
+		f := fmt.Sprintf("%s.ntfy[%d]", field, i)
+
+		v.required(f+".url", nt.URL)
+		v.url(f+".url", nt.URL)
+
+		if nt.Priority != "" {
+			v.oneOf(f+".priority", nt.Priority, ntfyPriority)
+		}
+	}
+
+	for i, g := range n.Gotify {
+		f := fmt.Sprintf("%s.gotify[%d]", field, i)
+
+		v.required(f+".url", g.URL)
+		v.url(f+".url", g.URL)
+		v.required(f+".token", g.Token)
+	}
+
+	for i, t := range n.Telegram {
+		f := fmt.Sprintf("%s.telegram[%d]", field, i)
+
+		v.url(f+".url", t.URL)
+		v.required(f+".token", t.Token)
+		v.required(f+".chatID", t.ChatID)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run("should not error with valid settings", func(t *testing.T) {
+		c, err := New("test_config.json")
+		assert.NoError(t, err)
+
+		assert.NoError(t, c.Validate())
+	})
+
+	t.Run("should only require the database when nothing is enabled", func(t *testing.T) {
+		err := (&Config{}).Validate()
+
+		assert.EqualError(t, err, "invalid settings: database.uri: must be set; database.database: must be set")
+	})
+
+	t.Run("should require the keyring passphrase instead of the Hive password", func(t *testing.T) {
+		c := &Config{
+			Thermostat: ThermostatConfig{
+				CollectorConfig: CollectorConfig{Enabled: true, Interval: "10m"},
+				Username:        "user",
+				ThermostatID:    "000-111",
+				HiveSSO:         HiveSSO{PoolID: "eu-west-1_AbCdEf123", PublicCognitoClientID: "clientID"},
+				Keyring:         Keyring{File: "hive.keyring"},
+			},
+			Database: DatabaseConfig{URI: "http://localhost:8086", Database: "home"},
+		}
+
+		assert.EqualError(t, c.Validate(), "invalid settings: thermostat.keyring.passphrase: must be set")
+
+		c.Thermostat.Keyring.Passphrase = "passphrase"
+		assert.NoError(t, c.Validate())
+	})
+
+	t.Run("should return every problem", func(t *testing.T) {
+		a := assert.New(t)
+
+		below := 16.0
+
+		c := &Config{
+			Thermostat: ThermostatConfig{
+				CollectorConfig: CollectorConfig{Enabled: true, Interval: "10"},
+				Username:        "user",
+				Password:        "password",
+				HiveSSO:         HiveSSO{PoolID: "AbCdEf123", PublicCognitoClientID: "clientID"},
+				MFA:             MFAConfig{TOTPSecret: "not base32!"},
+				AutoBoost: AutoBoost{
+					Enabled:           true,
+					MinTemperature:    22,
+					TargetDuration:    30,
+					TargetTemperature: 20,
+				},
+			},
+			Weather: WeatherConfig{
+				CollectorConfig: CollectorConfig{Enabled: true, Interval: "1h", Jitter: "-1m"},
+				City:            "London",
+				APIKey:          "key",
+				Units:           "kelvin",
+			},
+			Energy: EnergyConfig{
+				CollectorConfig: CollectorConfig{Enabled: true, Interval: "30m"},
+				Source:          "csv",
+				Files:           []EnergyFile{{Path: "gas.csv", Fuel: "oil"}},
+			},
+			Cost: CostConfig{
+				CollectorConfig: CollectorConfig{Enabled: true, Interval: "1h"},
+				Tariff:          TariffConfig{Rates: []TimeOfUseRate{{From: "0:30", To: "25:00"}}},
+			},
+			Database: DatabaseConfig{URI: "localhost:8086", Database: "home"},
+			MQTT:     MQTTConfig{Enabled: true, Broker: "tcp://localhost:1883", QoS: 3},
+			Alerts: AlertsConfig{
+				Enabled: true,
+				Rules: []AlertRule{
+					{Name: "cold", Type: "reading", Measurement: "thermostat", Field: "current", Below: &below},
+					{Name: "cold", Type: "reading", Measurement: "thermostat"},
+					{Name: "failing", Type: "collector", Collector: "boiler"},
+				},
+				Notifiers: NotifiersConfig{Telegram: []TelegramConfig{{Token: "token"}}},
+			},
+			Log: LogConfig{Level: "verbose", Format: "json"},
+		}
+
+		err := c.Validate()
+
+		var verr *ValidationError
+		a.True(errors.As(err, &verr))
+		a.Equal([]string{
+			`thermostat.interval: "10" is not a duration, e.g. 30s, 10m or 1h`,
+			"thermostat.mfa.totpSecret: must be base32 encoded, e.g. JBSWY3DPEHPK3PXP",
+			"thermostat.thermostatID: must be set",
+			`thermostat.hiveSSO.poolID: "AbCdEf123" must be in the form <region>_<pool name>, e.g. eu-west-1_AbCdEf123`,
+			"thermostat.autoBoost.targetTemperature: 20 must be above minTemperature (22)",
+			"weather.jitter: must be greater than zero",
+			`weather.units: "kelvin" must be one of standard, metric, imperial`,
+			`energy.files[0].fuel: "oil" must be one of electricity, gas`,
+			"cost.boilerOutput: must be greater than zero",
+			`cost.tariff.rates[0].to: "25:00" must be a time of day, e.g. 00:30`,
+			`database.uri: "localhost:8086" is not a URL, e.g. http://localhost:8080`,
+			"mqtt.qos: 3 must be 0, 1 or 2",
+			`alerts.rules[1].name: "cold" is used by another rule`,
+			"alerts.rules[1].field: must be set",
+			"alerts.rules[1]: below or above must be set",
+			`alerts.rules[2].collector: "boiler" is not a collector`,
+			"alerts.notifiers.telegram[0].chatID: must be set",
+			`log.level: "verbose" must be one of debug, info, warn, error`,
+		}, verr.Problems)
+	})
+}
@@ -0,0 +1,179 @@
+// Package cost estimates the gas used by, and cost of, heating from the
+// boiler state recorded by the thermostat collector
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+)
+
+// defaultMaxGap is used when the thermostat interval can't be determined
+const defaultMaxGap = 30 * time.Minute
+
+// State is the boiler state at a point in time
+type State struct {
+	Time time.Time
+	On   bool
+}
+
+// Day is the estimated heating usage for a single day
+type Day struct {
+	// Date is midnight at the start of the day
+	Date     time.Time
+	BoilerOn time.Duration
+	// KWh is the energy used by the boiler
+	KWh  float64
+	Cost float64
+}
+
+// Estimator estimates heating usage from the recorded boiler state
+type Estimator struct {
+	// BoilerOutput is the output of the boiler in kW
+	BoilerOutput float64
+	Tariff       Tariff
+	// MaxGap is the longest a recorded state is assumed to last, so that
+	// periods where nothing was recorded aren't counted
+	MaxGap time.Duration
+	// Location is used to determine the start of each day and the time of
+	// day for time-of-use rates
+	Location *time.Location
+}
+
+// New creates an Estimator from the settings file. States are assumed to last
+// for up to twice the thermostat interval
+func New(conf *config.Config) (*Estimator, error) {
+	if conf.Cost.BoilerOutput <= 0 {
+		return nil, errors.New("boilerOutput must be greater than zero")
+	}
+
+	t, err := NewTariff(conf.Cost.Tariff)
+	if err != nil {
+		return nil, err
+	}
+
+	maxGap := defaultMaxGap
+	if i, err := time.ParseDuration(conf.Thermostat.Interval); err == nil && i > 0 {
+		maxGap = 2 * i
+	}
+
+	return &Estimator{
+		BoilerOutput: conf.Cost.BoilerOutput,
+		Tariff:       t,
+		MaxGap:       maxGap,
+		Location:     time.Local,
+	}, nil
+}
+
+// States converts the recorded boiler state, sorted oldest first, to States
+func States(ps []dbpkg.Point) ([]State, error) {
+	states := make([]State, 0, len(ps))
+
+	for _, p := range ps {
+		on, err := isOn(p.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, State{Time: p.Time, On: on})
+	}
+
+	return states, nil
+}
+
+// Estimate returns the estimate for every day between from and to, using states
+// sorted oldest first. Each state is assumed to last until the next one, or
+// MaxGap, whichever is sooner
+func (e *Estimator) Estimate(states []State, from, to time.Time) []Day {
+	loc := e.location()
+
+	var days []Day
+
+	for d := startOfDay(from.In(loc)); d.Before(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, Day{Date: d})
+	}
+
+	for i, s := range states {
+		if !s.On {
+			continue
+		}
+
+		end := s.Time.Add(e.MaxGap)
+		if i+1 < len(states) && states[i+1].Time.Before(end) {
+			end = states[i+1].Time
+		}
+
+		e.add(days, clamp(s.Time, from, to), clamp(end, from, to))
+	}
+
+	return days
+}
+
+// add spreads the time between start and end, during which the boiler was on,
+// across days, splitting it wherever the day or unit rate changes
+func (e *Estimator) add(days []Day, start, end time.Time) {
+	loc := e.location()
+
+	for t := start.In(loc); t.Before(end); {
+		next := e.Tariff.nextChange(t)
+		if next.After(end) {
+			next = end
+		}
+
+		d := next.Sub(t)
+		kwh := e.BoilerOutput * d.Hours()
+
+		for i := range days {
+			if !t.Before(days[i].Date) && t.Before(days[i].Date.AddDate(0, 0, 1)) {
+				days[i].BoilerOn += d
+				days[i].KWh += kwh
+				days[i].Cost += kwh * e.Tariff.rateAt(t)
+				break
+			}
+		}
+
+		t = next
+	}
+}
+
+func (e *Estimator) location() *time.Location {
+	if e.Location == nil {
+		return time.Local
+	}
+
+	return e.Location
+}
+
+// isOn converts a recorded boiler state to a bool
+func isOn(v interface{}) (bool, error) {
+	switch on := v.(type) {
+	case bool:
+		return on, nil
+	case int64:
+		return on != 0, nil
+	case float64:
+		return on != 0, nil
+	default:
+		return false, fmt.Errorf("unexpected boiler state %v", v)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func clamp(t, from, to time.Time) time.Time {
+	if t.Before(from) {
+		return from
+	}
+
+	if t.After(to) {
+		return to
+	}
+
+	return t
+}
@@ -0,0 +1,140 @@
+package cost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func at(day, hour, min int) time.Time {
+	return time.Date(2021, 1, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestNew(t *testing.T) {
+	t.Run("should use twice the thermostat interval as the max gap", func(t *testing.T) {
+		e, err := New(&config.Config{
+			Thermostat: config.ThermostatConfig{CollectorConfig: config.CollectorConfig{Interval: "10m"}},
+			Cost:       config.CostConfig{BoilerOutput: 24},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 20*time.Minute, e.MaxGap)
+	})
+
+	t.Run("should error without a boiler output", func(t *testing.T) {
+		_, err := New(&config.Config{})
+
+		assert.EqualError(t, err, "boilerOutput must be greater than zero")
+	})
+
+	t.Run("should error for an invalid rate", func(t *testing.T) {
+		_, err := New(&config.Config{Cost: config.CostConfig{
+			BoilerOutput: 24,
+			Tariff:       config.TariffConfig{Rates: []config.TimeOfUseRate{{From: "25:00", To: "01:00"}}},
+		}})
+
+		assert.EqualError(t, err, `unable to parse rate from: parsing time "25:00": hour out of range`)
+	})
+}
+
+func TestEstimate(t *testing.T) {
+	e := &Estimator{
+		BoilerOutput: 24,
+		Tariff:       Tariff{UnitRate: 0.1},
+		MaxGap:       20 * time.Minute,
+		Location:     time.UTC,
+	}
+
+	t.Run("should count the time the boiler was on", func(t *testing.T) {
+		a := assert.New(t)
+
+		days := e.Estimate([]State{
+			{Time: at(1, 8, 0), On: true},
+			{Time: at(1, 8, 10), On: true},
+			{Time: at(1, 8, 20), On: false},
+		}, at(1, 0, 0), at(2, 0, 0))
+
+		a.Len(days, 1)
+		a.Equal(at(1, 0, 0), days[0].Date)
+		a.Equal(20*time.Minute, days[0].BoilerOn)
+		a.InDelta(8.0, days[0].KWh, 1e-9)
+		a.InDelta(0.8, days[0].Cost, 1e-9)
+	})
+
+	t.Run("should not count more than the max gap between states", func(t *testing.T) {
+		days := e.Estimate([]State{
+			{Time: at(1, 8, 0), On: true},
+			{Time: at(1, 12, 0), On: false},
+		}, at(1, 0, 0), at(2, 0, 0))
+
+		assert.Equal(t, 20*time.Minute, days[0].BoilerOn)
+	})
+
+	t.Run("should split usage across days", func(t *testing.T) {
+		a := assert.New(t)
+
+		days := e.Estimate([]State{
+			{Time: at(1, 23, 50), On: true},
+			{Time: at(2, 0, 10), On: false},
+		}, at(1, 0, 0), at(3, 0, 0))
+
+		a.Len(days, 2)
+		a.Equal(10*time.Minute, days[0].BoilerOn)
+		a.Equal(10*time.Minute, days[1].BoilerOn)
+	})
+
+	t.Run("should only count usage within the period", func(t *testing.T) {
+		days := e.Estimate([]State{
+			{Time: at(1, 23, 50), On: true},
+			{Time: at(2, 0, 10), On: false},
+		}, at(2, 0, 0), at(3, 0, 0))
+
+		assert.Len(t, days, 1)
+		assert.Equal(t, 10*time.Minute, days[0].BoilerOn)
+	})
+
+	t.Run("should apply time-of-use rates", func(t *testing.T) {
+		a := assert.New(t)
+
+		tou := *e
+		tou.Tariff = Tariff{
+			UnitRate: 0.1,
+			Rates:    []Rate{{From: 23*time.Hour + 30*time.Minute, To: 30 * time.Minute, UnitRate: 0.05}},
+		}
+
+		days := tou.Estimate([]State{
+			{Time: at(1, 23, 20), On: true},
+			{Time: at(1, 23, 40), On: false},
+		}, at(1, 0, 0), at(2, 0, 0))
+
+		// 10 minutes at 0.1 and 10 minutes at 0.05, each using 4kWh
+		a.InDelta(8.0, days[0].KWh, 1e-9)
+		a.InDelta(0.6, days[0].Cost, 1e-9)
+	})
+}
+
+func TestStates(t *testing.T) {
+	t.Run("should convert recorded values", func(t *testing.T) {
+		states, err := States([]dbpkg.Point{
+			{Time: at(1, 0, 0), Value: int64(1)},
+			{Time: at(1, 0, 10), Value: 0.0},
+			{Time: at(1, 0, 20), Value: true},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []State{
+			{Time: at(1, 0, 0), On: true},
+			{Time: at(1, 0, 10), On: false},
+			{Time: at(1, 0, 20), On: true},
+		}, states)
+	})
+
+	t.Run("should error for an unexpected value", func(t *testing.T) {
+		_, err := States([]dbpkg.Point{{Value: "ON"}})
+
+		assert.EqualError(t, err, "unexpected boiler state ON")
+	})
+}
@@ -0,0 +1,91 @@
+package cost
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondrake/home-stats/internal/config"
+)
+
+// Tariff is the price of gas per kWh, which may vary with the time of day
+type Tariff struct {
+	// UnitRate is the price per kWh outside of any of Rates
+	UnitRate float64
+	Rates    []Rate
+}
+
+// Rate is a time-of-use unit rate. From and To are offsets from midnight,
+// and To may be before From for a rate that spans midnight
+type Rate struct {
+	From     time.Duration
+	To       time.Duration
+	UnitRate float64
+}
+
+// NewTariff parses the tariff section of the settings file
+func NewTariff(c config.TariffConfig) (Tariff, error) {
+	t := Tariff{UnitRate: c.UnitRate}
+
+	for _, r := range c.Rates {
+		from, err := parseTimeOfDay(r.From)
+		if err != nil {
+			return t, fmt.Errorf("unable to parse rate from: %w", err)
+		}
+
+		to, err := parseTimeOfDay(r.To)
+		if err != nil {
+			return t, fmt.Errorf("unable to parse rate to: %w", err)
+		}
+
+		t.Rates = append(t.Rates, Rate{From: from, To: to, UnitRate: r.UnitRate})
+	}
+
+	return t, nil
+}
+
+// rateAt returns the unit rate at t. The first matching rate wins
+func (t Tariff) rateAt(at time.Time) float64 {
+	tod := at.Sub(startOfDay(at))
+
+	for _, r := range t.Rates {
+		if r.contains(tod) {
+			return r.UnitRate
+		}
+	}
+
+	return t.UnitRate
+}
+
+// nextChange returns the next midnight or rate boundary after at
+func (t Tariff) nextChange(at time.Time) time.Time {
+	day := startOfDay(at)
+	next := day.AddDate(0, 0, 1)
+
+	for _, r := range t.Rates {
+		for _, b := range []time.Duration{r.From, r.To} {
+			if bt := day.Add(b); bt.After(at) && bt.Before(next) {
+				next = bt
+			}
+		}
+	}
+
+	return next
+}
+
+func (r Rate) contains(tod time.Duration) bool {
+	if r.From <= r.To {
+		return tod >= r.From && tod < r.To
+	}
+
+	return tod >= r.From || tod < r.To
+}
+
+// parseTimeOfDay parses a time in the form 15:04 as an offset from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
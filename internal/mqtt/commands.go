@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+const (
+	commandBoost       = "boost"
+	commandCancelBoost = "cancel_boost"
+	commandMode        = "mode"
+	commandAutoBoost   = "autoboost"
+
+	// commandTimeout is the maximum duration of a single command
+	commandTimeout = time.Minute
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+// Controller carries out the commands received over MQTT
+type Controller interface {
+	// Boost boosts the heating. A zero duration or temperature
+	// falls back to the AutoBoost targets
+	Boost(ctx context.Context, duration, temperature int32) error
+	SetMode(ctx context.Context, mode hivepkg.Mode) error
+	CancelBoost(ctx context.Context) error
+	SetAutoBoostPaused(paused bool) error
+}
+
+// boostCommand is the optional payload of the boost command
+type boostCommand struct {
+	Duration    int32 `json:"duration,omitempty"`
+	Temperature int32 `json:"temperature,omitempty"`
+}
+
+// commandResult is published to the result topic of a command once it has been carried out
+type commandResult struct {
+	Command   string `json:"command"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// subscribe subscribes to every command topic
+func (p *Publisher) subscribe(ctx context.Context) error {
+	topic := p.commandTopic("+")
+
+	return p.wait(ctx, p.client.Subscribe(topic, p.conf.QoS, func(_ paho.Client, m paho.Message) {
+		// Commands call out to Hive, so are run outside of the
+		// client's goroutine to avoid holding up other messages
+		go p.handleCommand(m.Topic(), m.Payload())
+	}))
+}
+
+// handleCommand carries out the command published to topic and publishes the result
+func (p *Publisher) handleCommand(topic string, payload []byte) {
+	name := topic[strings.LastIndex(topic, "/")+1:]
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	l := p.log.With("command", name)
+	ctx = logger.NewContext(ctx, l)
+
+	l.Info("Received MQTT command")
+
+	r := commandResult{Command: name, Success: true}
+
+	if err := p.runCommand(ctx, name, payload); err != nil {
+		l.Error("MQTT command failed", "err", err)
+
+		r.Success = false
+		r.Error = err.Error()
+	}
+
+	r.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		l.Error("Unable to marshal the MQTT command result", "err", err)
+		return
+	}
+
+	resultTopic := p.commandTopic(name) + "/result"
+
+	if err := p.wait(ctx, p.client.Publish(resultTopic, p.conf.QoS, false, b)); err != nil {
+		l.Error("Unable to publish the MQTT command result", "topic", resultTopic, "err", err)
+	}
+}
+
+func (p *Publisher) runCommand(ctx context.Context, name string, payload []byte) error {
+	payload = bytes.TrimSpace(payload)
+	value := strings.ToLower(string(payload))
+
+	switch name {
+	case commandBoost:
+		var bc boostCommand
+
+		if len(payload) > 0 {
+			if err := json.Unmarshal(payload, &bc); err != nil {
+				return fmt.Errorf("unable to decode boost command: %w", err)
+			}
+		}
+
+		return p.controller.Boost(ctx, bc.Duration, bc.Temperature)
+	case commandCancelBoost:
+		return p.controller.CancelBoost(ctx)
+	case commandMode:
+		return p.controller.SetMode(ctx, hivepkg.Mode(value))
+	case commandAutoBoost:
+		switch value {
+		case "pause":
+			return p.controller.SetAutoBoostPaused(true)
+		case "resume":
+			return p.controller.SetAutoBoostPaused(false)
+		default:
+			return fmt.Errorf("unknown autoboost action %q", value)
+		}
+	default:
+		return errUnknownCommand
+	}
+}
+
+func (p *Publisher) commandTopic(name string) string {
+	return p.conf.TopicPrefix + "/command/" + name
+}
@@ -0,0 +1,143 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	hivepkg "github.com/simondrake/home-stats/pkg/hive"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeController struct {
+	calls []string
+	err   error
+}
+
+func (f *fakeController) Boost(ctx context.Context, duration, temperature int32) error {
+	f.calls = append(f.calls, "boost")
+	return f.err
+}
+
+func (f *fakeController) SetMode(ctx context.Context, mode hivepkg.Mode) error {
+	f.calls = append(f.calls, "mode "+string(mode))
+	return f.err
+}
+
+func (f *fakeController) CancelBoost(ctx context.Context) error {
+	f.calls = append(f.calls, "cancel boost")
+	return f.err
+}
+
+func (f *fakeController) SetAutoBoostPaused(paused bool) error {
+	if paused {
+		f.calls = append(f.calls, "pause")
+	} else {
+		f.calls = append(f.calls, "resume")
+	}
+
+	return f.err
+}
+
+func newCommandPublisher(controller Controller) (*Publisher, *fakeClient) {
+	conf := testConfig()
+	conf.MQTT.Commands = true
+
+	p := newPublisher(conf, controller)
+	c := &fakeClient{}
+	p.client = c
+
+	return p, c
+}
+
+func TestCommands(t *testing.T) {
+	t.Run("should subscribe to the command topics on connect", func(t *testing.T) {
+		a := assert.New(t)
+		p, c := newCommandPublisher(&fakeController{})
+
+		p.onConnect()
+
+		a.Equal([]string{"home-stats/command/+"}, c.subscriptions)
+
+		// Status, 4 sensors and 2 buttons
+		a.Len(c.messages, 7)
+		a.Equal("homeassistant/button/home-stats_boost/config", c.messages[4].topic)
+	})
+
+	t.Run("should not subscribe when commands are disabled", func(t *testing.T) {
+		p, c := newTestPublisher(testConfig())
+		p.controller = nil
+
+		p.onConnect()
+
+		assert.Empty(t, c.subscriptions)
+	})
+
+	for _, tc := range []struct {
+		topic   string
+		payload string
+		call    string
+	}{
+		{"home-stats/command/boost", `{"duration": 30, "temperature": 22}`, "boost"},
+		{"home-stats/command/boost", ``, "boost"},
+		{"home-stats/command/cancel_boost", `PRESS`, "cancel boost"},
+		{"home-stats/command/mode", `Schedule`, "mode schedule"},
+		{"home-stats/command/autoboost", `pause`, "pause"},
+		{"home-stats/command/autoboost", `resume`, "resume"},
+	} {
+		t.Run("should handle "+tc.topic+" "+tc.payload, func(t *testing.T) {
+			a := assert.New(t)
+			ctrl := &fakeController{}
+			p, c := newCommandPublisher(ctrl)
+
+			p.handleCommand(tc.topic, []byte(tc.payload))
+
+			a.Equal([]string{tc.call}, ctrl.calls)
+			a.Len(c.messages, 1)
+			a.Equal(tc.topic+"/result", c.messages[0].topic)
+
+			var r commandResult
+			a.NoError(json.Unmarshal([]byte(c.messages[0].payload), &r))
+			a.True(r.Success)
+		})
+	}
+
+	t.Run("should publish errors", func(t *testing.T) {
+		a := assert.New(t)
+		p, c := newCommandPublisher(&fakeController{err: errors.New("something went wrong")})
+
+		p.handleCommand("home-stats/command/cancel_boost", nil)
+
+		var r commandResult
+		a.NoError(json.Unmarshal([]byte(c.messages[0].payload), &r))
+		a.False(r.Success)
+		a.Equal("cancel_boost", r.Command)
+		a.Equal("something went wrong", r.Error)
+	})
+
+	t.Run("should reject unknown commands", func(t *testing.T) {
+		a := assert.New(t)
+		ctrl := &fakeController{}
+		p, c := newCommandPublisher(ctrl)
+
+		p.handleCommand("home-stats/command/explode", nil)
+		p.handleCommand("home-stats/command/autoboost", []byte("sometimes"))
+		p.handleCommand("home-stats/command/boost", []byte("{"))
+
+		a.Empty(ctrl.calls)
+
+		errs := []string{}
+		for _, m := range c.messages {
+			var r commandResult
+			a.NoError(json.Unmarshal([]byte(m.payload), &r))
+			errs = append(errs, r.Error)
+		}
+
+		a.Equal([]string{
+			"unknown command",
+			`unknown autoboost action "sometimes"`,
+			"unable to decode boost command: unexpected end of JSON input",
+		}, errs)
+	})
+}
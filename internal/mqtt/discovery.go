@@ -0,0 +1,145 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/simondrake/home-stats/internal/config"
+)
+
+// sensor is a Home Assistant MQTT sensor config
+type sensor struct {
+	Name              string  `json:"name"`
+	UniqueID          string  `json:"unique_id"`
+	StateTopic        string  `json:"state_topic"`
+	ValueTemplate     string  `json:"value_template"`
+	UnitOfMeasurement string  `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string  `json:"device_class,omitempty"`
+	StateClass        string  `json:"state_class,omitempty"`
+	AvailabilityTopic string  `json:"availability_topic"`
+	Device            *device `json:"device"`
+}
+
+// button is a Home Assistant MQTT button config
+type button struct {
+	Name              string  `json:"name"`
+	UniqueID          string  `json:"unique_id"`
+	CommandTopic      string  `json:"command_topic"`
+	PayloadPress      string  `json:"payload_press"`
+	AvailabilityTopic string  `json:"availability_topic"`
+	Device            *device `json:"device"`
+}
+
+// discoveryConfig is a config to be published to a Home Assistant discovery topic
+type discoveryConfig struct {
+	component string
+	uniqueID  string
+	payload   interface{}
+}
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// discoveryConfigs returns the sensors of every enabled collector, and the
+// buttons for any enabled commands, that Home Assistant should know about
+func (p *Publisher) discoveryConfigs(conf *config.Config) []discoveryConfig {
+	d := &device{
+		Identifiers: []string{p.conf.ClientID},
+		Name:        "Home Stats",
+	}
+
+	newSensor := func(id, name, topic, field, unit, deviceClass string) discoveryConfig {
+		s := sensor{
+			Name:              name,
+			UniqueID:          p.conf.ClientID + "_" + id,
+			StateTopic:        topic,
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", field),
+			UnitOfMeasurement: unit,
+			DeviceClass:       deviceClass,
+			AvailabilityTopic: p.statusTopic(),
+			Device:            d,
+		}
+
+		if unit != "" {
+			s.StateClass = "measurement"
+		}
+
+		return discoveryConfig{component: "sensor", uniqueID: s.UniqueID, payload: s}
+	}
+
+	newButton := func(id, name, command string) discoveryConfig {
+		b := button{
+			Name:              name,
+			UniqueID:          p.conf.ClientID + "_" + id,
+			CommandTopic:      p.commandTopic(command),
+			AvailabilityTopic: p.statusTopic(),
+			Device:            d,
+		}
+
+		return discoveryConfig{component: "button", uniqueID: b.UniqueID, payload: b}
+	}
+
+	var configs []discoveryConfig
+
+	if conf.Thermostat.Enabled {
+		topic := p.topic("thermostat", map[string]string{"unit": "temperature"})
+
+		configs = append(configs,
+			newSensor("thermostat_temperature", "Thermostat temperature", topic, "current", "°C", "temperature"),
+			newSensor("thermostat_target", "Thermostat target temperature", topic, "target", "°C", "temperature"),
+			newSensor("thermostat_mode", "Thermostat mode", topic, "mode", "", ""),
+		)
+
+		if p.controller != nil {
+			configs = append(configs,
+				newButton("boost", "Boost heating", commandBoost),
+				newButton("cancel_boost", "Cancel heating boost", commandCancelBoost),
+			)
+		}
+	}
+
+	if conf.Weather.Enabled {
+		topic := p.topic("weather", map[string]string{"unit": "temperature"})
+
+		configs = append(configs,
+			newSensor("weather_temperature", "Outdoor temperature", topic, "current", weatherUnit(conf.Weather.Units), "temperature"),
+		)
+	}
+
+	return configs
+}
+
+// publishDiscovery publishes each config, retained
+func (p *Publisher) publishDiscovery(ctx context.Context) error {
+	for _, c := range p.discovery {
+		b, err := json.Marshal(c.payload)
+		if err != nil {
+			return fmt.Errorf("error marshalling %s config: %w", c.uniqueID, err)
+		}
+
+		topic := fmt.Sprintf("%s/%s/%s/config", p.conf.Discovery.Prefix, c.component, c.uniqueID)
+
+		if err := p.wait(ctx, p.client.Publish(topic, p.conf.QoS, true, b)); err != nil {
+			return fmt.Errorf("error publishing to %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+// weatherUnit returns the temperature unit for the OpenWeatherMap units setting
+func weatherUnit(units string) string {
+	switch units {
+	case "metric":
+		return "°C"
+	case "imperial":
+		return "°F"
+	default:
+		return "K"
+	}
+}
@@ -0,0 +1,215 @@
+// Package mqtt publishes readings to an MQTT broker and announces them
+// to Home Assistant using MQTT discovery
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+const (
+	defaultClientID        = "home-stats"
+	defaultTopicPrefix     = "home-stats"
+	defaultDiscoveryPrefix = "homeassistant"
+
+	// statusTopic, below the topic prefix, is set to online once connected
+	// and to offline by the broker if the connection is lost
+	statusTopic = "status"
+
+	connectTimeout = 10 * time.Second
+	publishTimeout = 10 * time.Second
+)
+
+// client is the subset of the paho client used by the Publisher
+type client interface {
+	Connect() paho.Token
+	Disconnect(quiesce uint)
+	Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token
+	Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token
+}
+
+// Publisher publishes readings to an MQTT broker and, if commands are
+// enabled, passes the commands it receives to a Controller
+type Publisher struct {
+	conf       config.MQTTConfig
+	discovery  []discoveryConfig
+	controller Controller
+	client     client
+	log        *logger.Logger
+}
+
+// New creates a Publisher from the settings file. controller may be nil if
+// commands aren't needed. Connect must be called before publishing
+func New(conf *config.Config, controller Controller, l *logger.Logger) *Publisher {
+	p := newPublisher(conf, controller)
+	p.log = l
+
+	opts := paho.NewClientOptions().
+		AddBroker(conf.MQTT.Broker).
+		SetClientID(conf.MQTT.ClientID).
+		SetUsername(conf.MQTT.Username).
+		SetPassword(conf.MQTT.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(p.statusTopic(), "offline", p.conf.QoS, true).
+		SetOnConnectHandler(func(paho.Client) { p.onConnect() })
+
+	p.client = paho.NewClient(opts)
+
+	return p
+}
+
+func newPublisher(conf *config.Config, controller Controller) *Publisher {
+	c := conf.MQTT
+
+	if c.ClientID == "" {
+		c.ClientID = defaultClientID
+	}
+
+	if c.TopicPrefix == "" {
+		c.TopicPrefix = defaultTopicPrefix
+	}
+
+	if c.Discovery.Prefix == "" {
+		c.Discovery.Prefix = defaultDiscoveryPrefix
+	}
+
+	p := &Publisher{conf: c}
+
+	if c.Commands {
+		p.controller = controller
+	}
+
+	p.discovery = p.discoveryConfigs(conf)
+
+	return p
+}
+
+// Connect connects to the broker. If the broker can't be reached
+// the connection is retried in the background
+func (p *Publisher) Connect() error {
+	t := p.client.Connect()
+
+	if !t.WaitTimeout(connectTimeout) {
+		p.log.Warn("Unable to connect to the MQTT broker, retrying in the background", "broker", p.conf.Broker)
+		return nil
+	}
+
+	if err := t.Error(); err != nil {
+		return fmt.Errorf("error connecting to MQTT broker: %w", err)
+	}
+
+	return nil
+}
+
+// Close marks home-stats as offline and disconnects from the broker
+func (p *Publisher) Close() {
+	_ = p.wait(context.Background(), p.client.Publish(p.statusTopic(), p.conf.QoS, true, "offline"))
+
+	p.client.Disconnect(250)
+}
+
+// Publish publishes each reading as a JSON object of its fields and timestamp
+func (p *Publisher) Publish(ctx context.Context, wrs []dbpkg.WriteRequest) error {
+	for _, wr := range wrs {
+		payload := make(map[string]interface{}, len(wr.Fields)+1)
+		for k, v := range wr.Fields {
+			payload[k] = v
+		}
+
+		payload["timestamp"] = wr.Timestamp.UTC().Format(time.RFC3339)
+
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error marshalling %s reading: %w", wr.Measurement, err)
+		}
+
+		topic := p.topic(wr.Measurement, wr.Tags)
+
+		if err := p.wait(ctx, p.client.Publish(topic, p.conf.QoS, p.conf.Retain, b)); err != nil {
+			return fmt.Errorf("error publishing to %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+// onConnect announces that home-stats is online and, if enabled, subscribes
+// to the command topics and publishes the discovery payloads. It is called on
+// every connection so they are restored after the broker restarts
+func (p *Publisher) onConnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if err := p.wait(ctx, p.client.Publish(p.statusTopic(), p.conf.QoS, true, "online")); err != nil {
+		p.log.Error("Unable to publish the MQTT status", "err", err)
+	}
+
+	if p.controller != nil {
+		if err := p.subscribe(ctx); err != nil {
+			p.log.Error("Unable to subscribe to MQTT commands", "err", err)
+		}
+	}
+
+	if !p.conf.Discovery.Enabled {
+		return
+	}
+
+	if err := p.publishDiscovery(ctx); err != nil {
+		p.log.Error("Unable to publish Home Assistant discovery", "err", err)
+	}
+}
+
+// topic returns the topic of a reading, which is the topic prefix, followed
+// by the measurement or its configured topic, followed by the tag values
+// ordered by tag name
+func (p *Publisher) topic(measurement string, tags map[string]string) string {
+	t := measurement
+	if override, ok := p.conf.Topics[measurement]; ok {
+		t = override
+	}
+
+	parts := []string{p.conf.TopicPrefix, t}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		parts = append(parts, tags[k])
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func (p *Publisher) statusTopic() string {
+	return p.conf.TopicPrefix + "/" + statusTopic
+}
+
+// wait waits for t to complete, ctx to be done or publishTimeout to elapse
+func (p *Publisher) wait(ctx context.Context, t paho.Token) error {
+	timer := time.NewTimer(publishTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("timed out after %s", publishTimeout)
+	}
+}
@@ -0,0 +1,214 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/simondrake/home-stats/internal/config"
+	dbpkg "github.com/simondrake/home-stats/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeToken struct {
+	err error
+}
+
+func (f *fakeToken) Wait() bool                     { return true }
+func (f *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (f *fakeToken) Error() error                   { return f.err }
+
+func (f *fakeToken) Done() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+type message struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+type fakeClient struct {
+	mu            sync.Mutex
+	messages      []message
+	subscriptions []string
+	publishErr    error
+}
+
+func (f *fakeClient) Connect() paho.Token {
+	return &fakeToken{}
+}
+
+func (f *fakeClient) Disconnect(quiesce uint) {}
+
+func (f *fakeClient) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subscriptions = append(f.subscriptions, topic)
+
+	return &fakeToken{}
+}
+
+func (f *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := payload.(string)
+	if !ok {
+		p = string(payload.([]byte))
+	}
+
+	f.messages = append(f.messages, message{topic: topic, retained: retained, payload: p})
+
+	return &fakeToken{err: f.publishErr}
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Thermostat: config.ThermostatConfig{CollectorConfig: config.CollectorConfig{Enabled: true}},
+		Weather:    config.WeatherConfig{CollectorConfig: config.CollectorConfig{Enabled: true}, Units: "imperial"},
+		MQTT: config.MQTTConfig{
+			Enabled:   true,
+			Topics:    map[string]string{"weather": "outside"},
+			Discovery: config.MQTTDiscovery{Enabled: true},
+		},
+	}
+}
+
+func newTestPublisher(conf *config.Config) (*Publisher, *fakeClient) {
+	p := newPublisher(conf, nil)
+	c := &fakeClient{}
+	p.client = c
+
+	return p, c
+}
+
+func TestPublish(t *testing.T) {
+	ts := time.Date(2021, 1, 10, 18, 30, 0, 0, time.UTC)
+
+	t.Run("should publish each reading to its topic", func(t *testing.T) {
+		a := assert.New(t)
+		p, c := newTestPublisher(testConfig())
+
+		err := p.Publish(context.Background(), []dbpkg.WriteRequest{
+			{Measurement: "thermostat", Tags: map[string]string{"unit": "temperature"}, Fields: map[string]interface{}{"current": 19.5}, Timestamp: ts},
+			{Measurement: "weather", Tags: map[string]string{"unit": "temperature"}, Fields: map[string]interface{}{"current": 5.5}, Timestamp: ts},
+			{Measurement: "boiler", Fields: map[string]interface{}{"on": 1}, Timestamp: ts},
+		})
+
+		a.NoError(err)
+		a.Equal([]message{
+			{topic: "home-stats/thermostat/temperature", payload: `{"current":19.5,"timestamp":"2021-01-10T18:30:00Z"}`},
+			{topic: "home-stats/outside/temperature", payload: `{"current":5.5,"timestamp":"2021-01-10T18:30:00Z"}`},
+			{topic: "home-stats/boiler", payload: `{"on":1,"timestamp":"2021-01-10T18:30:00Z"}`},
+		}, c.messages)
+	})
+
+	t.Run("should return an error when publishing fails", func(t *testing.T) {
+		p, c := newTestPublisher(testConfig())
+		c.publishErr = errors.New("not connected")
+
+		err := p.Publish(context.Background(), []dbpkg.WriteRequest{{Measurement: "boiler", Timestamp: ts}})
+
+		assert.EqualError(t, err, "error publishing to home-stats/boiler: not connected")
+	})
+}
+
+func TestOnConnect(t *testing.T) {
+	t.Run("should publish the status and discovery configs", func(t *testing.T) {
+		a := assert.New(t)
+		p, c := newTestPublisher(testConfig())
+
+		p.onConnect()
+
+		a.Len(c.messages, 5)
+		a.Equal(message{topic: "home-stats/status", retained: true, payload: "online"}, c.messages[0])
+
+		topics := []string{}
+		for _, m := range c.messages[1:] {
+			a.True(m.retained)
+			topics = append(topics, m.topic)
+		}
+
+		a.Equal([]string{
+			"homeassistant/sensor/home-stats_thermostat_temperature/config",
+			"homeassistant/sensor/home-stats_thermostat_target/config",
+			"homeassistant/sensor/home-stats_thermostat_mode/config",
+			"homeassistant/sensor/home-stats_weather_temperature/config",
+		}, topics)
+
+		var s sensor
+		a.NoError(json.Unmarshal([]byte(c.messages[4].payload), &s))
+		a.Equal("home-stats/outside/temperature", s.StateTopic)
+		a.Equal("{{ value_json.current }}", s.ValueTemplate)
+		a.Equal("°F", s.UnitOfMeasurement)
+		a.Equal("home-stats/status", s.AvailabilityTopic)
+	})
+
+	t.Run("should only publish the status when discovery is disabled", func(t *testing.T) {
+		conf := testConfig()
+		conf.MQTT.Discovery.Enabled = false
+		p, c := newTestPublisher(conf)
+
+		p.onConnect()
+
+		assert.Len(t, c.messages, 1)
+	})
+
+	t.Run("should skip sensors of disabled collectors", func(t *testing.T) {
+		conf := testConfig()
+		conf.Thermostat.Enabled = false
+		p, c := newTestPublisher(conf)
+
+		p.onConnect()
+
+		assert.Len(t, c.messages, 2)
+	})
+}
+
+// TestBroker publishes to a real broker, such as a local Mosquitto started with
+// `docker run -p 1883:1883 eclipse-mosquitto`. It only runs when
+// HOME_STATS_MQTT_BROKER is set to the broker URI, e.g. tcp://localhost:1883
+func TestBroker(t *testing.T) {
+	broker := os.Getenv("HOME_STATS_MQTT_BROKER")
+	if broker == "" {
+		t.Skip("HOME_STATS_MQTT_BROKER isn't set")
+	}
+
+	a := assert.New(t)
+
+	conf := testConfig()
+	conf.MQTT.Broker = broker
+	conf.MQTT.ClientID = "home-stats-test"
+
+	received := make(chan paho.Message, 1)
+
+	sub := paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID("home-stats-test-subscriber"))
+	a.True(sub.Connect().WaitTimeout(connectTimeout))
+	defer sub.Disconnect(250)
+
+	a.True(sub.Subscribe("home-stats/boiler", 1, func(c paho.Client, m paho.Message) {
+		received <- m
+	}).WaitTimeout(connectTimeout))
+
+	p := New(conf, nil, nil)
+	a.NoError(p.Connect())
+	defer p.Close()
+
+	a.NoError(p.Publish(context.Background(), []dbpkg.WriteRequest{{Measurement: "boiler", Fields: map[string]interface{}{"on": 1}, Timestamp: time.Now()}}))
+
+	select {
+	case m := <-received:
+		a.Contains(string(m.Payload()), `"on":1`)
+	case <-time.After(publishTimeout):
+		t.Fatal("timed out waiting for the reading")
+	}
+}
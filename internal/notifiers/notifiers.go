@@ -0,0 +1,43 @@
+// Package notifiers creates the notifiers configured in a section of the
+// settings file, which is shared by alerts and the thermostat auto boost
+package notifiers
+
+import (
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/pkg/notify"
+)
+
+// New creates a Notifier for each notifier in the settings file
+func New(c config.NotifiersConfig) []notify.Notifier {
+	var ns []notify.Notifier
+
+	for _, w := range c.Webhooks {
+		ns = append(ns, notify.NewWebhook(w.URL, w.Headers, nil))
+	}
+
+	for _, e := range c.Email {
+		ns = append(ns, notify.NewEmail(e.Host, e.Port, e.Username, e.Password, e.From, e.To))
+	}
+
+	for _, n := range c.Ntfy {
+		nt := notify.NewNtfy(n.URL, n.Token, nil)
+		nt.Priority = n.Priority
+		ns = append(ns, nt)
+	}
+
+	for _, g := range c.Gotify {
+		gt := notify.NewGotify(g.URL, g.Token, nil)
+		gt.Priority = g.Priority
+		ns = append(ns, gt)
+	}
+
+	for _, t := range c.Telegram {
+		tg := notify.NewTelegram(t.Token, t.ChatID, nil)
+		if t.URL != "" {
+			tg.URL = t.URL
+		}
+		ns = append(ns, tg)
+	}
+
+	return ns
+}
@@ -0,0 +1,35 @@
+package notifiers_test
+
+import (
+	"testing"
+
+	"github.com/simondrake/home-stats/internal/config"
+	"github.com/simondrake/home-stats/internal/notifiers"
+	"github.com/simondrake/home-stats/pkg/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("should create nothing when no notifiers are configured", func(t *testing.T) {
+		assert.Empty(t, notifiers.New(config.NotifiersConfig{}))
+	})
+
+	t.Run("should create a notifier for each one configured", func(t *testing.T) {
+		a := assert.New(t)
+
+		ns := notifiers.New(config.NotifiersConfig{
+			Webhooks: []config.WebhookConfig{{URL: "http://localhost/hook"}},
+			Ntfy:     []config.NtfyConfig{{URL: "https://ntfy.sh/home-stats", Priority: "high"}},
+			Gotify:   []config.GotifyConfig{{URL: "https://gotify.example.com", Priority: 5}},
+			Telegram: []config.TelegramConfig{{Token: "123:abc", ChatID: "@home"}, {URL: "http://localhost:8081", Token: "456:def", ChatID: "@home"}},
+		})
+
+		a.Len(ns, 5)
+
+		a.IsType(&notify.Webhook{}, ns[0])
+		a.Equal("high", ns[1].(*notify.Ntfy).Priority)
+		a.Equal(5, ns[2].(*notify.Gotify).Priority)
+		a.Equal(notify.DefaultTelegramURL, ns[3].(*notify.Telegram).URL)
+		a.Equal("http://localhost:8081", ns[4].(*notify.Telegram).URL)
+	})
+}
@@ -0,0 +1,280 @@
+package cognitosrp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// targetPrefix prefixes the operation in the X-Amz-Target header of each request
+const targetPrefix = "AWSCognitoIdentityProviderService."
+
+// DeviceRememberedStatusRemembered is the DeviceRememberedStatus which remembers a device
+const DeviceRememberedStatusRemembered = "remembered"
+
+// Endpoint returns the Cognito Identity Provider endpoint for region
+func Endpoint(region string) string {
+	return "https://cognito-idp." + region + ".amazonaws.com"
+}
+
+// Client makes the Cognito Identity Provider requests needed to log in with
+// SRP, using the JSON protocol over HTTP. None of them are signed, so no AWS
+// credentials are needed
+type Client struct {
+	endpoint   string
+	httpClient httpClient
+}
+
+// httpClient implements the Do method, which is the exact
+// API of the http.Client's DO function. This helps with testing.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// NewClient takes a Cognito Identity Provider endpoint, e.g. Endpoint("eu-west-1"),
+// and an optional httpClient and returns a pointer to a Client object
+func NewClient(endpoint string, client httpClient) *Client {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Client{
+		endpoint:   endpoint,
+		httpClient: client,
+	}
+}
+
+// InitiateAuthInput is the request body of InitiateAuth
+type InitiateAuthInput struct {
+	AuthFlow       string
+	ClientId       string
+	AuthParameters map[string]*string
+}
+
+// RespondToAuthChallengeInput is the request body of RespondToAuthChallenge
+type RespondToAuthChallengeInput struct {
+	ChallengeName      string
+	ClientId           string
+	Session            string `json:",omitempty"`
+	ChallengeResponses map[string]*string
+}
+
+// AuthOutput is the response body of InitiateAuth and RespondToAuthChallenge.
+// Either ChallengeName or AuthenticationResult is set
+type AuthOutput struct {
+	ChallengeName        string
+	ChallengeParameters  map[string]*string
+	Session              string
+	AuthenticationResult *AuthenticationResult
+}
+
+// AuthenticationResult holds the tokens returned after authenticating
+type AuthenticationResult struct {
+	AccessToken  string
+	ExpiresIn    int64
+	IdToken      string
+	RefreshToken string
+	TokenType    string
+	// NewDeviceMetadata is set when the user pool remembers devices and the
+	// user logged in without one
+	NewDeviceMetadata *NewDeviceMetadata
+}
+
+// NewDeviceMetadata identifies a device that can be remembered with ConfirmDevice
+type NewDeviceMetadata struct {
+	DeviceKey      string
+	DeviceGroupKey string
+}
+
+// ConfirmDeviceInput is the request body of ConfirmDevice
+type ConfirmDeviceInput struct {
+	AccessToken                string
+	DeviceKey                  string
+	DeviceName                 string `json:",omitempty"`
+	DeviceSecretVerifierConfig DeviceSecretVerifierConfig
+}
+
+// DeviceSecretVerifierConfig is the salt and password verifier of a DeviceVerifier
+type DeviceSecretVerifierConfig struct {
+	PasswordVerifier string
+	Salt             string
+}
+
+// ConfirmDeviceOutput is the response body of ConfirmDevice
+type ConfirmDeviceOutput struct {
+	// UserConfirmationNecessary is set when the user pool lets the user
+	// choose whether to remember the device, with UpdateDeviceStatus
+	UserConfirmationNecessary bool
+}
+
+// UpdateDeviceStatusInput is the request body of UpdateDeviceStatus
+type UpdateDeviceStatusInput struct {
+	AccessToken            string
+	DeviceKey              string
+	DeviceRememberedStatus string
+}
+
+// Error is an error response from Cognito
+type Error struct {
+	StatusCode int
+	// Type is the type of exception, e.g. NotAuthorizedException
+	Type    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s (status code: %d)", e.Type, e.StatusCode)
+	}
+
+	return fmt.Sprintf("%s: %s (status code: %d)", e.Type, e.Message, e.StatusCode)
+}
+
+// InitiateAuth starts authenticating, e.g. with the USER_SRP_AUTH or REFRESH_TOKEN_AUTH flow
+func (c *Client) InitiateAuth(ctx context.Context, in InitiateAuthInput) (*AuthOutput, error) {
+	var out AuthOutput
+
+	if err := c.call(ctx, "InitiateAuth", in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// RefreshTokenAuth generates new tokens from a refresh token with the
+// REFRESH_TOKEN_AUTH flow. deviceKey is needed if the refresh token was
+// issued to a remembered device, otherwise it can be empty
+func (c *Client) RefreshTokenAuth(ctx context.Context, clientId, refreshToken, deviceKey string) (*AuthenticationResult, error) {
+	params := map[string]*string{"REFRESH_TOKEN": &refreshToken}
+	if deviceKey != "" {
+		params["DEVICE_KEY"] = &deviceKey
+	}
+
+	out, err := c.InitiateAuth(ctx, InitiateAuthInput{
+		AuthFlow:       "REFRESH_TOKEN_AUTH",
+		ClientId:       clientId,
+		AuthParameters: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.AuthenticationResult == nil {
+		return nil, fmt.Errorf("unexpected challenge returned: %s", out.ChallengeName)
+	}
+
+	return out.AuthenticationResult, nil
+}
+
+// RespondToAuthChallenge answers a challenge returned by InitiateAuth or a previous RespondToAuthChallenge
+func (c *Client) RespondToAuthChallenge(ctx context.Context, in RespondToAuthChallengeInput) (*AuthOutput, error) {
+	var out AuthOutput
+
+	if err := c.call(ctx, "RespondToAuthChallenge", in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// ConfirmDevice starts tracking the device returned as NewDeviceMetadata
+func (c *Client) ConfirmDevice(ctx context.Context, in ConfirmDeviceInput) (*ConfirmDeviceOutput, error) {
+	var out ConfirmDeviceOutput
+
+	if err := c.call(ctx, "ConfirmDevice", in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// UpdateDeviceStatus sets whether a confirmed device is remembered
+func (c *Client) UpdateDeviceStatus(ctx context.Context, in UpdateDeviceStatusInput) error {
+	return c.call(ctx, "UpdateDeviceStatus", in, nil)
+}
+
+// call posts in to operation and decodes the response into out, unless it's nil
+func (c *Client) call(ctx context.Context, operation string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s request: %w", operation, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", targetPrefix+operation)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making %s request: %w", operation, err)
+	}
+
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s response: %w", operation, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return newError(res, body)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error decoding %s response: %w", operation, err)
+	}
+
+	return nil
+}
+
+// newError reads the exception type and message from an error response,
+// falling back to the X-Amzn-ErrorType header and then the status
+func newError(res *http.Response, body []byte) *Error {
+	var rsp struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+		// Some exceptions capitalise the message
+		MessageCapitalised string `json:"Message"`
+	}
+
+	// The body is best effort, e.g. a proxy may not return JSON
+	json.Unmarshal(body, &rsp)
+
+	e := &Error{
+		StatusCode: res.StatusCode,
+		Type:       rsp.Type,
+		Message:    rsp.Message,
+	}
+
+	if e.Message == "" {
+		e.Message = rsp.MessageCapitalised
+	}
+
+	if e.Type == "" {
+		// e.g. NotAuthorizedException:http://internal.amazon.com/coral/com.amazonaws.cognito.identity.idp/
+		e.Type = strings.SplitN(res.Header.Get("X-Amzn-ErrorType"), ":", 2)[0]
+	}
+
+	// e.g. com.amazonaws.cognito.identity.idp.model#NotAuthorizedException
+	if i := strings.LastIndex(e.Type, "#"); i >= 0 {
+		e.Type = e.Type[i+1:]
+	}
+
+	if e.Type == "" {
+		e.Type = http.StatusText(res.StatusCode)
+	}
+
+	return e
+}
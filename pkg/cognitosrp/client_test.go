@@ -0,0 +1,277 @@
+package cognitosrp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+)
+
+// cognitoServer returns a server which checks each request is for operation
+// and replies with status and body
+func cognitoServer(t *testing.T, operation string, status int, body string, got *map[string]interface{}) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("actual method: %s, did not match expected method: POST", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-amz-json-1.1" {
+			t.Errorf("actual Content-Type: %s, did not match expected Content-Type: application/x-amz-json-1.1", ct)
+		}
+		if target := r.Header.Get("X-Amz-Target"); target != "AWSCognitoIdentityProviderService."+operation {
+			t.Errorf("actual X-Amz-Target: %s, did not match expected X-Amz-Target: AWSCognitoIdentityProviderService.%s", target, operation)
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		if got != nil {
+			if err := json.Unmarshal(b, got); err != nil {
+				t.Errorf("request body %s is not JSON: %s", b, err)
+			}
+		}
+
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func Test_Endpoint(t *testing.T) {
+	if e := Endpoint("eu-west-1"); e != "https://cognito-idp.eu-west-1.amazonaws.com" {
+		t.Errorf("actual endpoint: %s, did not match expected endpoint: %s", e, "https://cognito-idp.eu-west-1.amazonaws.com")
+	}
+}
+
+func Test_InitiateAuth(t *testing.T) {
+	var got map[string]interface{}
+
+	s := cognitoServer(t, "InitiateAuth", http.StatusOK, `{
+		"ChallengeName": "PASSWORD_VERIFIER",
+		"ChallengeParameters": {"SALT": "499602d2", "USER_ID_FOR_SRP": "user1"},
+		"Session": "a-session"
+	}`, &got)
+
+	out, err := NewClient(s.URL, s.Client()).InitiateAuth(context.Background(), InitiateAuthInput{
+		AuthFlow:       "USER_SRP_AUTH",
+		ClientId:       "123abd",
+		AuthParameters: map[string]*string{"USERNAME": pointy.String("user1")},
+	})
+	if err != nil {
+		t.Fatalf("InitiateAuth errored: %s", err)
+	}
+
+	if got["AuthFlow"] != "USER_SRP_AUTH" || got["ClientId"] != "123abd" {
+		t.Errorf("actual request: %v, did not have the expected AuthFlow and ClientId", got)
+	}
+	if params, _ := got["AuthParameters"].(map[string]interface{}); params["USERNAME"] != "user1" {
+		t.Errorf("actual AuthParameters: %v, did not have the expected USERNAME", got["AuthParameters"])
+	}
+
+	if out.ChallengeName != "PASSWORD_VERIFIER" {
+		t.Errorf("actual ChallengeName: %s, did not match expected ChallengeName: %s", out.ChallengeName, "PASSWORD_VERIFIER")
+	}
+	if pointy.StringValue(out.ChallengeParameters["USER_ID_FOR_SRP"], "") != "user1" {
+		t.Errorf("actual ChallengeParameters: %v, did not have the expected USER_ID_FOR_SRP", out.ChallengeParameters)
+	}
+	if out.Session != "a-session" {
+		t.Errorf("actual Session: %s, did not match expected Session: %s", out.Session, "a-session")
+	}
+}
+
+func Test_RefreshTokenAuth(t *testing.T) {
+	var got map[string]interface{}
+
+	s := cognitoServer(t, "InitiateAuth", http.StatusOK, `{
+		"AuthenticationResult": {"AccessToken": "access", "ExpiresIn": 3600, "IdToken": "id", "TokenType": "Bearer"}
+	}`, &got)
+
+	result, err := NewClient(s.URL, s.Client()).RefreshTokenAuth(context.Background(), "123abd", "refresh", "eu-west-1_device")
+	if err != nil {
+		t.Fatalf("RefreshTokenAuth errored: %s", err)
+	}
+
+	if got["AuthFlow"] != "REFRESH_TOKEN_AUTH" {
+		t.Errorf("actual AuthFlow: %v, did not match expected AuthFlow: %s", got["AuthFlow"], "REFRESH_TOKEN_AUTH")
+	}
+
+	params, _ := got["AuthParameters"].(map[string]interface{})
+	if params["REFRESH_TOKEN"] != "refresh" || params["DEVICE_KEY"] != "eu-west-1_device" {
+		t.Errorf("actual AuthParameters: %v, did not have the expected REFRESH_TOKEN and DEVICE_KEY", params)
+	}
+
+	if result.IdToken != "id" || result.ExpiresIn != 3600 {
+		t.Errorf("actual result: %+v, did not have the expected IdToken and ExpiresIn", result)
+	}
+
+	// A challenge can't be answered with a refresh token
+	s = cognitoServer(t, "InitiateAuth", http.StatusOK, `{"ChallengeName": "SMS_MFA"}`, nil)
+
+	if _, err := NewClient(s.URL, s.Client()).RefreshTokenAuth(context.Background(), "123abd", "refresh", ""); err == nil || err.Error() != "unexpected challenge returned: SMS_MFA" {
+		t.Errorf("RefreshTokenAuth should error when a challenge is returned, got: %v", err)
+	}
+}
+
+func Test_RespondToAuthChallenge(t *testing.T) {
+	var got map[string]interface{}
+
+	s := cognitoServer(t, "RespondToAuthChallenge", http.StatusOK, `{
+		"AuthenticationResult": {
+			"AccessToken": "access",
+			"IdToken": "id",
+			"RefreshToken": "refresh",
+			"NewDeviceMetadata": {"DeviceKey": "eu-west-1_device", "DeviceGroupKey": "-group"}
+		}
+	}`, &got)
+
+	out, err := NewClient(s.URL, s.Client()).RespondToAuthChallenge(context.Background(), RespondToAuthChallengeInput{
+		ChallengeName:      "SOFTWARE_TOKEN_MFA",
+		ClientId:           "123abd",
+		Session:            "a-session",
+		ChallengeResponses: map[string]*string{"SOFTWARE_TOKEN_MFA_CODE": pointy.String("123456")},
+	})
+	if err != nil {
+		t.Fatalf("RespondToAuthChallenge errored: %s", err)
+	}
+
+	if got["ChallengeName"] != "SOFTWARE_TOKEN_MFA" || got["Session"] != "a-session" {
+		t.Errorf("actual request: %v, did not have the expected ChallengeName and Session", got)
+	}
+
+	if out.AuthenticationResult == nil || out.AuthenticationResult.RefreshToken != "refresh" {
+		t.Fatalf("actual AuthenticationResult: %+v, did not have the expected RefreshToken", out.AuthenticationResult)
+	}
+	if m := out.AuthenticationResult.NewDeviceMetadata; m == nil || m.DeviceKey != "eu-west-1_device" || m.DeviceGroupKey != "-group" {
+		t.Errorf("actual NewDeviceMetadata: %+v, did not match the expected device", m)
+	}
+}
+
+func Test_ConfirmDevice(t *testing.T) {
+	var got map[string]interface{}
+
+	s := cognitoServer(t, "ConfirmDevice", http.StatusOK, `{"UserConfirmationNecessary": true}`, &got)
+
+	out, err := NewClient(s.URL, s.Client()).ConfirmDevice(context.Background(), ConfirmDeviceInput{
+		AccessToken: "access",
+		DeviceKey:   "eu-west-1_device",
+		DeviceName:  "home-stats",
+		DeviceSecretVerifierConfig: DeviceSecretVerifierConfig{
+			PasswordVerifier: "verifier",
+			Salt:             "salt",
+		},
+	})
+	if err != nil {
+		t.Fatalf("ConfirmDevice errored: %s", err)
+	}
+
+	config, _ := got["DeviceSecretVerifierConfig"].(map[string]interface{})
+	if config["PasswordVerifier"] != "verifier" || config["Salt"] != "salt" {
+		t.Errorf("actual DeviceSecretVerifierConfig: %v, did not have the expected PasswordVerifier and Salt", config)
+	}
+
+	if !out.UserConfirmationNecessary {
+		t.Error("UserConfirmationNecessary was not set")
+	}
+}
+
+func Test_UpdateDeviceStatus(t *testing.T) {
+	var got map[string]interface{}
+
+	s := cognitoServer(t, "UpdateDeviceStatus", http.StatusOK, `{}`, &got)
+
+	err := NewClient(s.URL, s.Client()).UpdateDeviceStatus(context.Background(), UpdateDeviceStatusInput{
+		AccessToken:            "access",
+		DeviceKey:              "eu-west-1_device",
+		DeviceRememberedStatus: DeviceRememberedStatusRemembered,
+	})
+	if err != nil {
+		t.Fatalf("UpdateDeviceStatus errored: %s", err)
+	}
+
+	if got["DeviceRememberedStatus"] != "remembered" {
+		t.Errorf("actual DeviceRememberedStatus: %v, did not match expected DeviceRememberedStatus: %s", got["DeviceRememberedStatus"], "remembered")
+	}
+}
+
+func Test_ClientErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		header      string
+		body        string
+		expectedErr string
+	}{
+		{
+			name:        "exception in the body",
+			status:      http.StatusBadRequest,
+			body:        `{"__type": "NotAuthorizedException", "message": "Incorrect username or password."}`,
+			expectedErr: "NotAuthorizedException: Incorrect username or password. (status code: 400)",
+		},
+		{
+			name:        "namespaced exception with a capitalised message",
+			status:      http.StatusBadRequest,
+			body:        `{"__type": "com.amazonaws.cognito.identity.idp.model#UserNotFoundException", "Message": "User does not exist."}`,
+			expectedErr: "UserNotFoundException: User does not exist. (status code: 400)",
+		},
+		{
+			name:        "exception in the header",
+			status:      http.StatusTooManyRequests,
+			header:      "TooManyRequestsException:http://internal.amazon.com/coral/com.amazonaws.cognito.identity.idp/",
+			body:        `not json`,
+			expectedErr: "TooManyRequestsException (status code: 429)",
+		},
+		{
+			name:        "no exception",
+			status:      http.StatusBadGateway,
+			expectedErr: "Bad Gateway (status code: 502)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("X-Amzn-ErrorType", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer s.Close()
+
+			_, err := NewClient(s.URL, s.Client()).InitiateAuth(context.Background(), InitiateAuthInput{})
+
+			var cerr *Error
+			if !errors.As(err, &cerr) {
+				t.Fatalf("actual error: %v, is not a *Error", err)
+			}
+			if cerr.StatusCode != tt.status {
+				t.Errorf("actual status code: %d, did not match expected status code: %d", cerr.StatusCode, tt.status)
+			}
+			if err.Error() != tt.expectedErr {
+				t.Errorf("actual error: %s, did not match expected error: %s", err, tt.expectedErr)
+			}
+		})
+	}
+
+	t.Run("request fails", func(t *testing.T) {
+		s := httptest.NewServer(http.NotFoundHandler())
+		s.Close()
+
+		if _, err := NewClient(s.URL, s.Client()).InitiateAuth(context.Background(), InitiateAuthInput{}); err == nil {
+			t.Error("InitiateAuth should error when the request fails")
+		}
+	})
+
+	t.Run("response isn't JSON", func(t *testing.T) {
+		s := cognitoServer(t, "InitiateAuth", http.StatusOK, `not json`, nil)
+
+		if _, err := NewClient(s.URL, s.Client()).InitiateAuth(context.Background(), InitiateAuthInput{}); err == nil {
+			t.Error("InitiateAuth should error when the response isn't JSON")
+		}
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"strings"
 	"time"
@@ -35,10 +37,26 @@ const (
 	// https://github.com/aws/amazon-cognito-identity-js/blob/master/src/AuthenticationHelper.js#L49
 	gHex     = "2"
 	infoBits = "Caldera Derived Key"
+
+	// timestampFormat is the format of the TIMESTAMP signed in a password
+	// claim, which is the 24-hour clock, e.g. Tue Jul 10 13:01:05 UTC 2018
+	timestampFormat = "Mon Jan 2 15:04:05 MST 2006"
 )
 
+// Option configures a CognitoSRP
+type Option func(*CognitoSRP)
+
+// WithRandom sets where random bytes are read from, which is crypto/rand by
+// default. A fixed source makes the client's ephemeral key, and so every value
+// derived from it, reproducible for known answer tests
+func WithRandom(r io.Reader) Option {
+	return func(c *CognitoSRP) {
+		c.random = r
+	}
+}
+
 // NewCognitoSRP creates a CognitoSRP object
-func NewCognitoSRP(username, password, poolId, clientId string, clientSecret *string) (*CognitoSRP, error) {
+func NewCognitoSRP(username, password, poolId, clientId string, clientSecret *string, opts ...Option) (*CognitoSRP, error) {
 	c := &CognitoSRP{
 		username:     username,
 		password:     password,
@@ -52,15 +70,47 @@ func NewCognitoSRP(username, password, poolId, clientId string, clientSecret *st
 	}
 	c.poolName = strings.Split(poolId, "_")[1]
 
-	c.bigN = hexToBig(nHex)
-	c.g = hexToBig(gHex)
-	c.k = hexToBig(hexHash("00" + nHex + "0" + gHex))
-	c.a = c.generateRandomSmallA()
-	c.bigA = c.calculateA()
+	if err := c.init(opts); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
 
+// apply sets the defaults, then applies opts
+func (csrp *CognitoSRP) apply(opts []Option) {
+	csrp.random = rand.Reader
+	for _, opt := range opts {
+		opt(csrp)
+	}
+}
+
+// init applies opts, sets the SRP constants and generates the client's
+// ephemeral key pair
+func (csrp *CognitoSRP) init(opts []Option) error {
+	csrp.apply(opts)
+
+	csrp.bigN = mustHexToBig(nHex)
+	csrp.g = mustHexToBig(gHex)
+	csrp.k = mustHexToBig(hexHash("00" + nHex + "0" + gHex))
+
+	a, err := csrp.generateRandomSmallA()
+	if err != nil {
+		return err
+	}
+
+	csrp.a = a
+
+	bigA, err := csrp.calculateA()
+	if err != nil {
+		return err
+	}
+
+	csrp.bigA = bigA
+
+	return nil
+}
+
 // CognitoSRP handles SRP authentication with AWS Cognito
 type CognitoSRP struct {
 	username     string
@@ -69,6 +119,7 @@ type CognitoSRP struct {
 	poolName     string
 	clientId     string
 	clientSecret *string
+	random       io.Reader
 	bigN         *big.Int
 	g            *big.Int
 	k            *big.Int
@@ -135,20 +186,50 @@ func (csrp *CognitoSRP) GetSecretHash(username string) (string, error) {
 // inside the cognitoidentityprovider.RespondToAuthChallengeInput object which
 // fulfils the PASSWORD_VERIFIER Cognito challenge
 func (csrp *CognitoSRP) PasswordVerifierChallenge(challengeParms map[string]*string, ts time.Time) (map[string]*string, error) {
+	userId := pointy.StringValue(challengeParms["USER_ID_FOR_SRP"], "")
+
+	response, err := csrp.passwordClaim(userId, challengeParms, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret, err := csrp.GetSecretHash(csrp.username); err == nil {
+		response["SECRET_HASH"] = pointy.String(secret)
+	}
+
+	return response, nil
+}
+
+// passwordClaim signs the SECRET_BLOCK of a PASSWORD_VERIFIER or
+// DEVICE_PASSWORD_VERIFIER challenge with the key derived from the password
+func (csrp *CognitoSRP) passwordClaim(userId string, challengeParms map[string]*string, ts time.Time) (map[string]*string, error) {
 	var (
 		internalUsername = pointy.StringValue(challengeParms["USERNAME"], "")
-		userId           = pointy.StringValue(challengeParms["USER_ID_FOR_SRP"], "")
 		saltHex          = pointy.StringValue(challengeParms["SALT"], "")
 		srpBHex          = pointy.StringValue(challengeParms["SRP_B"], "")
 		secretBlockB64   = pointy.StringValue(challengeParms["SECRET_BLOCK"], "")
 
-		timestamp = ts.In(time.UTC).Format("Mon Jan 2 03:04:05 MST 2006")
-		hkdf      = csrp.getPasswordAuthenticationKey(userId, csrp.password, hexToBig(srpBHex), hexToBig(saltHex))
+		timestamp = ts.In(time.UTC).Format(timestampFormat)
 	)
 
+	bigB, err := hexToBig(srpBHex)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode challenge parameter 'SRP_B', %w", err)
+	}
+
+	salt, err := hexToBig(saltHex)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode challenge parameter 'SALT', %w", err)
+	}
+
 	secretBlockBytes, err := base64.StdEncoding.DecodeString(secretBlockB64)
 	if err != nil {
-		return nil, fmt.Errorf("unable to decode challenge parameter 'SECRET_BLOCK', %s", err.Error())
+		return nil, fmt.Errorf("unable to decode challenge parameter 'SECRET_BLOCK', %w", err)
+	}
+
+	hkdf, err := csrp.getPasswordAuthenticationKey(userId, csrp.password, bigB, salt)
+	if err != nil {
+		return nil, err
 	}
 
 	msg := csrp.poolName + userId + string(secretBlockBytes) + timestamp
@@ -156,48 +237,55 @@ func (csrp *CognitoSRP) PasswordVerifierChallenge(challengeParms map[string]*str
 	hmacObj.Write([]byte(msg))
 	signature := base64.StdEncoding.EncodeToString(hmacObj.Sum(nil))
 
-	response := map[string]*string{
+	return map[string]*string{
 		"TIMESTAMP":                   pointy.String(timestamp),
 		"USERNAME":                    pointy.String(internalUsername),
 		"PASSWORD_CLAIM_SECRET_BLOCK": pointy.String(secretBlockB64),
 		"PASSWORD_CLAIM_SIGNATURE":    pointy.String(signature),
-	}
-	if secret, err := csrp.GetSecretHash(csrp.username); err == nil {
-		response["SECRET_HASH"] = pointy.String(secret)
-	}
-
-	return response, nil
+	}, nil
 }
 
-func (csrp *CognitoSRP) generateRandomSmallA() *big.Int {
-	randomLongInt := getRandom(128)
+func (csrp *CognitoSRP) generateRandomSmallA() (*big.Int, error) {
+	randomLongInt, err := getRandom(csrp.random, 128)
+	if err != nil {
+		return nil, err
+	}
 
-	return big.NewInt(0).Mod(randomLongInt, csrp.bigN)
+	return big.NewInt(0).Mod(randomLongInt, csrp.bigN), nil
 }
 
-func (csrp *CognitoSRP) calculateA() *big.Int {
+func (csrp *CognitoSRP) calculateA() (*big.Int, error) {
 	bigA := big.NewInt(0).Exp(csrp.g, csrp.a, csrp.bigN)
-	if big.NewInt(0).Mod(bigA, csrp.bigN).Cmp(big.NewInt(0)) == 0 {
-		panic("Safety check for A failed. A must not be divisable by N")
+	if big.NewInt(0).Mod(bigA, csrp.bigN).Sign() == 0 {
+		return nil, errors.New("safety check for A failed, A must not be divisible by N")
 	}
 
-	return bigA
+	return bigA, nil
 }
 
-func (csrp *CognitoSRP) getPasswordAuthenticationKey(username, password string, bigB, salt *big.Int) []byte {
+func (csrp *CognitoSRP) getPasswordAuthenticationKey(username, password string, bigB, salt *big.Int) ([]byte, error) {
+	// The same safety checks as the AWS JavaScript SDK, as a malicious B could reveal the password
+	if big.NewInt(0).Mod(bigB, csrp.bigN).Sign() == 0 {
+		return nil, errors.New("safety check for B failed, B must not be divisible by N")
+	}
+
+	uVal := calculateU(csrp.bigA, bigB)
+	if uVal.Sign() == 0 {
+		return nil, errors.New("safety check for u failed, u must not be zero")
+	}
+
 	var (
 		userPass     = fmt.Sprintf("%s%s:%s", csrp.poolName, username, password)
 		userPassHash = hashSha256([]byte(userPass))
 
-		uVal      = calculateU(csrp.bigA, bigB)
-		xVal      = hexToBig(hexHash(padHex(salt.Text(16)) + userPassHash))
+		xVal      = mustHexToBig(hexHash(padHex(salt.Text(16)) + userPassHash))
 		gModPowXN = big.NewInt(0).Exp(csrp.g, xVal, csrp.bigN)
 		intVal1   = big.NewInt(0).Sub(bigB, big.NewInt(0).Mul(csrp.k, gModPowXN))
 		intVal2   = big.NewInt(0).Add(csrp.a, big.NewInt(0).Mul(uVal, xVal))
 		sVal      = big.NewInt(0).Exp(intVal1, intVal2, csrp.bigN)
 	)
 
-	return computeHKDF(padHex(sVal.Text(16)), padHex(bigToHex(uVal)))
+	return computeHKDF(padHex(sVal.Text(16)), padHex(bigToHex(uVal))), nil
 }
 
 func hashSha256(buf []byte) string {
@@ -213,10 +301,21 @@ func hexHash(hexStr string) string {
 	return hashSha256(buf)
 }
 
-func hexToBig(hexStr string) *big.Int {
+// hexToBig parses hex from the server, which may be malformed
+func hexToBig(hexStr string) (*big.Int, error) {
 	i, ok := big.NewInt(0).SetString(hexStr, 16)
 	if !ok {
-		panic(fmt.Sprintf("unable to covert \"%s\" to big Int", hexStr))
+		return nil, fmt.Errorf("unable to convert \"%s\" to big Int", hexStr)
+	}
+
+	return i, nil
+}
+
+// mustHexToBig parses hex which is known to be valid, i.e. constants and hashes
+func mustHexToBig(hexStr string) *big.Int {
+	i, err := hexToBig(hexStr)
+	if err != nil {
+		panic(err.Error())
 	}
 
 	return i
@@ -226,11 +325,13 @@ func bigToHex(val *big.Int) string {
 	return val.Text(16)
 }
 
-func getRandom(n int) *big.Int {
+func getRandom(r io.Reader, n int) (*big.Int, error) {
 	b := make([]byte, n)
-	rand.Read(b)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("unable to read random bytes: %w", err)
+	}
 
-	return hexToBig(hex.EncodeToString(b))
+	return big.NewInt(0).SetBytes(b), nil
 }
 
 func padHex(hexStr string) string {
@@ -259,5 +360,5 @@ func computeHKDF(ikm, salt string) []byte {
 }
 
 func calculateU(bigA, bigB *big.Int) *big.Int {
-	return hexToBig(hexHash(padHex(bigA.Text(16)) + padHex(bigB.Text(16))))
+	return mustHexToBig(hexHash(padHex(bigA.Text(16)) + padHex(bigB.Text(16))))
 }
@@ -1,10 +1,13 @@
 package cognitosrp
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math/big"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,8 +36,13 @@ func Test_NewCognitoSRP(t *testing.T) {
 		t.Errorf("k: %v, did not match expected value of: %v", csrp.k, expected)
 	}
 	// csrp.a - is random so lets set it and re-calculate A
-	csrp.a = big.NewInt(1234567890)
-	csrp.bigA = csrp.calculateA()
+	csrp, err = NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", nil, WithRandom(fixedRandom(big.NewInt(1234567890))))
+	if err != nil {
+		t.Fatalf("failed creating CognitoSRP: %s", err.Error())
+	}
+	if csrp.a.Cmp(big.NewInt(1234567890)) != 0 {
+		t.Errorf("a: %v, did not match expected value of: %v", csrp.a, 1234567890)
+	}
 	// csrp.bigA
 	expected, _ = big.NewInt(0).SetString("2012821450179237266067414751941060928019817287314017835667297413615441680042015648893619512074574801551816908048875039310556108650595869145768432324376774060555385775073708569121688902158895642383219736852216366144529156744028151458424436810791218362729260005923018973559621869173270335133101064964177433161771074465994401225946602823489327809869650103314918749719145076380535976325009253493972634191523079035525341598366462733532137597586069288340594563327421244726332307232609401008335819089778907622323610696065668900966210610871808610884224270017149857647788822043386341947275701612494162630191389615660619561655481399573723311377577792260581174997618956152489507325218699555095233121100546572188701563979417701865276739418278601329844176326814813849675127887644523181751359470351143169066091784103404544366711287145804238613966547260918328728126017769114261057445005776403447691297001659393612551419207658913838531096191", 10)
 	if csrp.bigA.Cmp(expected) != 0 {
@@ -46,6 +54,17 @@ func Test_NewCognitoSRP(t *testing.T) {
 	if err == nil {
 		t.Errorf("PasswordVerifierChallenge should error on bad 'SECRET_BLOCK'")
 	}
+
+	// run out of randomness
+	_, err = NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", nil, WithRandom(bytes.NewReader(make([]byte, 127))))
+	if err == nil || !strings.Contains(err.Error(), "unable to read random bytes") {
+		t.Errorf("NewCognitoSRP should error when there's not enough randomness, got: %v", err)
+	}
+}
+
+// fixedRandom returns a source of randomness which generates a as the client's small a
+func fixedRandom(a *big.Int) io.Reader {
+	return bytes.NewReader(a.FillBytes(make([]byte, 128)))
 }
 
 func Test_Getters(t *testing.T) {
@@ -67,9 +86,7 @@ func Test_Getters(t *testing.T) {
 
 func Test_GetAuthParams(t *testing.T) {
 	cs := "clientSecret"
-	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", &cs)
-	csrp.a = big.NewInt(1234567890)
-	csrp.bigA = csrp.calculateA()
+	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", &cs, WithRandom(fixedRandom(big.NewInt(1234567890))))
 
 	params := csrp.GetAuthParams()
 
@@ -108,9 +125,7 @@ func Test_GetSecretHash(t *testing.T) {
 
 func Test_PasswordVerifierChallenge(t *testing.T) {
 	cs := "clientSecret"
-	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", &cs)
-	csrp.a = big.NewInt(1234567890)
-	csrp.bigA = csrp.calculateA()
+	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", &cs, WithRandom(fixedRandom(big.NewInt(1234567890))))
 	challengeParmas := map[string]*string{
 		"USER_ID_FOR_SRP": pointy.String("test"),
 		"SALT":            pointy.String(big.NewInt(1234567890).Text(16)),
@@ -133,27 +148,120 @@ func Test_PasswordVerifierChallenge(t *testing.T) {
 	}
 }
 
+// testSmallA is the client's small a used by the known answer tests. Their
+// expected values, and Cognito's SRP_B, are printed by testdata/srp_vectors.py
+const testSmallA = "5a5f1e6b3c2d4e5f60718293a4b5c6d7e8f90112233445566778899aabbccddeeff00112233445566778899aabbccdd"
+
+func Test_PasswordVerifierChallenge_KnownAnswer(t *testing.T) {
+	csrp, err := NewCognitoSRP("user1", "Passw0rd!", "eu-west-1_myPool", "123abd", nil, WithRandom(fixedRandom(mustHexToBig(testSmallA))))
+	if err != nil {
+		t.Fatalf("failed creating CognitoSRP: %s", err.Error())
+	}
+
+	expectedA := "322d2dc4607a9be18f42a060afad385d60e303b0beb955e8225313709c81e61f3f777018c59139ea4d511c2d288e2e275014" +
+		"bf19f226d916cbca91f1f666a17fc85bd3b8dfcb02c1884f0194448b3247395adcdc2451c5216ea5e6ec58149b94055a737a" +
+		"b600f49e2fb2011f31992303830939622744f9b69d4cbb16a6486a8133c142224805dd2f2756ccdd29b5cde0c87d531d7be6" +
+		"ff72484ef11e23a6cfebbda240c15596e17c2ba8cdd2ffb8611041ef0e4c63d583ad4d891038e4ff7455e387d6b619f77e93" +
+		"b35005f9d5ad284b941f5101a0b0b2a75e0770df55d0ab624bb3267da1d97c6b0945c91ea0d95c66d1515092c33dc418a3a2" +
+		"a6ad0913ef6857a1dc3a7de572027861dafeb952445faa7ad4dfd5fbdafc0c536543ab529dff553c7779bcbf27a0352cbb55" +
+		"17382a443939981399a605eebc27d7dd58b91c783c92af607ab72811ed0925df6d5f98d40fcdb05944b4efe28cc7517872c9" +
+		"4b6a36495a1399ecbdb2ce3e0e3bfcbc2757da25e22e59b539ff8abac18db86233f6"
+	if *csrp.GetAuthParams()["SRP_A"] != expectedA {
+		t.Errorf("actual SRP_A: %s, did not match expected SRP_A: %s", *csrp.GetAuthParams()["SRP_A"], expectedA)
+	}
+
+	challengeParms := map[string]*string{
+		"USERNAME":        pointy.String("5d9c8a7b-6e5f-4a3b-9c2d-1e0f9a8b7c6d"),
+		"USER_ID_FOR_SRP": pointy.String("5d9c8a7b-6e5f-4a3b-9c2d-1e0f9a8b7c6d"),
+		"SALT":            pointy.String("3c9d2f1e0a8b7c6d5e4f3a2b1c0d9e8f"),
+		"SRP_B": pointy.String("568b94c38345bb48e9dcbfc289ac62e1365cd89d89887c0c24f28a36b6bf9835e67cc89a94dfce063093d6147036a9489bed" +
+			"a47addcfa2b80868f413940e0cbcadc2c3811f3070ed945035d31b6e204237731792f0ef7d8c67261a6b0028366d658ef710" +
+			"4ee5196865f5eebfc55ff0fade6b010de1a26745d5804f37c2bf0f0416b774a1c0f0b6588d8bae7a630bd4c3b3f5b1ec2c18" +
+			"8443f544a6b22b9783c8b62100270ad3ff5abfd8370adcd1bf64ab2a31f5a796dda6452610da15d6fef00ceec4959f121f7e" +
+			"247c5ee75d8cc0ef8f80db4d67dff05508be5560317c523539a47c3e2c21fdc69d28f56cdf97b84f8af4184b21a36cd9a78c" +
+			"671edbfb36b3b1b5824b167b7a836ac99dae86df409492742428031b3cd1a4d24c4c3edadac3d423f46b2852aff50a300f75" +
+			"4bd02643356be95c2db4f394d7b6df46f8e47aab08aea5fff6e7a70df408cbe743f32c3b469b807df3e173724cd085d3862b" +
+			"8235a241a749ede884ad48f48452debb384e6bf51104cdd8341a243b20ec1a984de8"),
+		"SECRET_BLOCK": pointy.String(base64.StdEncoding.EncodeToString([]byte("a-secret-block-from-cognito"))),
+	}
+
+	resp, err := csrp.PasswordVerifierChallenge(challengeParms, time.Date(2018, 7, 10, 13, 1, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("PasswordVerifierChallenge errored: %s", err)
+	}
+
+	expected := "AOuS0zY/2HXWIIxILnK+zU6vXbcbTgE4GzomXYs+spI="
+	if *resp["PASSWORD_CLAIM_SIGNATURE"] != expected {
+		t.Errorf("actual PASSWORD_CLAIM_SIGNATURE: %s, did not match expected PASSWORD_CLAIM_SIGNATURE: %s", *resp["PASSWORD_CLAIM_SIGNATURE"], expected)
+	}
+}
+
+func Test_PasswordVerifierChallenge_Malformed(t *testing.T) {
+	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", nil)
+
+	tests := []struct {
+		name        string
+		salt        *string
+		srpB        *string
+		expectedErr string
+	}{
+		{
+			name:        "missing SRP_B",
+			salt:        pointy.String("499602d2"),
+			expectedErr: "unable to decode challenge parameter 'SRP_B', unable to convert \"\" to big Int",
+		},
+		{
+			name:        "SRP_B not hex",
+			salt:        pointy.String("499602d2"),
+			srpB:        pointy.String("not hex"),
+			expectedErr: "unable to decode challenge parameter 'SRP_B', unable to convert \"not hex\" to big Int",
+		},
+		{
+			name:        "SRP_B of zero",
+			salt:        pointy.String("499602d2"),
+			srpB:        pointy.String("0"),
+			expectedErr: "safety check for B failed, B must not be divisible by N",
+		},
+		{
+			name:        "SALT not hex",
+			salt:        pointy.String("not hex"),
+			srpB:        pointy.String("499602d2"),
+			expectedErr: "unable to decode challenge parameter 'SALT', unable to convert \"not hex\" to big Int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challengeParms := map[string]*string{
+				"USER_ID_FOR_SRP": pointy.String("test"),
+				"SALT":            tt.salt,
+				"SRP_B":           tt.srpB,
+				"SECRET_BLOCK":    pointy.String(base64.StdEncoding.EncodeToString([]byte("secretssecrestssecrets"))),
+			}
+
+			_, err := csrp.PasswordVerifierChallenge(challengeParms, time.Now())
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Errorf("actual error: %v, did not match expected error: %s", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
 func Test_calculateA(t *testing.T) {
 	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", nil)
-	// test panic
 	csrp.g = big.NewInt(0)
-	defer func() {
-		errmsg := recover().(string)
-		if errmsg != "Safety check for A failed. A must not be divisable by N" {
-			t.Errorf("Wrong panic message: %s", errmsg)
-		}
-	}()
-	csrp.calculateA()
-	t.Fatal("calculateA did not panic on 0 g value")
+
+	_, err := csrp.calculateA()
+	if err == nil || err.Error() != "safety check for A failed, A must not be divisible by N" {
+		t.Errorf("calculateA should error on 0 g value, got: %v", err)
+	}
 }
 
 func Test_getPasswordAuthenticationKey(t *testing.T) {
 	cs := "clientSecret"
-	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", &cs)
+	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", &cs, WithRandom(fixedRandom(big.NewInt(1234567890))))
 	bigB := big.NewInt(1234567890)
 	salt := big.NewInt(1234567890)
-	csrp.a = big.NewInt(1234567890)
-	csrp.bigA = csrp.calculateA()
 
 	expectedBigA, _ := big.NewInt(0).SetString("2012821450179237266067414751941060928019817287314017835667297413615441680042015648893619512074574801551816908048875039310556108650595869145768432324376774060555385775073708569121688902158895642383219736852216366144529156744028151458424436810791218362729260005923018973559621869173270335133101064964177433161771074465994401225946602823489327809869650103314918749719145076380535976325009253493972634191523079035525341598366462733532137597586069288340594563327421244726332307232609401008335819089778907622323610696065668900966210610871808610884224270017149857647788822043386341947275701612494162630191389615660619561655481399573723311377577792260581174997618956152489507325218699555095233121100546572188701563979417701865276739418278601329844176326814813849675127887644523181751359470351143169066091784103404544366711287145804238613966547260918328728126017769114261057445005776403447691297001659393612551419207658913838531096191", 10)
 
@@ -162,11 +270,19 @@ func Test_getPasswordAuthenticationKey(t *testing.T) {
 	}
 
 	expectedKey := "d96cde6c95dda17175c1293140c5a81f"
-	key := csrp.getPasswordAuthenticationKey(csrp.username, csrp.password, bigB, salt)
+	key, err := csrp.getPasswordAuthenticationKey(csrp.username, csrp.password, bigB, salt)
+	if err != nil {
+		t.Fatalf("getPasswordAuthenticationKey errored: %s", err)
+	}
 	keyHex := hex.EncodeToString(key)
 	if keyHex != expectedKey {
 		t.Errorf("actual key: %s, did not match expected key: %s", keyHex, expectedKey)
 	}
+
+	// B is checked, as a malicious server could use it to reveal the password
+	if _, err := csrp.getPasswordAuthenticationKey(csrp.username, csrp.password, csrp.bigN, salt); err == nil {
+		t.Error("getPasswordAuthenticationKey should error when B is divisible by N")
+	}
 }
 
 func Test_hashSha256(t *testing.T) {
@@ -191,21 +307,31 @@ func Test_hexHash(t *testing.T) {
 func Test_hexToBig(t *testing.T) {
 	in := "499602d2"
 	expectedOut := big.NewInt(1234567890)
-	out := hexToBig(in)
+	out, err := hexToBig(in)
+	if err != nil {
+		t.Fatalf("hexToBig errored: %s", err)
+	}
 	if out.Cmp(expectedOut) != 0 {
 		t.Errorf("actual out: %v, did not match expected out: %v", out, expectedOut)
 	}
 
-	// test panic
 	in = "non-hex input"
+	_, err = hexToBig(in)
+	if err == nil || err.Error() != fmt.Sprintf("unable to convert \"%s\" to big Int", in) {
+		t.Errorf("hexToBig should error on non-hex input, got: %v", err)
+	}
+}
+
+func Test_mustHexToBig(t *testing.T) {
+	in := "non-hex input"
 	defer func() {
 		errmsg := recover().(string)
-		if errmsg != fmt.Sprintf("unable to covert \"%s\" to big Int", in) {
+		if errmsg != fmt.Sprintf("unable to convert \"%s\" to big Int", in) {
 			t.Errorf("Wrong panic message: %s", errmsg)
 		}
 	}()
-	hexToBig(in)
-	t.Fatal("hexToBig did not panic on non-hex input")
+	mustHexToBig(in)
+	t.Fatal("mustHexToBig did not panic on non-hex input")
 }
 
 func Test_bigToHex(t *testing.T) {
@@ -258,3 +384,23 @@ func Test_calculateU(t *testing.T) {
 		t.Errorf("actual out: %v, did not match expected out: %v", out, expectedOut)
 	}
 }
+
+func Test_PasswordVerifierChallenge_Timestamp(t *testing.T) {
+	csrp, _ := NewCognitoSRP("test", "test", "eu-west-1_myPool", "123abd", nil)
+	challengeParms := map[string]*string{
+		"USER_ID_FOR_SRP": pointy.String("test"),
+		"SALT":            pointy.String(big.NewInt(1234567890).Text(16)),
+		"SRP_B":           pointy.String(big.NewInt(1234567890).Text(16)),
+		"SECRET_BLOCK":    pointy.String(base64.StdEncoding.EncodeToString([]byte("secretssecrestssecrets"))),
+	}
+
+	// Cognito rejects claims signed with the 12-hour clock in the afternoon
+	resp, err := csrp.PasswordVerifierChallenge(challengeParms, time.Date(2018, 7, 10, 13, 1, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("PasswordVerifierChallenge errored: %s", err)
+	}
+
+	if *resp["TIMESTAMP"] != "Tue Jul 10 13:01:05 UTC 2018" {
+		t.Errorf("actual TIMESTAMP: %s, did not match expected TIMESTAMP: %s", *resp["TIMESTAMP"], "Tue Jul 10 13:01:05 UTC 2018")
+	}
+}
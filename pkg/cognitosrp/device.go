@@ -0,0 +1,116 @@
+package cognitosrp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/openlyinc/pointy"
+)
+
+// devicePasswordLength is the number of random bytes in a device password
+const devicePasswordLength = 40
+
+// NewDeviceSRP creates a CognitoSRP for a device remembered by Cognito, which
+// authenticates with its key, group key and password in the DEVICE_SRP_AUTH flow.
+// This lets the device skip MFA when it logs in
+func NewDeviceSRP(deviceKey, deviceGroupKey, devicePassword, clientId string, opts ...Option) (*CognitoSRP, error) {
+	c := &CognitoSRP{
+		username: deviceKey,
+		password: devicePassword,
+		poolName: deviceGroupKey,
+		clientId: clientId,
+	}
+
+	if err := c.init(opts); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// DeviceSRPAuthChallenge returns the ChallengeResponses map which fulfils the
+// DEVICE_SRP_AUTH Cognito challenge, where username is the USERNAME
+// returned by the preceding challenge
+func (csrp *CognitoSRP) DeviceSRPAuthChallenge(username string) map[string]*string {
+	return map[string]*string{
+		"USERNAME":   pointy.String(username),
+		"DEVICE_KEY": pointy.String(csrp.username),
+		"SRP_A":      pointy.String(bigToHex(csrp.bigA)),
+	}
+}
+
+// DevicePasswordVerifierChallenge returns the ChallengeResponses map which
+// fulfils the DEVICE_PASSWORD_VERIFIER Cognito challenge, where username is
+// the USERNAME returned by the challenge preceding DEVICE_SRP_AUTH. As with
+// the AWS JavaScript SDK, it's used rather than any USERNAME in challengeParms
+func (csrp *CognitoSRP) DevicePasswordVerifierChallenge(username string, challengeParms map[string]*string, ts time.Time) (map[string]*string, error) {
+	response, err := csrp.passwordClaim(csrp.username, challengeParms, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	response["USERNAME"] = pointy.String(username)
+	response["DEVICE_KEY"] = pointy.String(csrp.username)
+
+	return response, nil
+}
+
+// DeviceVerifier is the DeviceSecretVerifierConfig sent to ConfirmDevice to
+// remember a new device, along with the random password it was generated from.
+// The password is needed whenever the device logs in, so it must be stored
+// with the device key and group key
+type DeviceVerifier struct {
+	Password string
+	// Salt and PasswordVerifier are base64 encoded
+	Salt             string
+	PasswordVerifier string
+}
+
+// NewDeviceVerifier generates a random password for the device returned as
+// NewDeviceMetadata after logging in, and the verifier Cognito uses to check it.
+// Only the WithRandom option applies
+func NewDeviceVerifier(deviceKey, deviceGroupKey string, opts ...Option) (DeviceVerifier, error) {
+	c := &CognitoSRP{}
+	c.apply(opts)
+
+	password := make([]byte, devicePasswordLength)
+	if _, err := io.ReadFull(c.random, password); err != nil {
+		return DeviceVerifier{}, fmt.Errorf("unable to generate device password: %w", err)
+	}
+
+	salt, err := getRandom(c.random, 16)
+	if err != nil {
+		return DeviceVerifier{}, fmt.Errorf("unable to generate salt: %w", err)
+	}
+
+	return newDeviceVerifier(deviceKey, deviceGroupKey, base64.StdEncoding.EncodeToString(password), salt)
+}
+
+func newDeviceVerifier(deviceKey, deviceGroupKey, password string, salt *big.Int) (DeviceVerifier, error) {
+	var (
+		saltHex  = padHex(bigToHex(salt))
+		hashed   = hashSha256([]byte(deviceGroupKey + deviceKey + ":" + password))
+		xVal     = mustHexToBig(hexHash(saltHex + hashed))
+		verifier = big.NewInt(0).Exp(mustHexToBig(gHex), xVal, mustHexToBig(nHex))
+	)
+
+	saltBytes, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return DeviceVerifier{}, fmt.Errorf("unable to decode salt: %w", err)
+	}
+
+	verifierBytes, err := hex.DecodeString(padHex(bigToHex(verifier)))
+	if err != nil {
+		return DeviceVerifier{}, fmt.Errorf("unable to decode verifier: %w", err)
+	}
+
+	return DeviceVerifier{
+		Password:         password,
+		Salt:             base64.StdEncoding.EncodeToString(saltBytes),
+		PasswordVerifier: base64.StdEncoding.EncodeToString(verifierBytes),
+	}, nil
+}
@@ -0,0 +1,279 @@
+package cognitosrp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/openlyinc/pointy"
+)
+
+func Test_NewDeviceSRP(t *testing.T) {
+	csrp, err := NewDeviceSRP("eu-west-1_deviceKey", "groupKey", "devicePassword", "123abd")
+	if err != nil {
+		t.Fatalf("NewDeviceSRP errored: %s", err)
+	}
+
+	if csrp.GetUsername() != "eu-west-1_deviceKey" {
+		t.Errorf("actual username: %s, did not match expected username: %s", csrp.GetUsername(), "eu-west-1_deviceKey")
+	}
+	if csrp.GetUserPoolName() != "groupKey" {
+		t.Errorf("actual pool name: %s, did not match expected pool name: %s", csrp.GetUserPoolName(), "groupKey")
+	}
+	if csrp.bigA == nil || csrp.bigA.Sign() == 0 {
+		t.Error("A was not generated")
+	}
+}
+
+func Test_DeviceSRPAuthChallenge(t *testing.T) {
+	csrp, err := NewDeviceSRP("eu-west-1_deviceKey", "groupKey", "devicePassword", "123abd")
+	if err != nil {
+		t.Fatalf("NewDeviceSRP errored: %s", err)
+	}
+
+	resp := csrp.DeviceSRPAuthChallenge("internal-username")
+
+	if *resp["USERNAME"] != "internal-username" {
+		t.Errorf("actual USERNAME: %s, did not match expected USERNAME: %s", *resp["USERNAME"], "internal-username")
+	}
+	if *resp["DEVICE_KEY"] != "eu-west-1_deviceKey" {
+		t.Errorf("actual DEVICE_KEY: %s, did not match expected DEVICE_KEY: %s", *resp["DEVICE_KEY"], "eu-west-1_deviceKey")
+	}
+	if *resp["SRP_A"] != csrp.bigA.Text(16) {
+		t.Errorf("actual SRP_A: %s, did not match expected SRP_A: %s", *resp["SRP_A"], csrp.bigA.Text(16))
+	}
+}
+
+func Test_DevicePasswordVerifierChallenge(t *testing.T) {
+	csrp, err := NewDeviceSRP("eu-west-1_deviceKey", "groupKey", "devicePassword", "123abd")
+	if err != nil {
+		t.Fatalf("NewDeviceSRP errored: %s", err)
+	}
+	// USERNAME in the challenge is ignored in favour of the username passed in
+	challengeParms := map[string]*string{
+		"USERNAME":     pointy.String("eu-west-1_deviceKey"),
+		"SALT":         pointy.String(big.NewInt(1234567890).Text(16)),
+		"SRP_B":        pointy.String(big.NewInt(1234567890).Text(16)),
+		"SECRET_BLOCK": pointy.String(base64.StdEncoding.EncodeToString([]byte("secretssecrestssecrets"))),
+	}
+
+	resp, err := csrp.DevicePasswordVerifierChallenge("internal-username", challengeParms, time.Date(2018, 7, 10, 11, 1, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("DevicePasswordVerifierChallenge errored: %s", err)
+	}
+
+	if *resp["DEVICE_KEY"] != "eu-west-1_deviceKey" {
+		t.Errorf("actual DEVICE_KEY: %s, did not match expected DEVICE_KEY: %s", *resp["DEVICE_KEY"], "eu-west-1_deviceKey")
+	}
+	if *resp["USERNAME"] != "internal-username" {
+		t.Errorf("actual USERNAME: %s, did not match expected USERNAME: %s", *resp["USERNAME"], "internal-username")
+	}
+	if *resp["TIMESTAMP"] != "Tue Jul 10 11:01:00 UTC 2018" {
+		t.Errorf("actual TIMESTAMP: %s, did not match expected TIMESTAMP: %s", *resp["TIMESTAMP"], "Tue Jul 10 11:01:00 UTC 2018")
+	}
+	if pointy.StringValue(resp["PASSWORD_CLAIM_SIGNATURE"], "") == "" {
+		t.Error("PASSWORD_CLAIM_SIGNATURE was not set")
+	}
+
+	challengeParms["SECRET_BLOCK"] = pointy.String("not base64 encoded")
+	if _, err := csrp.DevicePasswordVerifierChallenge("internal-username", challengeParms, time.Now()); err == nil {
+		t.Fatal("DevicePasswordVerifierChallenge should error on bad 'SECRET_BLOCK'")
+	}
+}
+
+func Test_NewDeviceVerifier(t *testing.T) {
+	dv, err := NewDeviceVerifier("eu-west-1_deviceKey", "groupKey")
+	if err != nil {
+		t.Fatalf("NewDeviceVerifier errored: %s", err)
+	}
+
+	password, err := base64.StdEncoding.DecodeString(dv.Password)
+	if err != nil || len(password) != devicePasswordLength {
+		t.Errorf("password %q is not %d base64 encoded bytes", dv.Password, devicePasswordLength)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(dv.Salt)
+	if err != nil {
+		t.Fatalf("salt %q is not base64 encoded", dv.Salt)
+	}
+
+	verifier, err := base64.StdEncoding.DecodeString(dv.PasswordVerifier)
+	if err != nil {
+		t.Fatalf("verifier %q is not base64 encoded", dv.PasswordVerifier)
+	}
+
+	// The verifier is g^x, where x is derived from the salt and password
+	x := mustHexToBig(hexHash(hex.EncodeToString(salt) + hashSha256([]byte("groupKeyeu-west-1_deviceKey:"+dv.Password))))
+	expected := big.NewInt(0).Exp(mustHexToBig(gHex), x, mustHexToBig(nHex))
+
+	if big.NewInt(0).SetBytes(verifier).Cmp(expected) != 0 {
+		t.Errorf("verifier: %x, did not match expected value of: %x", verifier, expected)
+	}
+}
+
+// The device and password used by the known answer tests below. The verifiers,
+// SRP_B and claim signature are generated from them by testdata/srp_vectors.py
+const (
+	testDeviceKey      = "eu-west-1_0d5c4e3f-1a2b-4c3d-9e8f-7a6b5c4d3e2f"
+	testDeviceGroupKey = "-a1b2c3d4e"
+	testDevicePassword = "2GgC5Dx6QRWBnWJ4UrK0k7vxAY3M9PcVpZ1jXqH8eLtaNfs5bOyTwmIo"
+	testDeviceSalt     = "8d2f5e0c9b1a4f3e7d6c5b4a39281706"
+)
+
+func Test_newDeviceVerifier(t *testing.T) {
+	tests := []struct {
+		name             string
+		salt             string
+		expectedSalt     string
+		expectedVerifier string
+	}{
+		{
+			// The salt has its top bit set, so it's padded with a leading 00 byte
+			name:         "salt with the top bit set",
+			salt:         testDeviceSalt,
+			expectedSalt: "AI0vXgybGk8+fWxbSjkoFwY=",
+			expectedVerifier: "WC5LQDHYDz7BTtZ6Sz5OMSldV22ZH+xwpA+OKUShnY+8rT9fE6G7xREFOyVOfmEIrx5JUk/G9p36W9KjLbD8s+ILnBSWZ2MIFcY1" +
+				"QMoK5XYLxo8c4k+pFzMT9+R04NaRForBRaN3fG5Wut1jkzGZDeduh3sV+YDykOp+/sFvD22SDfJ4J9IETvh+td6lPdRxR04+eMV5" +
+				"MRkQXnmfNbtKZubZlfIwInv3LeccBCQ4Rmu2IGRPJ3piFznIncyNjaMsxlGTcvWxRHmcPTnauptW72tVlxpO/AVqy68+mC/ZSMJh" +
+				"rxWbXwZH6V8TD65fiW51qYRz5LfVmdE/6BJU3lFvFihzWQH4BDsGPy8pCcDpkjbHVds5Z9DZTOqcfq5KcminMjZq5tqvkaifte47" +
+				"apJRPGtsgAgCMg20qiBkQRZV/l+rMFcbYaPmlsozaqJGJ32e+Nim6Y+Hsc8c/Nyn3yc6iu398+33i+kwifWqaKqYCRYaKmRCKQOr" +
+				"D0PBMIoFvbN1",
+		},
+		{
+			// The salt has a leading zero nibble, so it's padded back to 16 bytes
+			name:         "salt with a leading zero",
+			salt:         "0f2f5e0c9b1a4f3e7d6c5b4a39281706",
+			expectedSalt: "Dy9eDJsaTz59bFtKOSgXBg==",
+			expectedVerifier: "Pt8bZKvNPD34t/A5F1GyU3cccQnRinDmSvm+5ltdeIMjRV+vvlW2WaIAii+Cyg4BTsLrBquaZ63YWqiAZVVXtWb9To3jj5rSHJwE" +
+				"Aq6+K9UMJOblM33wG8lrNxGww23fj1TXM4ayVXpI5ac3ONYiLNaHbbO0UDIM8nFPbszlNrvhEdGDiCb6P20F8FyoJwhXdpqc550R" +
+				"dvi0zV1PeGOfG6JfolyJIBVoybU/5M70Krdt3SmCStPMFPwpMIXxm+AoDM3hWaLhxVXXvgU1+DTQphnI3STir+XEJvGE21toZr74" +
+				"z2l/5X1WYRh6SOZFc2MCTUaeR2aND3M+SmG7tsr1kPEvuEkdZjLV3XVyIfKf4+HWuaeGO0zusG/DOCHBp0mTleqhD2Pi1y2J29cF" +
+				"Irat5Nl5f1RE1gvkrEbebt+9x83KRk8NxywhnLjFMHNEUaGkjaIrDh/2HjfrPFRDje6voo5VqEEKg0n7O1ACar1Ds+YF1Q2y/0Bd" +
+				"v7/ytc9xMfWr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dv, err := newDeviceVerifier(testDeviceKey, testDeviceGroupKey, testDevicePassword, mustHexToBig(tt.salt))
+			if err != nil {
+				t.Fatalf("newDeviceVerifier errored: %s", err)
+			}
+
+			if dv.Password != testDevicePassword {
+				t.Errorf("actual password: %s, did not match expected password: %s", dv.Password, testDevicePassword)
+			}
+			if dv.Salt != tt.expectedSalt {
+				t.Errorf("actual salt: %s, did not match expected salt: %s", dv.Salt, tt.expectedSalt)
+			}
+			if dv.PasswordVerifier != tt.expectedVerifier {
+				t.Errorf("actual verifier: %s, did not match expected verifier: %s", dv.PasswordVerifier, tt.expectedVerifier)
+			}
+		})
+	}
+}
+
+func Test_DevicePasswordVerifierChallenge_KnownAnswer(t *testing.T) {
+	csrp, err := NewDeviceSRP(testDeviceKey, testDeviceGroupKey, testDevicePassword, "123abd", WithRandom(fixedRandom(mustHexToBig(testSmallA))))
+	if err != nil {
+		t.Fatalf("NewDeviceSRP errored: %s", err)
+	}
+
+	expectedA := "322d2dc4607a9be18f42a060afad385d60e303b0beb955e8225313709c81e61f3f777018c59139ea4d511c2d288e2e275014" +
+		"bf19f226d916cbca91f1f666a17fc85bd3b8dfcb02c1884f0194448b3247395adcdc2451c5216ea5e6ec58149b94055a737a" +
+		"b600f49e2fb2011f31992303830939622744f9b69d4cbb16a6486a8133c142224805dd2f2756ccdd29b5cde0c87d531d7be6" +
+		"ff72484ef11e23a6cfebbda240c15596e17c2ba8cdd2ffb8611041ef0e4c63d583ad4d891038e4ff7455e387d6b619f77e93" +
+		"b35005f9d5ad284b941f5101a0b0b2a75e0770df55d0ab624bb3267da1d97c6b0945c91ea0d95c66d1515092c33dc418a3a2" +
+		"a6ad0913ef6857a1dc3a7de572027861dafeb952445faa7ad4dfd5fbdafc0c536543ab529dff553c7779bcbf27a0352cbb55" +
+		"17382a443939981399a605eebc27d7dd58b91c783c92af607ab72811ed0925df6d5f98d40fcdb05944b4efe28cc7517872c9" +
+		"4b6a36495a1399ecbdb2ce3e0e3bfcbc2757da25e22e59b539ff8abac18db86233f6"
+	if a := *csrp.DeviceSRPAuthChallenge("internal-username")["SRP_A"]; a != expectedA {
+		t.Errorf("actual SRP_A: %s, did not match expected SRP_A: %s", a, expectedA)
+	}
+
+	challengeParms := map[string]*string{
+		"SALT": pointy.String(testDeviceSalt),
+		"SRP_B": pointy.String("6880a05b1f716053a2f1ecf07b1ede44e086f829f7ba28d2e9e186113818c4438f6fe6c4189fce26de2f9c5fbe2609d5178e" +
+			"769ac03a33cf895a6a3f3e527bb986c667a419797a0575033f3b2a855af35a17d51f59c4e7ca2de728383ac7c60192a4f562" +
+			"03f6cb932a13f268663e52d4b7245ed4e346067f0c78702c3db76c761255fa26b558263b0d4def36446c106759a9da6a424a" +
+			"1239c3d23d99a0581ee854fbeab01395bcf9e0c7d9d9d089c156f6fb62772f136c18fd91c828a44154e6138204f6fc43243c" +
+			"238211d305cb76d77b2aefc18497c2dd882c9802d7068a8ccd93570ff3eb2c4d924e10057d65958df0068677a71aa22093ce" +
+			"e03b9259baec6e4311ec24b2f8cd0ffe0622df699906c325fed2190602d28a0e96ec230d2a7a7c0d171f9089d81e24b1bc9c" +
+			"1e24512277c7e15abb370af8d123d4ad8d4950f720a75bec9eb93cf0b6ddc9b0ed1ed13329d900fbcc42508c7417030a35f3" +
+			"208adb96953e778986a7085d7db92bd0540988f8955a9ad4517e3e6d3d2d9829b5f6"),
+		"SECRET_BLOCK": pointy.String(base64.StdEncoding.EncodeToString([]byte("a-secret-block-from-cognito"))),
+	}
+
+	// 13:01:05 checks the TIMESTAMP uses the 24-hour clock, as Cognito expects
+	resp, err := csrp.DevicePasswordVerifierChallenge("internal-username", challengeParms, time.Date(2018, 7, 10, 13, 1, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("DevicePasswordVerifierChallenge errored: %s", err)
+	}
+
+	if *resp["TIMESTAMP"] != "Tue Jul 10 13:01:05 UTC 2018" {
+		t.Errorf("actual TIMESTAMP: %s, did not match expected TIMESTAMP: %s", *resp["TIMESTAMP"], "Tue Jul 10 13:01:05 UTC 2018")
+	}
+	if *resp["PASSWORD_CLAIM_SIGNATURE"] != "Fl0yW2PYCIerREJ9pa5eiZaEYiVhU0U9YDU5rIp6RKM=" {
+		t.Errorf("actual PASSWORD_CLAIM_SIGNATURE: %s, did not match expected PASSWORD_CLAIM_SIGNATURE: %s", *resp["PASSWORD_CLAIM_SIGNATURE"], "Fl0yW2PYCIerREJ9pa5eiZaEYiVhU0U9YDU5rIp6RKM=")
+	}
+}
+
+func Test_DeviceSRPRoundTrip(t *testing.T) {
+	dv, err := NewDeviceVerifier(testDeviceKey, testDeviceGroupKey)
+	if err != nil {
+		t.Fatalf("NewDeviceVerifier errored: %s", err)
+	}
+
+	salt, _ := base64.StdEncoding.DecodeString(dv.Salt)
+	verifier, _ := base64.StdEncoding.DecodeString(dv.PasswordVerifier)
+	v := big.NewInt(0).SetBytes(verifier)
+
+	csrp, err := NewDeviceSRP(testDeviceKey, testDeviceGroupKey, dv.Password, "123abd")
+	if err != nil {
+		t.Fatalf("NewDeviceSRP errored: %s", err)
+	}
+
+	// Act as Cognito, which only knows the verifier: B = kv + g^b, S = (Av^u)^b
+	var (
+		bigN = mustHexToBig(nHex)
+		b, _ = getRandom(rand.Reader, 128)
+		bigB = big.NewInt(0).Add(big.NewInt(0).Mul(csrp.k, v), big.NewInt(0).Exp(csrp.g, b, bigN))
+	)
+	bigB.Mod(bigB, bigN)
+
+	u := calculateU(csrp.bigA, bigB)
+	s := big.NewInt(0).Exp(big.NewInt(0).Mul(csrp.bigA, big.NewInt(0).Exp(v, u, bigN)), b, bigN)
+	serverKey := computeHKDF(padHex(s.Text(16)), padHex(u.Text(16)))
+
+	clientKey, err := csrp.getPasswordAuthenticationKey(csrp.username, csrp.password, bigB, big.NewInt(0).SetBytes(salt))
+	if err != nil {
+		t.Fatalf("getPasswordAuthenticationKey errored: %s", err)
+	}
+
+	if !bytes.Equal(clientKey, serverKey) {
+		t.Errorf("client key: %x, did not match the key derived from the verifier: %x", clientKey, serverKey)
+	}
+}
+
+func Test_NewDeviceVerifier_WithRandom(t *testing.T) {
+	password := bytes.Repeat([]byte{1}, devicePasswordLength)
+	salt, _ := hex.DecodeString(testDeviceSalt)
+
+	dv, err := NewDeviceVerifier(testDeviceKey, testDeviceGroupKey, WithRandom(bytes.NewReader(append(password, salt...))))
+	if err != nil {
+		t.Fatalf("NewDeviceVerifier errored: %s", err)
+	}
+
+	expected, _ := newDeviceVerifier(testDeviceKey, testDeviceGroupKey, base64.StdEncoding.EncodeToString(password), mustHexToBig(testDeviceSalt))
+	if dv != expected {
+		t.Errorf("actual verifier: %+v, did not match expected verifier: %+v", dv, expected)
+	}
+
+	if _, err := NewDeviceVerifier(testDeviceKey, testDeviceGroupKey, WithRandom(bytes.NewReader(password))); err == nil {
+		t.Error("NewDeviceVerifier should error when there's not enough randomness for the salt")
+	}
+}
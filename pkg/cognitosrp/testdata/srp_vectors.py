@@ -0,0 +1,116 @@
+# Generates the known answer vectors in cognitosrp_test.go and device_test.go.
+#
+# Each function is a transcription of its counterpart in amazon-cognito-identity-js
+# (https://github.com/aws/amazon-cognito-identity-js/blob/master/src):
+#
+#   pad_hex          AuthenticationHelper.padHex
+#   k                AuthenticationHelper constructor, hexHash(padHex(N) + padHex(g))
+#   hkdf             AuthenticationHelper.computehkdf, with the "Caldera Derived Key" info
+#   auth_key         AuthenticationHelper.getPasswordAuthenticationKey
+#   hash_device      AuthenticationHelper.generateHashDevice, given the salt instead of
+#                    generating it, which CognitoUser.confirmDevice then base64 encodes
+#   claim            the PASSWORD_CLAIM_SIGNATURE HMAC of CognitoUser.authenticateUserInternal
+#                    and CognitoUser.getDeviceResponse
+#
+# Cognito's side of the exchange, B = kv + g^b, is played with a fixed b so that the
+# vectors don't depend on Cognito. Run with python3 and no arguments.
+
+import base64
+import hashlib
+import hmac
+
+N = int(
+    "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD"
+    "EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"
+    "EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"
+    "83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"
+    "E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510"
+    "15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7"
+    "ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864D87602733EC86A64521F2B18177B200C"
+    "BBE117577A615D6C770988C0BAD946E208E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF",
+    16,
+)
+g = 2
+
+
+def pad_hex(i):
+    h = format(i, "x")
+    if len(h) % 2:
+        h = "0" + h
+    if h[0] in "89abcdef":
+        h = "00" + h
+    return h
+
+
+def hash_str(s):
+    return hashlib.sha256(s.encode()).hexdigest()
+
+
+def hex_hash(h):
+    return hashlib.sha256(bytes.fromhex(h)).hexdigest()
+
+
+k = int(hex_hash(pad_hex(N) + pad_hex(g)), 16)
+
+
+def hkdf(ikm, salt):
+    prk = hmac.new(salt, ikm, hashlib.sha256).digest()
+    return hmac.new(prk, b"Caldera Derived Key\x01", hashlib.sha256).digest()[:16]
+
+
+def x_for(pool, user, password, salt):
+    return int(hex_hash(pad_hex(salt) + hash_str(pool + user + ":" + password)), 16)
+
+
+def auth_key(pool, user, password, a, B, salt):
+    A = pow(g, a, N)
+    u = int(hex_hash(pad_hex(A) + pad_hex(B)), 16)
+    x = x_for(pool, user, password, salt)
+    S = pow((B - k * pow(g, x, N)) % N, a + u * x, N)
+    return hkdf(bytes.fromhex(pad_hex(S)), bytes.fromhex(pad_hex(u)))
+
+
+def hash_device(group, device, password, salt):
+    v = pow(g, x_for(group, device, password, salt), N)
+    return (
+        base64.b64encode(bytes.fromhex(pad_hex(salt))).decode(),
+        base64.b64encode(bytes.fromhex(pad_hex(v))).decode(),
+    )
+
+
+def claim(pool, user, password, a, B, salt, secret_block, timestamp):
+    key = auth_key(pool, user, password, a, B, salt)
+    msg = pool.encode() + user.encode() + secret_block + timestamp.encode()
+    return base64.b64encode(hmac.new(key, msg, hashlib.sha256).digest()).decode()
+
+
+def server_B(pool, user, password, salt, b):
+    return (k * pow(g, x_for(pool, user, password, salt), N) + pow(g, b, N)) % N
+
+
+a = int("5a5f1e6b3c2d4e5f60718293a4b5c6d7e8f90112233445566778899aabbccddeeff00112233445566778899aabbccdd", 16)
+b = int("9f8e7d6c5b4a39281706f5e4d3c2b1a0", 16)
+secret_block = b"a-secret-block-from-cognito"
+timestamp = "Tue Jul 10 13:01:05 UTC 2018"
+
+print("SRP_A", format(pow(g, a, N), "x"))
+
+# Test_PasswordVerifierChallenge_KnownAnswer
+pool, user, password = "myPool", "5d9c8a7b-6e5f-4a3b-9c2d-1e0f9a8b7c6d", "Passw0rd!"
+salt = int("3c9d2f1e0a8b7c6d5e4f3a2b1c0d9e8f", 16)
+B = server_B(pool, user, password, salt, b)
+print("password SRP_B", format(B, "x"))
+print("password PASSWORD_CLAIM_SIGNATURE", claim(pool, user, password, a, B, salt, secret_block, timestamp))
+
+# Test_newDeviceVerifier and Test_DevicePasswordVerifierChallenge_KnownAnswer
+group = "-a1b2c3d4e"
+device = "eu-west-1_0d5c4e3f-1a2b-4c3d-9e8f-7a6b5c4d3e2f"
+password = "2GgC5Dx6QRWBnWJ4UrK0k7vxAY3M9PcVpZ1jXqH8eLtaNfs5bOyTwmIo"
+
+for s in ("8d2f5e0c9b1a4f3e7d6c5b4a39281706", "0f2f5e0c9b1a4f3e7d6c5b4a39281706"):
+    print("device verifier", s, *hash_device(group, device, password, int(s, 16)))
+
+salt = int("8d2f5e0c9b1a4f3e7d6c5b4a39281706", 16)
+B = server_B(group, device, password, salt, b)
+print("device SRP_B", format(B, "x"))
+print("device PASSWORD_CLAIM_SIGNATURE", claim(group, device, password, a, B, salt, secret_block, timestamp))
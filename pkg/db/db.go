@@ -6,6 +6,9 @@ import (
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+
+	"github.com/simondrake/home-stats/pkg/logger"
 )
 
 type Config struct {
@@ -17,9 +20,13 @@ type Config struct {
 	Password string
 	// Database is the database name
 	Database string
+	// Logger logs each write and query at debug level, unless the context
+	// carries a logger. Nothing is logged if both are nil
+	Logger *logger.Logger
 }
 
 type DB struct {
+	client influxdb2.Client
 	Config
 }
 
@@ -30,19 +37,102 @@ type WriteRequest struct {
 	Timestamp   time.Time
 }
 
+// Point is a single value returned by Query
+type Point struct {
+	Time  time.Time
+	Value interface{}
+}
+
+// New takes a Config object and returns a pointer to a DB object.
+// Close should be called once the DB is no longer needed
 func New(c Config) *DB {
 	return &DB{
+		client: influxdb2.NewClient(c.URI, fmt.Sprintf("%s:%s", c.Username, c.Password)),
 		Config: c,
 	}
 }
 
 func (d *DB) Write(ctx context.Context, wr WriteRequest) error {
-	c := influxdb2.NewClient(d.URI, fmt.Sprintf("%s:%s", d.Username, d.Password))
-	defer c.Close()
-
-	writeAPI := c.WriteAPIBlocking("", d.Database)
+	writeAPI := d.client.WriteAPIBlocking("", d.Database)
 
 	p := influxdb2.NewPoint(wr.Measurement, wr.Tags, wr.Fields, wr.Timestamp)
 
-	return writeAPI.WritePoint(ctx, p)
+	start := time.Now()
+	err := writeAPI.WritePoint(ctx, p)
+
+	d.logRequest(ctx, "Database write", wr.Measurement, start, err)
+
+	return err
+}
+
+// Query returns the values of field in measurement recorded between from and to, oldest first
+func (d *DB) Query(ctx context.Context, measurement, field string, from, to time.Time) ([]Point, error) {
+	q := fmt.Sprintf(`from(bucket: %q)
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => r._measurement == %q and r._field == %q)
+  |> sort(columns: ["_time"])`,
+		d.Database, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), measurement, field)
+
+	start := time.Now()
+	res, err := d.client.QueryAPI("").Query(ctx, q)
+
+	d.logRequest(ctx, "Database query", measurement, start, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s: %w", measurement, err)
+	}
+
+	defer res.Close()
+
+	var ps []Point
+
+	for res.Next() {
+		ps = append(ps, Point{Time: res.Record().Time(), Value: res.Record().Value()})
+	}
+
+	if res.Err() != nil {
+		return nil, fmt.Errorf("error reading %s results: %w", measurement, res.Err())
+	}
+
+	return ps, nil
+}
+
+// Ping checks that the database is reachable and reports itself as healthy
+func (d *DB) Ping(ctx context.Context) error {
+	h, err := d.client.Health(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking database health: %w", err)
+	}
+
+	if h.Status != domain.HealthCheckStatusPass {
+		msg := ""
+		if h.Message != nil {
+			msg = *h.Message
+		}
+
+		return fmt.Errorf("database is unhealthy: %s", msg)
+	}
+
+	return nil
+}
+
+// logRequest logs a request to the database at debug level with a request ID
+func (d *DB) logRequest(ctx context.Context, msg, measurement string, start time.Time, err error) {
+	l := logger.FromContext(ctx, d.Logger).With(
+		"requestID", logger.NewRequestID(),
+		"measurement", measurement,
+		"duration", time.Since(start),
+	)
+
+	if err != nil {
+		l.Debug(msg+" failed", "err", err)
+		return
+	}
+
+	l.Debug(msg)
+}
+
+// Close flushes any buffered points and releases the resources held by the client
+func (d *DB) Close() {
+	d.client.Close()
 }
@@ -0,0 +1,107 @@
+package energy
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimestampColumn and DefaultConsumptionColumn match the
+	// consumption exports of most UK suppliers
+	DefaultTimestampColumn   = "Start"
+	DefaultConsumptionColumn = "Consumption (kWh)"
+)
+
+// CSVOptions describes the layout of a supplier consumption export
+type CSVOptions struct {
+	Fuel Fuel
+	// TimestampColumn is the header of the column holding the start of each period
+	TimestampColumn string
+	// ConsumptionColumn is the header of the column holding the energy used in each period
+	ConsumptionColumn string
+	// TimestampFormat is the layout of the timestamps, as understood by time.Parse.
+	// Defaults to time.RFC3339
+	TimestampFormat string
+}
+
+// Consumption is the energy used during a single period of a consumption export
+type Consumption struct {
+	Fuel  Fuel
+	Start time.Time
+	// Consumption is the energy used, in kWh
+	Consumption float64
+}
+
+// ReadCSV reads a supplier consumption export, which must have a header row
+func ReadCSV(r io.Reader, o CSVOptions) ([]Consumption, error) {
+	if o.TimestampColumn == "" {
+		o.TimestampColumn = DefaultTimestampColumn
+	}
+
+	if o.ConsumptionColumn == "" {
+		o.ConsumptionColumn = DefaultConsumptionColumn
+	}
+
+	if o.TimestampFormat == "" {
+		o.TimestampFormat = time.RFC3339
+	}
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	tsIdx, cIdx := -1, -1
+
+	for i, h := range header {
+		switch strings.TrimSpace(h) {
+		case o.TimestampColumn:
+			tsIdx = i
+		case o.ConsumptionColumn:
+			cIdx = i
+		}
+	}
+
+	if tsIdx == -1 {
+		return nil, fmt.Errorf("column %q not found", o.TimestampColumn)
+	}
+
+	if cIdx == -1 {
+		return nil, fmt.Errorf("column %q not found", o.ConsumptionColumn)
+	}
+
+	var cs []Consumption
+
+	// line is the line number of the record being parsed, the header is line 1
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+
+		start, err := time.Parse(o.TimestampFormat, record[tsIdx])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse timestamp on line %d: %w", line, err)
+		}
+
+		c, err := strconv.ParseFloat(record[cIdx], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse consumption on line %d: %w", line, err)
+		}
+
+		cs = append(cs, Consumption{Fuel: o.Fuel, Start: start, Consumption: c})
+	}
+
+	return cs, nil
+}
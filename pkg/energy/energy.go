@@ -0,0 +1,176 @@
+package energy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+const (
+	// DefaultTimeout is the maximum duration of a single request
+	// to the meter bridge when Config.Timeout isn't set
+	DefaultTimeout = 30 * time.Second
+)
+
+// Fuel is the type of energy measured by a meter
+type Fuel string
+
+const (
+	Electricity Fuel = "electricity"
+	Gas         Fuel = "gas"
+)
+
+type Config struct {
+	// URL of the smart meter bridge, which returns the latest
+	// meter readings as Glow-style JSON
+	URL string
+	// Timeout is the maximum duration of a single request to the bridge
+	Timeout time.Duration
+}
+
+// Meter reads the latest meter readings from a smart meter bridge
+type Meter struct {
+	httpClient httpClient
+	Config
+}
+
+func New(c Config, client httpClient) *Meter {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Meter{
+		httpClient: client,
+		Config:     c,
+	}
+}
+
+// httpClient implements the Do method, which is the exact
+// API of the http.Client's DO function. This helps with testing.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// MeterReading is the latest reading from a single meter
+type MeterReading struct {
+	Fuel      Fuel
+	Timestamp time.Time
+	// Cumulative is the total energy imported, in kWh
+	Cumulative float64
+	// Day is the energy imported today, in kWh
+	Day float64
+	// Power is the current demand, in kW
+	Power float64
+}
+
+// bridgeResponse is the JSON returned by the bridge. Either meter may be missing
+type bridgeResponse struct {
+	ElectricityMeter *meter `json:"electricitymeter,omitempty"`
+	GasMeter         *meter `json:"gasmeter,omitempty"`
+}
+
+type meter struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Energy    struct {
+		Import struct {
+			Cumulative float64 `json:"cumulative,omitempty"`
+			Day        float64 `json:"day,omitempty"`
+			Units      string  `json:"units,omitempty"`
+		} `json:"import,omitempty"`
+	} `json:"energy,omitempty"`
+	Power struct {
+		Value float64 `json:"value,omitempty"`
+		Units string  `json:"units,omitempty"`
+	} `json:"power,omitempty"`
+}
+
+// GetMeterReadings gets the latest readings for every meter reported by the bridge
+func (m *Meter) GetMeterReadings() ([]MeterReading, error) {
+	return m.GetMeterReadingsWithContext(context.Background())
+}
+
+// GetMeterReadingsWithContext is the same as GetMeterReadings, with the
+// addition of a context which is used for the request
+func (m *Meter) GetMeterReadingsWithContext(ctx context.Context) ([]MeterReading, error) {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	res, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting meter readings: %w", logger.RedactError(err))
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	var br bridgeResponse
+	if err := json.NewDecoder(res.Body).Decode(&br); err != nil {
+		return nil, fmt.Errorf("error decoding meter readings: %w", err)
+	}
+
+	var mrs []MeterReading
+
+	for _, mr := range []struct {
+		fuel  Fuel
+		meter *meter
+	}{
+		{Electricity, br.ElectricityMeter},
+		{Gas, br.GasMeter},
+	} {
+		if mr.meter == nil {
+			continue
+		}
+
+		r, err := mr.meter.reading(mr.fuel)
+		if err != nil {
+			return nil, err
+		}
+
+		mrs = append(mrs, r)
+	}
+
+	return mrs, nil
+}
+
+func (m *meter) reading(f Fuel) (MeterReading, error) {
+	r := MeterReading{
+		Fuel:       f,
+		Timestamp:  time.Now(),
+		Cumulative: m.Energy.Import.Cumulative,
+		Day:        m.Energy.Import.Day,
+		Power:      m.Power.Value,
+	}
+
+	if m.Timestamp != "" {
+		t, err := time.Parse(time.RFC3339, m.Timestamp)
+		if err != nil {
+			return r, fmt.Errorf("unable to parse %s timestamp: %w", f, err)
+		}
+
+		r.Timestamp = t
+	}
+
+	// Some bridges report power in watts
+	if m.Power.Units == "W" {
+		r.Power /= 1000
+	}
+
+	return r, nil
+}
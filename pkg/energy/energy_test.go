@@ -0,0 +1,138 @@
+package energy_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/energy"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockClient struct {
+	body   string
+	status int
+	err    error
+}
+
+func (m *mockClient) Do(req *http.Request) (*http.Response, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	status := m.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(m.body))),
+	}, nil
+}
+
+const bridgeJSON = `{
+  "electricitymeter": {
+    "timestamp": "2021-01-10T18:30:00Z",
+    "energy": {"import": {"cumulative": 12345.678, "day": 7.5, "units": "kWh"}},
+    "power": {"value": 0.45, "units": "kW"}
+  },
+  "gasmeter": {
+    "timestamp": "2021-01-10T18:30:00Z",
+    "energy": {"import": {"cumulative": 54321.5, "day": 40.25, "units": "kWh"}},
+    "power": {"value": 1500, "units": "W"}
+  }
+}`
+
+func TestGetMeterReadings(t *testing.T) {
+	ts := time.Date(2021, 1, 10, 18, 30, 0, 0, time.UTC)
+
+	t.Run("should return electricity and gas readings", func(t *testing.T) {
+		a := assert.New(t)
+		m := energy.New(energy.Config{URL: "http://bridge.local"}, &mockClient{body: bridgeJSON})
+
+		mrs, err := m.GetMeterReadings()
+
+		a.NoError(err)
+		a.Equal([]energy.MeterReading{
+			{Fuel: energy.Electricity, Timestamp: ts, Cumulative: 12345.678, Day: 7.5, Power: 0.45},
+			{Fuel: energy.Gas, Timestamp: ts, Cumulative: 54321.5, Day: 40.25, Power: 1.5},
+		}, mrs)
+	})
+
+	t.Run("should skip meters missing from the response", func(t *testing.T) {
+		m := energy.New(energy.Config{URL: "http://bridge.local"}, &mockClient{body: `{"gasmeter": {"energy": {"import": {"cumulative": 1}}}}`})
+
+		mrs, err := m.GetMeterReadings()
+
+		assert.NoError(t, err)
+		assert.Len(t, mrs, 1)
+		assert.Equal(t, energy.Gas, mrs[0].Fuel)
+	})
+
+	t.Run("should return an error for an unsuccessful status code", func(t *testing.T) {
+		m := energy.New(energy.Config{URL: "http://bridge.local"}, &mockClient{status: http.StatusBadGateway})
+
+		_, err := m.GetMeterReadings()
+
+		assert.EqualError(t, err, "unexpected status code: 502")
+	})
+
+	t.Run("should return an error when the request fails", func(t *testing.T) {
+		m := energy.New(energy.Config{URL: "http://bridge.local"}, &mockClient{err: errors.New("something went wrong")})
+
+		_, err := m.GetMeterReadingsWithContext(context.Background())
+
+		assert.EqualError(t, err, "error requesting meter readings: something went wrong")
+	})
+}
+
+const octopusCSV = `Consumption (kWh), Start, End
+0.245, 2021-01-09T00:00:00+00:00, 2021-01-09T00:30:00+00:00
+0.5, 2021-01-09T00:30:00+00:00, 2021-01-09T01:00:00+00:00
+`
+
+func TestReadCSV(t *testing.T) {
+	t.Run("should read a supplier export", func(t *testing.T) {
+		a := assert.New(t)
+
+		cs, err := energy.ReadCSV(bytes.NewBufferString(octopusCSV), energy.CSVOptions{Fuel: energy.Gas})
+
+		a.NoError(err)
+		a.Len(cs, 2)
+		a.Equal(energy.Gas, cs[0].Fuel)
+		a.True(time.Date(2021, 1, 9, 0, 30, 0, 0, time.UTC).Equal(cs[1].Start))
+		a.Equal(0.5, cs[1].Consumption)
+	})
+
+	t.Run("should use the configured columns and timestamp format", func(t *testing.T) {
+		a := assert.New(t)
+		csv := "Date,Usage\n09/01/2021 00:00,1.25\n"
+
+		cs, err := energy.ReadCSV(bytes.NewBufferString(csv), energy.CSVOptions{
+			Fuel:              energy.Electricity,
+			TimestampColumn:   "Date",
+			ConsumptionColumn: "Usage",
+			TimestampFormat:   "02/01/2006 15:04",
+		})
+
+		a.NoError(err)
+		a.Equal([]energy.Consumption{{Fuel: energy.Electricity, Start: time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), Consumption: 1.25}}, cs)
+	})
+
+	t.Run("should return an error for a missing column", func(t *testing.T) {
+		_, err := energy.ReadCSV(bytes.NewBufferString("Start,End\n"), energy.CSVOptions{})
+
+		assert.EqualError(t, err, `column "Consumption (kWh)" not found`)
+	})
+
+	t.Run("should return an error for an invalid value", func(t *testing.T) {
+		_, err := energy.ReadCSV(bytes.NewBufferString("Consumption (kWh),Start\nnope,2021-01-09T00:00:00Z\n"), energy.CSVOptions{})
+
+		assert.EqualError(t, err, `unable to parse consumption on line 2: strconv.ParseFloat: parsing "nope": invalid syntax`)
+	})
+}
@@ -2,36 +2,108 @@ package hive
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/openlyinc/pointy"
 
 	"github.com/simondrake/home-stats/pkg/cognitosrp"
+	"github.com/simondrake/home-stats/pkg/logger"
 )
 
 const (
 	authEndpoint = "https://cognito-idp.eu-west-1.amazonaws.com"
 	nodeEndpoint = "https://api.prod.bgchprod.info/omnia/nodes/"
+
+	// DefaultTimeout is the maximum duration of a single request
+	// to Hive when Config.Timeout isn't set
+	DefaultTimeout = 30 * time.Second
 )
 
 type Config struct {
 	token                    string
+	tokenExpiry              time.Time
 	Username                 string `json:"username,omitempty"`
 	Password                 string `json:"password,omitempty"`
 	SSOPoolID                string `json:"ssoPoolID,omitempty"`
 	SSOPublicCognitoClientID string `json:"ssoPublicCognitoClientID,omitempty"`
+	// RefreshToken, when set, is used to generate a token without the password.
+	// The password is only used if the refresh token has expired or been revoked.
+	// It's replaced by the refresh token returned when logging in with the password
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// Device is the device remembered by Cognito, which lets the password be
+	// used without an MFA code. It's replaced if a new device is remembered
+	Device Device `json:"device,omitempty"`
+	// MFACode is called for the code when logging in requires MFA. Logging
+	// in fails with ErrMFARequired if it's nil
+	MFACode MFACodeFunc `json:"-"`
+	// OnCredentials, if set, is called with the refresh token and device
+	// after logging in with the password, so that they can be stored
+	OnCredentials func(refreshToken string, device Device) error `json:"-"`
+	// AuthEndpoint is the Cognito endpoint used to generate a token, which
+	// defaults to the endpoint Hive uses
+	AuthEndpoint string `json:"authEndpoint,omitempty"`
+	// Timeout is the maximum duration of a single request to Hive
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Logger logs each request at debug level, unless the request's context
+	// carries a logger. Nothing is logged if both are nil
+	Logger *logger.Logger `json:"-"`
+}
+
+// Device is a device remembered by Cognito, along with the password it was
+// confirmed with
+type Device struct {
+	Key      string `json:"key,omitempty"`
+	GroupKey string `json:"groupKey,omitempty"`
+	Password string `json:"password,omitempty"`
 }
 
+// MFA challenges that can be answered with an MFACodeFunc
+const (
+	ChallengeSMSMFA           = "SMS_MFA"
+	ChallengeSoftwareTokenMFA = "SOFTWARE_TOKEN_MFA"
+)
+
+// MFACodeFunc returns the code for an MFA challenge. For ChallengeSMSMFA,
+// destination is the masked phone number the code was sent to. It returns
+// ErrMFACodePending if the code isn't available yet
+type MFACodeFunc func(ctx context.Context, challenge, destination string) (string, error)
+
+var (
+	// ErrMFARequired is returned when logging in requires an MFA code and there's no MFACodeFunc
+	ErrMFARequired = errors.New("an MFA code is required to log in to Hive")
+	// ErrMFACodePending is returned by an MFACodeFunc that doesn't have the code yet.
+	// Logging in fails, but the challenge is kept so that the next login answers
+	// it, rather than having Cognito send another code
+	ErrMFACodePending = errors.New("MFA code required")
+)
+
+// maxChallenges limits the number of challenges answered while logging in
+const maxChallenges = 5
+
+// mfaSessionTimeout is how long Cognito waits for an MFA challenge to be answered
+const mfaSessionTimeout = 3 * time.Minute
+
 type Hive struct {
 	httpClient httpClient
 	Config
+
+	// mfa is the MFA challenge that is waiting for its code, if any
+	mfa *mfaChallenge
+}
+
+// mfaChallenge is an MFA challenge kept after MFACode returned ErrMFACodePending
+type mfaChallenge struct {
+	out      *cognitosrp.AuthOutput
+	username string
+	issued   time.Time
 }
 
 type Nodes struct {
@@ -57,6 +129,7 @@ type Attribute struct {
 	ActiveHeatCoolMode    Report `json:"activeHeatCoolMode,omitempty"`
 	ScheduleLockDuration  Report `json:"scheduleLockDuration,omitempty"`
 	TargetHeatTemperature Report `json:"targetHeatTemperature,omitempty"`
+	StateHeatingRelay     Report `json:"stateHeatingRelay,omitempty"`
 }
 
 type Report struct {
@@ -86,60 +159,358 @@ type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// GenerateToken generates a token, using the username/password used when calling New
-// and stores it in an unexported field in the Hive struct
+// GenerateToken generates a token, using the refresh token or username/password
+// used when calling New, and stores it in an unexported field in the Hive struct
 func (h *Hive) GenerateToken() error {
-	csrp, err := cognitosrp.NewCognitoSRP(h.Username, h.Password, h.SSOPoolID, h.SSOPublicCognitoClientID, nil)
+	return h.GenerateTokenWithContext(context.Background())
+}
+
+// GenerateTokenWithContext is the same as GenerateToken, with the addition
+// of a context which is used for every request made to Cognito
+func (h *Hive) GenerateTokenWithContext(ctx context.Context) error {
+	endpoint := h.AuthEndpoint
+	if endpoint == "" {
+		endpoint = authEndpoint
+	}
+
+	svc := cognitosrp.NewClient(endpoint, h.httpClient)
+
+	if h.RefreshToken != "" {
+		err := h.refreshToken(ctx, svc)
+		if err == nil || h.Password == "" {
+			return err
+		}
+
+		logger.FromContext(ctx, h.Logger).Warn("Unable to refresh the Hive token, logging in with the password", "err", err)
+	}
+
+	if h.Password == "" {
+		return errors.New("a password or refresh token is required")
+	}
+
+	return h.login(ctx, svc)
+}
+
+// refreshToken generates a token using the refresh token
+func (h *Hive) refreshToken(ctx context.Context, svc *cognitosrp.Client) error {
+	refreshCtx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+
+	// A refresh token issued to a remembered device can only be used with its key
+	result, err := svc.RefreshTokenAuth(refreshCtx, h.SSOPublicCognitoClientID, h.RefreshToken, h.Device.Key)
+
+	h.logCognito(ctx, "InitiateAuth", start, err)
+
 	if err != nil {
-		return fmt.Errorf("error getting new cognito srp: %w", err)
+		return fmt.Errorf("error refreshing token: %w", err)
+	}
+
+	return h.setToken(result)
+}
+
+// login generates a token using the username and password, answering any
+// MFA and device challenges, and remembers the device if Cognito asks it to.
+// An MFA challenge that is waiting for its code is answered instead, until
+// Cognito's session for it expires
+func (h *Hive) login(ctx context.Context, svc *cognitosrp.Client) error {
+	pending := h.mfa
+	h.mfa = nil
+
+	var (
+		out      *cognitosrp.AuthOutput
+		username string
+		issued   time.Time
+		err      error
+	)
+
+	if pending != nil && time.Since(pending.issued) < mfaSessionTimeout {
+		out, username, issued = pending.out, pending.username, pending.issued
+	} else {
+		out, username, err = h.passwordLogin(ctx, svc)
+		if err != nil {
+			return err
+		}
+
+		issued = time.Now()
+	}
+
+	for i := 0; out.ChallengeName != ""; i++ {
+		if i == maxChallenges {
+			return fmt.Errorf("too many challenges returned, the last was %s", out.ChallengeName)
+		}
+
+		name := out.ChallengeName
+
+		switch name {
+		case ChallengeSMSMFA, ChallengeSoftwareTokenMFA:
+			if h.MFACode == nil {
+				return ErrMFARequired
+			}
+
+			code, err := h.MFACode(ctx, name, pointy.StringValue(out.ChallengeParameters["CODE_DELIVERY_DESTINATION"], ""))
+			if errors.Is(err, ErrMFACodePending) {
+				h.mfa = &mfaChallenge{out: out, username: username, issued: issued}
+			}
+
+			if err != nil {
+				return fmt.Errorf("error getting MFA code: %w", err)
+			}
+
+			out, err = h.respond(ctx, svc, name, out.Session, h.withDeviceKey(map[string]*string{
+				"USERNAME":     pointy.String(username),
+				name + "_CODE": pointy.String(code),
+			}))
+			if err != nil {
+				return err
+			}
+		case "DEVICE_SRP_AUTH":
+			if h.Device.Key == "" {
+				return errors.New("device challenge returned without a remembered device")
+			}
+
+			out, err = h.deviceLogin(ctx, svc, username, out.Session)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unhandled challenge returned: %s", name)
+		}
+
+		issued = time.Now()
 	}
 
-	awsSession := session.Must(session.NewSession())
+	if err := h.setToken(out.AuthenticationResult); err != nil {
+		return err
+	}
+
+	if out.AuthenticationResult.NewDeviceMetadata != nil {
+		// The token is valid whether or not the device is remembered
+		if err := h.rememberDevice(ctx, svc, out.AuthenticationResult); err != nil {
+			logger.FromContext(ctx, h.Logger).Warn("Unable to remember the device, MFA will be required to log in again", "err", err)
+		}
+	}
+
+	if h.OnCredentials != nil {
+		if err := h.OnCredentials(h.RefreshToken, h.Device); err != nil {
+			logger.FromContext(ctx, h.Logger).Warn("Unable to store the Hive credentials", "err", err)
+		}
+	}
+
+	return nil
+}
+
+// passwordLogin initiates auth and answers the PASSWORD_VERIFIER challenge,
+// returning the next challenge and the username Cognito uses internally
+func (h *Hive) passwordLogin(ctx context.Context, svc *cognitosrp.Client) (*cognitosrp.AuthOutput, string, error) {
+	csrp, err := cognitosrp.NewCognitoSRP(h.Username, h.Password, h.SSOPoolID, h.SSOPublicCognitoClientID, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting new cognito srp: %w", err)
+	}
 
-	svc := cognitoidentityprovider.New(awsSession, aws.NewConfig().WithEndpoint(authEndpoint).WithRegion("eu-west-1"))
+	params := csrp.GetAuthParams()
+	if h.Device.Key != "" {
+		params["DEVICE_KEY"] = pointy.String(h.Device.Key)
+	}
 
 	// initiate auth
-	rsp, err := svc.InitiateAuth(&cognitoidentityprovider.InitiateAuthInput{
-		AuthFlow:       pointy.String("USER_SRP_AUTH"),
-		ClientId:       aws.String(csrp.GetClientId()),
-		AuthParameters: csrp.GetAuthParams(),
+	initCtx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+
+	rsp, err := svc.InitiateAuth(initCtx, cognitosrp.InitiateAuthInput{
+		AuthFlow:       "USER_SRP_AUTH",
+		ClientId:       csrp.GetClientId(),
+		AuthParameters: params,
 	})
+
+	h.logCognito(ctx, "InitiateAuth", start, err)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("error initiating auth: %w", err)
+	}
+
+	if rsp.ChallengeName == "" {
+		return nil, "", errors.New("empty challenge name")
+	}
+
+	if rsp.ChallengeName != "PASSWORD_VERIFIER" {
+		return nil, "", fmt.Errorf("unhandled challenge returned: %s", rsp.ChallengeName)
+	}
+
+	// Later challenges identify the user by the username Cognito uses internally
+	username := pointy.StringValue(rsp.ChallengeParameters["USER_ID_FOR_SRP"], h.Username)
+
+	challengeResponses, err := csrp.PasswordVerifierChallenge(rsp.ChallengeParameters, time.Now())
+	if err != nil {
+		return nil, "", fmt.Errorf("error answering password challenge: %w", err)
+	}
+
+	out, err := h.respond(ctx, svc, "PASSWORD_VERIFIER", rsp.Session, h.withDeviceKey(challengeResponses))
 	if err != nil {
-		return fmt.Errorf("error initiating auth: %w", err)
+		return nil, "", err
 	}
 
-	if rsp.ChallengeName == nil {
-		return errors.New("empty challenge name")
+	return out, username, nil
+}
+
+// deviceLogin answers the DEVICE_SRP_AUTH and DEVICE_PASSWORD_VERIFIER challenges with the remembered device
+func (h *Hive) deviceLogin(ctx context.Context, svc *cognitosrp.Client, username, session string) (*cognitosrp.AuthOutput, error) {
+	dsrp, err := cognitosrp.NewDeviceSRP(h.Device.Key, h.Device.GroupKey, h.Device.Password, h.SSOPublicCognitoClientID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting new device cognito srp: %w", err)
 	}
 
-	if *rsp.ChallengeName != "PASSWORD_VERIFIER" {
-		return errors.New("unhandled challenge returned")
+	out, err := h.respond(ctx, svc, "DEVICE_SRP_AUTH", session, dsrp.DeviceSRPAuthChallenge(username))
+	if err != nil {
+		return nil, err
 	}
 
-	challengeResponses, _ := csrp.PasswordVerifierChallenge(rsp.ChallengeParameters, time.Now())
+	if out.ChallengeName != "DEVICE_PASSWORD_VERIFIER" {
+		name := out.ChallengeName
+		if name == "" {
+			name = "none"
+		}
 
-	authResponse, err := svc.RespondToAuthChallenge(&cognitoidentityprovider.RespondToAuthChallengeInput{
-		ChallengeName:      pointy.String("PASSWORD_VERIFIER"),
-		ChallengeResponses: challengeResponses,
-		ClientId:           aws.String(csrp.GetClientId()),
+		return nil, fmt.Errorf("unexpected challenge returned: %s", name)
+	}
+
+	challengeResponses, err := dsrp.DevicePasswordVerifierChallenge(username, out.ChallengeParameters, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error answering device challenge: %w", err)
+	}
+
+	return h.respond(ctx, svc, "DEVICE_PASSWORD_VERIFIER", out.Session, challengeResponses)
+}
+
+// rememberDevice confirms the new device returned after logging in, so that
+// it can log in again without MFA
+func (h *Hive) rememberDevice(ctx context.Context, svc *cognitosrp.Client, result *cognitosrp.AuthenticationResult) error {
+	device := Device{
+		Key:      result.NewDeviceMetadata.DeviceKey,
+		GroupKey: result.NewDeviceMetadata.DeviceGroupKey,
+	}
+
+	verifier, err := cognitosrp.NewDeviceVerifier(device.Key, device.GroupKey)
+	if err != nil {
+		return err
+	}
+
+	device.Password = verifier.Password
+
+	confirmCtx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+
+	out, err := svc.ConfirmDevice(confirmCtx, cognitosrp.ConfirmDeviceInput{
+		AccessToken: result.AccessToken,
+		DeviceKey:   device.Key,
+		DeviceName:  "home-stats",
+		DeviceSecretVerifierConfig: cognitosrp.DeviceSecretVerifierConfig{
+			PasswordVerifier: verifier.PasswordVerifier,
+			Salt:             verifier.Salt,
+		},
 	})
+
+	h.logCognito(ctx, "ConfirmDevice", start, err)
+
 	if err != nil {
-		return fmt.Errorf("error responding to auth challenge: %w", err)
+		return fmt.Errorf("error confirming device: %w", err)
 	}
 
-	if authResponse.AuthenticationResult.IdToken == nil {
+	// User pools that let the user choose whether to remember a device need to be told to
+	if out.UserConfirmationNecessary {
+		statusCtx, cancel := h.withTimeout(ctx)
+		defer cancel()
+
+		start := time.Now()
+
+		err := svc.UpdateDeviceStatus(statusCtx, cognitosrp.UpdateDeviceStatusInput{
+			AccessToken:            result.AccessToken,
+			DeviceKey:              device.Key,
+			DeviceRememberedStatus: cognitosrp.DeviceRememberedStatusRemembered,
+		})
+
+		h.logCognito(ctx, "UpdateDeviceStatus", start, err)
+
+		if err != nil {
+			return fmt.Errorf("error remembering device: %w", err)
+		}
+	}
+
+	h.Device = device
+
+	return nil
+}
+
+// respond answers a challenge
+func (h *Hive) respond(ctx context.Context, svc *cognitosrp.Client, challenge, session string, responses map[string]*string) (*cognitosrp.AuthOutput, error) {
+	respondCtx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+
+	out, err := svc.RespondToAuthChallenge(respondCtx, cognitosrp.RespondToAuthChallengeInput{
+		ChallengeName:      challenge,
+		ChallengeResponses: responses,
+		ClientId:           h.SSOPublicCognitoClientID,
+		Session:            session,
+	})
+
+	h.logCognito(ctx, "RespondToAuthChallenge", start, err, "challenge", challenge)
+
+	if err != nil {
+		return nil, fmt.Errorf("error responding to auth challenge: %w", err)
+	}
+
+	return out, nil
+}
+
+// withDeviceKey adds the key of the remembered device, if there is one, to responses
+func (h *Hive) withDeviceKey(responses map[string]*string) map[string]*string {
+	if h.Device.Key != "" {
+		responses["DEVICE_KEY"] = pointy.String(h.Device.Key)
+	}
+
+	return responses
+}
+
+// setToken stores the token from a successful authentication, along with the
+// refresh token if one is returned
+func (h *Hive) setToken(result *cognitosrp.AuthenticationResult) error {
+	if result == nil || result.IdToken == "" {
 		return errors.New("empty id token")
 	}
 
-	h.token = *authResponse.AuthenticationResult.IdToken
+	h.token = result.IdToken
+	h.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+
+	if result.RefreshToken != "" {
+		h.RefreshToken = result.RefreshToken
+	}
 
 	return nil
 }
 
+// TokenExpiry returns the time the current token expires, or the
+// zero time if a token has never been generated
+func (h *Hive) TokenExpiry() time.Time {
+	return h.tokenExpiry
+}
+
 // GetTempForNode accepts a nodeID and gets the temperature for that node
 // If multiple nodes are returned, it works from the zero'th index
 func (h *Hive) GetTempForNode(nodeID string) (float64, error) {
-	nodeInfo, err := h.getNodeInformation(nodeID)
+	return h.GetTempForNodeWithContext(context.Background(), nodeID)
+}
+
+// GetTempForNodeWithContext is the same as GetTempForNode, with the
+// addition of a context which is used for the request
+func (h *Hive) GetTempForNodeWithContext(ctx context.Context, nodeID string) (float64, error) {
+	nodeInfo, err := h.getNodeInformation(ctx, nodeID, "attributes.temperature")
 	if err != nil {
 		return 0.0, fmt.Errorf("error getting node information: %w", err)
 	}
@@ -156,22 +527,140 @@ func (h *Hive) GetTempForNode(nodeID string) (float64, error) {
 	return f, nil
 }
 
+// NodeStatus is the current state of a thermostat node
+type NodeStatus struct {
+	// Temperature is the temperature reported by the thermostat
+	Temperature float64
+	// TargetTemperature is the temperature the heating is trying to reach
+	TargetTemperature float64
+	// Mode is the active heating mode, e.g. SCHEDULE, HEAT, BOOST or OFF
+	Mode string
+	// HeatingOn reports whether the heating relay is on, i.e. the boiler is firing
+	HeatingOn bool
+	// HeatingKnown is set when the node reported its heating relay state,
+	// which not every node does. HeatingOn is false when it isn't
+	HeatingKnown bool
+}
+
+// GetNodeStatus accepts a nodeID and gets the temperature, target, mode and heating relay state for that node
+// If multiple nodes are returned, it works from the zero'th index
+func (h *Hive) GetNodeStatus(nodeID string) (NodeStatus, error) {
+	return h.GetNodeStatusWithContext(context.Background(), nodeID)
+}
+
+// GetNodeStatusWithContext is the same as GetNodeStatus, with the
+// addition of a context which is used for the request
+func (h *Hive) GetNodeStatusWithContext(ctx context.Context, nodeID string) (NodeStatus, error) {
+	var ns NodeStatus
+
+	nodeInfo, err := h.getNodeInformation(ctx, nodeID,
+		"attributes.temperature",
+		"attributes.targetHeatTemperature",
+		"attributes.activeHeatCoolMode",
+		"attributes.stateHeatingRelay",
+	)
+	if err != nil {
+		return ns, fmt.Errorf("error getting node information: %w", err)
+	}
+
+	if len(nodeInfo.Nodes) == 0 {
+		return ns, errors.New("no node information returned")
+	}
+
+	attrs := nodeInfo.Nodes[0].Attributes
+
+	f, ok := attrs.Temperature.ReportedValue.(float64)
+	if !ok {
+		return ns, fmt.Errorf("could not assert reported (%v) value to float64", attrs.Temperature.ReportedValue)
+	}
+
+	ns.Temperature = f
+
+	// The target, mode and relay state are informational, so aren't required
+	relay, ok := attrs.StateHeatingRelay.ReportedValue.(string)
+	ns.HeatingOn, ns.HeatingKnown = relay == "ON", ok
+
+	ns.TargetTemperature, _ = attrs.TargetHeatTemperature.ReportedValue.(float64)
+	ns.Mode, _ = attrs.ActiveHeatCoolMode.ReportedValue.(string)
+
+	return ns, nil
+}
+
+// BoostHeating boosts the heating on nodeID to targetTemperature for targetDuration minutes
 func (h *Hive) BoostHeating(nodeID string, targetDuration int32, targetTemperature int32) error {
-	r := Nodes{
-		Nodes: []Node{
-			{
-				Attributes: Attribute{
-					ActiveHeatCoolMode: Report{
-						TargetValue: "BOOST",
-					},
-					ScheduleLockDuration: Report{
-						TargetValue: targetDuration,
-					},
-					TargetHeatTemperature: Report{
-						TargetValue: targetTemperature,
-					},
-				},
-			},
+	return h.BoostHeatingWithContext(context.Background(), nodeID, targetDuration, targetTemperature)
+}
+
+// BoostHeatingWithContext is the same as BoostHeating, with the
+// addition of a context which is used for the request
+func (h *Hive) BoostHeatingWithContext(ctx context.Context, nodeID string, targetDuration int32, targetTemperature int32) error {
+	return h.putNode(ctx, nodeID, map[string]Report{
+		"activeHeatCoolMode":    {TargetValue: "BOOST"},
+		"scheduleLockDuration":  {TargetValue: targetDuration},
+		"targetHeatTemperature": {TargetValue: targetTemperature},
+	})
+}
+
+// Mode is a heating mode that can be set with SetMode
+type Mode string
+
+const (
+	// ModeSchedule follows the heating schedule
+	ModeSchedule Mode = "schedule"
+	// ModeManual holds the current target temperature
+	ModeManual Mode = "manual"
+	// ModeOff turns the heating off, other than frost protection
+	ModeOff Mode = "off"
+)
+
+// SetMode sets the heating mode of nodeID, which also ends any boost
+func (h *Hive) SetMode(nodeID string, mode Mode) error {
+	return h.SetModeWithContext(context.Background(), nodeID, mode)
+}
+
+// SetModeWithContext is the same as SetMode, with the
+// addition of a context which is used for the request
+func (h *Hive) SetModeWithContext(ctx context.Context, nodeID string, mode Mode) error {
+	var attrs map[string]Report
+
+	switch mode {
+	case ModeSchedule:
+		attrs = map[string]Report{
+			"activeHeatCoolMode": {TargetValue: "HEAT"},
+			"activeScheduleLock": {TargetValue: false},
+		}
+	case ModeManual:
+		attrs = map[string]Report{
+			"activeHeatCoolMode": {TargetValue: "HEAT"},
+			"activeScheduleLock": {TargetValue: true},
+		}
+	case ModeOff:
+		attrs = map[string]Report{
+			"activeHeatCoolMode": {TargetValue: "OFF"},
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", mode)
+	}
+
+	return h.putNode(ctx, nodeID, attrs)
+}
+
+// CancelBoost ends a boost on nodeID, returning it to the heating schedule
+func (h *Hive) CancelBoost(nodeID string) error {
+	return h.CancelBoostWithContext(context.Background(), nodeID)
+}
+
+// CancelBoostWithContext is the same as CancelBoost, with the
+// addition of a context which is used for the request
+func (h *Hive) CancelBoostWithContext(ctx context.Context, nodeID string) error {
+	return h.SetModeWithContext(ctx, nodeID, ModeSchedule)
+}
+
+// putNode updates the target values of attrs on nodeID
+func (h *Hive) putNode(ctx context.Context, nodeID string, attrs map[string]Report) error {
+	r := map[string]interface{}{
+		"nodes": []map[string]interface{}{
+			{"attributes": attrs},
 		},
 	}
 
@@ -180,7 +669,10 @@ func (h *Hive) BoostHeating(nodeID string, targetDuration int32, targetTemperatu
 		return fmt.Errorf("error marshalling req: %w", err)
 	}
 
-	req, err := http.NewRequest("PUT", nodeEndpoint+nodeID, bytes.NewBuffer(b))
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", nodeEndpoint+nodeID, bytes.NewBuffer(b))
 	if err != nil {
 		return fmt.Errorf("error creating request: %w", err)
 	}
@@ -190,23 +682,26 @@ func (h *Hive) BoostHeating(nodeID string, targetDuration int32, targetTemperatu
 	req.Header.Set("X-Omnia-Client", "ESP")
 	req.Header.Set("Authorization", "Bearer "+h.token)
 
-	res, err := h.httpClient.Do(req)
+	res, err := h.do(req)
 	if err != nil {
 		return fmt.Errorf("error making request: %w", err)
 	}
 
 	defer res.Body.Close()
 
-	return nil
+	return checkStatus(res)
 }
 
-// getNodeInformation takes a nodeID and returns the information for that node
-func (h *Hive) getNodeInformation(nodeID string) (Nodes, error) {
+// getNodeInformation takes a nodeID and returns the requested fields for that node
+func (h *Hive) getNodeInformation(ctx context.Context, nodeID string, fields ...string) (Nodes, error) {
 	var nodeInfo Nodes
 
-	endpoint := fmt.Sprintf("%s%s%s", nodeEndpoint, nodeID, "?fields=attributes.temperature")
+	endpoint := fmt.Sprintf("%s%s?fields=%s", nodeEndpoint, nodeID, strings.Join(fields, ","))
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nodeInfo, fmt.Errorf("error creating request: %w", err)
 	}
@@ -216,14 +711,77 @@ func (h *Hive) getNodeInformation(nodeID string) (Nodes, error) {
 	req.Header.Set("X-Omnia-Client", "ESP")
 	req.Header.Set("Authorization", "Bearer "+h.token)
 
-	res, err := h.httpClient.Do(req)
+	res, err := h.do(req)
 	if err != nil {
 		return nodeInfo, fmt.Errorf("error requesting node information: %w", err)
 	}
 
 	defer res.Body.Close()
 
-	json.NewDecoder(res.Body).Decode(&nodeInfo)
+	if err := checkStatus(res); err != nil {
+		return nodeInfo, err
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&nodeInfo); err != nil {
+		return nodeInfo, fmt.Errorf("error decoding node information: %w", err)
+	}
 
 	return nodeInfo, nil
 }
+
+// checkStatus returns an error, with the start of the body, if res isn't a 2xx response
+func checkStatus(res *http.Response) error {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", res.StatusCode, body)
+	}
+
+	return nil
+}
+
+// do sends req, logging it at debug level with a request ID
+func (h *Hive) do(req *http.Request) (*http.Response, error) {
+	l := logger.FromContext(req.Context(), h.Logger).With(
+		"requestID", logger.NewRequestID(),
+		"method", req.Method,
+		"url", logger.RedactURL(req.URL),
+	)
+
+	start := time.Now()
+
+	res, err := h.httpClient.Do(req)
+	if err != nil {
+		l.Debug("Hive request failed", "duration", time.Since(start), "err", err)
+		return nil, err
+	}
+
+	l.Debug("Hive request", "status", res.StatusCode, "duration", time.Since(start))
+
+	return res, nil
+}
+
+// logCognito logs a request to Cognito, made to generate a token, at debug level with a request ID
+func (h *Hive) logCognito(ctx context.Context, operation string, start time.Time, err error, keysAndValues ...interface{}) {
+	l := logger.FromContext(ctx, h.Logger).With(
+		"requestID", logger.NewRequestID(),
+		"operation", operation,
+		"duration", time.Since(start),
+	).With(keysAndValues...)
+
+	if err != nil {
+		l.Debug("Cognito request failed", "err", err)
+		return
+	}
+
+	l.Debug("Cognito request")
+}
+
+// withTimeout returns a copy of ctx that is cancelled once the configured timeout elapses
+func (h *Hive) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	t := h.Timeout
+	if t <= 0 {
+		t = DefaultTimeout
+	}
+
+	return context.WithTimeout(ctx, t)
+}
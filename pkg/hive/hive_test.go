@@ -2,12 +2,19 @@ package hive_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/simondrake/home-stats/pkg/cognitosrp"
 	"github.com/simondrake/home-stats/pkg/hive"
+	"github.com/simondrake/home-stats/pkg/logger"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,44 +29,470 @@ func (m *mockClient) Do(req *http.Request) (*http.Response, error) {
 	return m.response, m.err
 }
 
+// fakeCognito is a Cognito server which sends each of its replies in turn,
+// recording the requests it receives
+type fakeCognito struct {
+	*httptest.Server
+	replies  []cognitoReply
+	requests []cognitoRequest
+}
+
+type cognitoReply struct {
+	operation string
+	status    int
+	body      string
+}
+
+type cognitoRequest struct {
+	operation string
+	body      map[string]interface{}
+}
+
+// param returns key from the map field of the request, e.g. AuthParameters
+func (r cognitoRequest) param(field, key string) interface{} {
+	m, _ := r.body[field].(map[string]interface{})
+	return m[key]
+}
+
+func newFakeCognito(t *testing.T, replies ...cognitoReply) *fakeCognito {
+	f := &fakeCognito{replies: replies}
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := cognitoRequest{operation: strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSCognitoIdentityProviderService.")}
+		json.NewDecoder(r.Body).Decode(&req.body)
+		f.requests = append(f.requests, req)
+
+		if len(f.replies) == 0 {
+			t.Errorf("unexpected %s request", req.operation)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		reply := f.replies[0]
+		f.replies = f.replies[1:]
+
+		if reply.operation != req.operation {
+			t.Errorf("expected a %s request, got %s", reply.operation, req.operation)
+		}
+
+		w.WriteHeader(reply.status)
+		w.Write([]byte(reply.body))
+	}))
+
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// hive returns a Hive which generates tokens with the fake
+func (f *fakeCognito) hive(c hive.Config) *hive.Hive {
+	c.AuthEndpoint = f.URL
+	c.Username = "user@example.com"
+	c.SSOPoolID = "eu-west-1_pool"
+	c.SSOPublicCognitoClientID = "client-id"
+
+	return hive.New(c, f.Client())
+}
+
+const (
+	passwordVerifierReply = `{
+		"ChallengeName": "PASSWORD_VERIFIER",
+		"ChallengeParameters": {"USERNAME": "internal-user", "USER_ID_FOR_SRP": "internal-user", "SALT": "499602d2", "SRP_B": "499602d2", "SECRET_BLOCK": "c2VjcmV0"},
+		"Session": "session-1"
+	}`
+	notAuthorizedReply = `{"__type": "NotAuthorizedException", "message": "Incorrect username or password."}`
+)
+
 func TestGenerateToken(t *testing.T) {
-	t.Skip("Find a way of testing cognitosrp")
+	t.Run("should error without a password or refresh token", func(t *testing.T) {
+		a := assert.New(t)
+
+		h := hive.New(hive.Config{}, nil)
+
+		a.EqualError(h.GenerateToken(), "a password or refresh token is required")
+	})
+	t.Run("should refresh the token with the refresh token and device key", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t, cognitoReply{"InitiateAuth", http.StatusOK, `{"AuthenticationResult": {"IdToken": "id-token", "ExpiresIn": 3600}}`})
+		h := f.hive(hive.Config{RefreshToken: "refresh-token", Device: hive.Device{Key: "device-key"}})
+
+		a.NoError(h.GenerateToken())
+		a.WithinDuration(time.Now().Add(time.Hour), h.TokenExpiry(), time.Minute)
+
+		a.Len(f.requests, 1)
+		a.Equal("REFRESH_TOKEN_AUTH", f.requests[0].body["AuthFlow"])
+		a.Equal("client-id", f.requests[0].body["ClientId"])
+		a.Equal("refresh-token", f.requests[0].param("AuthParameters", "REFRESH_TOKEN"))
+		a.Equal("device-key", f.requests[0].param("AuthParameters", "DEVICE_KEY"))
+	})
+	t.Run("should return the error from Cognito", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t, cognitoReply{"InitiateAuth", http.StatusBadRequest, notAuthorizedReply})
+		h := f.hive(hive.Config{Password: "password"})
+
+		err := h.GenerateToken()
+
+		a.EqualError(err, "error initiating auth: NotAuthorizedException: Incorrect username or password. (status code: 400)")
+
+		var cerr *cognitosrp.Error
+		a.True(errors.As(err, &cerr))
+		a.True(h.TokenExpiry().IsZero())
+	})
+	t.Run("should log in with the password when the refresh token is rejected, answering MFA and remembering the device", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t,
+			cognitoReply{"InitiateAuth", http.StatusBadRequest, notAuthorizedReply},
+			cognitoReply{"InitiateAuth", http.StatusOK, passwordVerifierReply},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"ChallengeName": "SOFTWARE_TOKEN_MFA", "Session": "session-2"}`},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"AuthenticationResult": {
+				"AccessToken": "access-token", "IdToken": "id-token", "ExpiresIn": 3600, "RefreshToken": "new-refresh-token",
+				"NewDeviceMetadata": {"DeviceKey": "new-device-key", "DeviceGroupKey": "new-device-group-key"}
+			}}`},
+			cognitoReply{"ConfirmDevice", http.StatusOK, `{"UserConfirmationNecessary": true}`},
+			cognitoReply{"UpdateDeviceStatus", http.StatusOK, `{}`},
+		)
+
+		var (
+			challenge    string
+			refreshToken string
+			device       hive.Device
+		)
+
+		h := f.hive(hive.Config{
+			Password:     "password",
+			RefreshToken: "expired-refresh-token",
+			MFACode: func(ctx context.Context, c, destination string) (string, error) {
+				challenge = c
+				return "123456", nil
+			},
+			OnCredentials: func(r string, d hive.Device) error {
+				refreshToken, device = r, d
+				return nil
+			},
+		})
+
+		a.NoError(h.GenerateToken())
+		a.WithinDuration(time.Now().Add(time.Hour), h.TokenExpiry(), time.Minute)
+		a.Equal(hive.ChallengeSoftwareTokenMFA, challenge)
+
+		a.Len(f.requests, 6)
+
+		a.Equal("USER_SRP_AUTH", f.requests[1].body["AuthFlow"])
+		a.Equal("user@example.com", f.requests[1].param("AuthParameters", "USERNAME"))
+		a.NotEmpty(f.requests[1].param("AuthParameters", "SRP_A"))
+
+		a.Equal("PASSWORD_VERIFIER", f.requests[2].body["ChallengeName"])
+		a.Equal("session-1", f.requests[2].body["Session"])
+		a.Equal("internal-user", f.requests[2].param("ChallengeResponses", "USERNAME"))
+		a.NotEmpty(f.requests[2].param("ChallengeResponses", "PASSWORD_CLAIM_SIGNATURE"))
 
-	t.Run("should return an error when the request fails", func(t *testing.T) {
+		a.Equal("SOFTWARE_TOKEN_MFA", f.requests[3].body["ChallengeName"])
+		a.Equal("session-2", f.requests[3].body["Session"])
+		a.Equal("internal-user", f.requests[3].param("ChallengeResponses", "USERNAME"))
+		a.Equal("123456", f.requests[3].param("ChallengeResponses", "SOFTWARE_TOKEN_MFA_CODE"))
+
+		a.Equal("access-token", f.requests[4].body["AccessToken"])
+		a.Equal("new-device-key", f.requests[4].body["DeviceKey"])
+		a.NotEmpty(f.requests[4].param("DeviceSecretVerifierConfig", "PasswordVerifier"))
+		a.NotEmpty(f.requests[4].param("DeviceSecretVerifierConfig", "Salt"))
+
+		a.Equal("new-device-key", f.requests[5].body["DeviceKey"])
+		a.Equal("remembered", f.requests[5].body["DeviceRememberedStatus"])
+
+		a.Equal("new-refresh-token", refreshToken)
+		a.Equal("new-refresh-token", h.RefreshToken)
+		a.Equal("new-device-key", device.Key)
+		a.Equal("new-device-group-key", device.GroupKey)
+		a.NotEmpty(device.Password)
+		a.Equal(device, h.Device)
+	})
+	t.Run("should log in as the remembered device without MFA", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t,
+			cognitoReply{"InitiateAuth", http.StatusOK, passwordVerifierReply},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"ChallengeName": "DEVICE_SRP_AUTH", "Session": "session-2"}`},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{
+				"ChallengeName": "DEVICE_PASSWORD_VERIFIER",
+				"ChallengeParameters": {"USERNAME": "internal-user", "SALT": "499602d2", "SRP_B": "499602d2", "SECRET_BLOCK": "c2VjcmV0"},
+				"Session": "session-3"
+			}`},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"AuthenticationResult": {"IdToken": "id-token", "ExpiresIn": 3600}}`},
+		)
+
+		device := hive.Device{Key: "device-key", GroupKey: "device-group-key", Password: "device-password"}
+		h := f.hive(hive.Config{Password: "password", Device: device})
+
+		a.NoError(h.GenerateToken())
+		a.WithinDuration(time.Now().Add(time.Hour), h.TokenExpiry(), time.Minute)
+		a.Equal(device, h.Device)
+
+		a.Len(f.requests, 4)
+
+		a.Equal("device-key", f.requests[0].param("AuthParameters", "DEVICE_KEY"))
+		a.Equal("device-key", f.requests[1].param("ChallengeResponses", "DEVICE_KEY"))
+
+		a.Equal("DEVICE_SRP_AUTH", f.requests[2].body["ChallengeName"])
+		a.Equal("session-2", f.requests[2].body["Session"])
+		a.Equal("internal-user", f.requests[2].param("ChallengeResponses", "USERNAME"))
+		a.Equal("device-key", f.requests[2].param("ChallengeResponses", "DEVICE_KEY"))
+		a.NotEmpty(f.requests[2].param("ChallengeResponses", "SRP_A"))
+
+		a.Equal("DEVICE_PASSWORD_VERIFIER", f.requests[3].body["ChallengeName"])
+		a.Equal("session-3", f.requests[3].body["Session"])
+		a.Equal("internal-user", f.requests[3].param("ChallengeResponses", "USERNAME"))
+		a.Equal("device-key", f.requests[3].param("ChallengeResponses", "DEVICE_KEY"))
+		a.NotEmpty(f.requests[3].param("ChallengeResponses", "PASSWORD_CLAIM_SIGNATURE"))
+	})
+	t.Run("should return ErrMFARequired without an MFACodeFunc", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t,
+			cognitoReply{"InitiateAuth", http.StatusOK, passwordVerifierReply},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"ChallengeName": "SMS_MFA", "ChallengeParameters": {"CODE_DELIVERY_DESTINATION": "+*******1234"}}`},
+		)
+		h := f.hive(hive.Config{Password: "password"})
+
+		a.True(errors.Is(h.GenerateToken(), hive.ErrMFARequired))
+		a.True(h.TokenExpiry().IsZero())
+	})
+	t.Run("should answer an MFA challenge once its code is available", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t,
+			cognitoReply{"InitiateAuth", http.StatusOK, passwordVerifierReply},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"ChallengeName": "SMS_MFA", "ChallengeParameters": {"CODE_DELIVERY_DESTINATION": "+*******1234"}, "Session": "session-2"}`},
+			cognitoReply{"RespondToAuthChallenge", http.StatusOK, `{"AuthenticationResult": {"IdToken": "id-token", "ExpiresIn": 3600}}`},
+		)
+
+		var code string
+
+		h := f.hive(hive.Config{
+			Password: "password",
+			MFACode: func(ctx context.Context, challenge, destination string) (string, error) {
+				if code == "" {
+					return "", hive.ErrMFACodePending
+				}
+
+				return code, nil
+			},
+		})
+
+		err := h.GenerateToken()
+		a.EqualError(err, "error getting MFA code: MFA code required")
+		a.True(errors.Is(err, hive.ErrMFACodePending))
+		a.Len(f.requests, 2)
+
+		// The challenge is answered without logging in again, which would send another code
+		code = "123456"
+
+		a.NoError(h.GenerateToken())
+		a.WithinDuration(time.Now().Add(time.Hour), h.TokenExpiry(), time.Minute)
+
+		a.Len(f.requests, 3)
+		a.Equal("SMS_MFA", f.requests[2].body["ChallengeName"])
+		a.Equal("session-2", f.requests[2].body["Session"])
+		a.Equal("internal-user", f.requests[2].param("ChallengeResponses", "USERNAME"))
+		a.Equal("123456", f.requests[2].param("ChallengeResponses", "SMS_MFA_CODE"))
+	})
+	t.Run("should error with a malformed password challenge", func(t *testing.T) {
+		a := assert.New(t)
+
+		f := newFakeCognito(t, cognitoReply{"InitiateAuth", http.StatusOK, `{"ChallengeName": "PASSWORD_VERIFIER", "ChallengeParameters": {"SALT": "499602d2", "SRP_B": "not hex"}}`})
+		h := f.hive(hive.Config{Password: "password"})
+
+		a.EqualError(h.GenerateToken(), `error answering password challenge: unable to decode challenge parameter 'SRP_B', unable to convert "not hex" to big Int`)
+	})
+}
+
+func TestTokenExpiry(t *testing.T) {
+	t.Run("should be zero before a token is generated", func(t *testing.T) {
+		h := hive.New(hive.Config{}, nil)
+
+		assert.True(t, h.TokenExpiry().IsZero())
+	})
+}
+
+func TestGetTempForNode(t *testing.T) {
+	t.Run("should return the reported temperature", func(t *testing.T) {
+		a := assert.New(t)
+
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{"nodes": [{"attributes": {"temperature": {"reportedValue": 19.5}}}]}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
+
+		h := hive.New(hive.Config{}, mc)
+
+		temp, err := h.GetTempForNode("test-node")
+		a.NoError(err)
+		a.Equal(19.5, temp)
+	})
+
+	t.Run("should set a deadline on the request", func(t *testing.T) {
+		a := assert.New(t)
+
+		mc := &mockClient{response: nil, err: errors.New("something went wrong")}
+
+		h := hive.New(hive.Config{Timeout: time.Minute}, mc)
+
+		start := time.Now()
+		_, err := h.GetTempForNodeWithContext(context.Background(), "test-node")
+		a.Error(err)
+
+		deadline, ok := mc.req.Context().Deadline()
+		a.True(ok)
+		a.WithinDuration(start.Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("should log failed requests using the logger in the context", func(t *testing.T) {
 		a := assert.New(t)
 
 		mc := &mockClient{response: nil, err: errors.New("something went wrong")}
 
 		h := hive.New(hive.Config{}, mc)
 
-		a.EqualError(h.GenerateToken(), "error requesting login token: something went wrong")
+		var b bytes.Buffer
+		ctx := logger.NewContext(context.Background(), logger.New(&b, logger.WithLevel(logger.LevelDebug)).With("collector", "thermostat"))
+
+		_, err := h.GetTempForNodeWithContext(ctx, "test-node")
+		a.Error(err)
+
+		a.Contains(b.String(), `msg="Hive request failed"`)
+		a.Contains(b.String(), "collector=thermostat")
+		a.Contains(b.String(), "method=GET")
+		a.Contains(b.String(), `err="something went wrong"`)
 	})
-	t.Run("should return an error if no token is returned", func(t *testing.T) {
+}
+
+func TestGetNodeStatus(t *testing.T) {
+	t.Run("should return the temperature, target, mode and heating relay state", func(t *testing.T) {
 		a := assert.New(t)
 
-		r := ioutil.NopCloser(bytes.NewReader([]byte(`{"message": "everythings fine, but no token"}`)))
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{"nodes": [{"attributes": {
+			"temperature": {"reportedValue": 19.5},
+			"targetHeatTemperature": {"reportedValue": 21},
+			"activeHeatCoolMode": {"reportedValue": "HEAT"},
+			"stateHeatingRelay": {"reportedValue": "ON"}
+		}}]}`)))
 		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
 
 		h := hive.New(hive.Config{}, mc)
 
-		a.EqualError(h.GenerateToken(), "no token returned")
+		ns, err := h.GetNodeStatus("test-node")
+		a.NoError(err)
+		a.Equal(hive.NodeStatus{Temperature: 19.5, TargetTemperature: 21, Mode: "HEAT", HeatingOn: true, HeatingKnown: true}, ns)
+		a.Equal("attributes.temperature,attributes.targetHeatTemperature,attributes.activeHeatCoolMode,attributes.stateHeatingRelay", mc.req.URL.Query().Get("fields"))
 	})
-	t.Run("should set the token when returned", func(t *testing.T) {
+
+	t.Run("should return the temperature when the relay state is missing", func(t *testing.T) {
 		a := assert.New(t)
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{"nodes": [{"attributes": {"temperature": {"reportedValue": 19.5}}}]}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
+
+		h := hive.New(hive.Config{}, mc)
 
-		r := ioutil.NopCloser(bytes.NewReader([]byte(`{"token": "a-special-token"}`)))
+		ns, err := h.GetNodeStatus("test-node")
+		a.NoError(err)
+		a.Equal(hive.NodeStatus{Temperature: 19.5}, ns)
+	})
+
+	t.Run("should return an error when Hive rejects the request", func(t *testing.T) {
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{"error": "NOT_AUTHORIZED"}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusUnauthorized, Body: r}}
+
+		h := hive.New(hive.Config{}, mc)
+
+		_, err := h.GetNodeStatus("test-node")
+		assert.EqualError(t, err, `error getting node information: unexpected status code 401: {"error": "NOT_AUTHORIZED"}`)
+	})
+
+	t.Run("should return an error when the response isn't JSON", func(t *testing.T) {
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`<html>`)))
 		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
 
 		h := hive.New(hive.Config{}, mc)
 
-		a.NoError(h.GenerateToken())
+		_, err := h.GetNodeStatus("test-node")
+		assert.EqualError(t, err, "error getting node information: error decoding node information: invalid character '<' looking for beginning of value")
+	})
+}
+
+func TestBoostHeating(t *testing.T) {
+	t.Run("should use the context passed in", func(t *testing.T) {
+		a := assert.New(t)
+
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
+
+		h := hive.New(hive.Config{}, mc)
+
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "value")
+
+		a.NoError(h.BoostHeatingWithContext(ctx, "test-node", 30, 22))
+		a.Equal(http.MethodPut, mc.req.Method)
+		a.Equal("value", mc.req.Context().Value(key{}))
+	})
 
-		// Call GetTempForNode so a new request is made to Do with a request
-		// containing the token generated in the last step
+	t.Run("should only send the boost attributes", func(t *testing.T) {
+		a := assert.New(t)
+
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(nil))}}
+
+		h := hive.New(hive.Config{}, mc)
+
+		a.NoError(h.BoostHeating("test-node", 30, 22))
+
+		b, err := ioutil.ReadAll(mc.req.Body)
+		a.NoError(err)
+		a.JSONEq(`{"nodes": [{"attributes": {
+			"activeHeatCoolMode": {"targetValue": "BOOST"},
+			"scheduleLockDuration": {"targetValue": 30},
+			"targetHeatTemperature": {"targetValue": 22}
+		}}]}`, string(b))
+	})
+}
+
+func TestSetMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode hive.Mode
+		body string
+	}{
+		{hive.ModeSchedule, `{"nodes": [{"attributes": {"activeHeatCoolMode": {"targetValue": "HEAT"}, "activeScheduleLock": {"targetValue": false}}}]}`},
+		{hive.ModeManual, `{"nodes": [{"attributes": {"activeHeatCoolMode": {"targetValue": "HEAT"}, "activeScheduleLock": {"targetValue": true}}}]}`},
+		{hive.ModeOff, `{"nodes": [{"attributes": {"activeHeatCoolMode": {"targetValue": "OFF"}}}]}`},
+	} {
+		t.Run("should set the "+string(tc.mode)+" mode", func(t *testing.T) {
+			a := assert.New(t)
+
+			mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(nil))}}
+
+			h := hive.New(hive.Config{}, mc)
+
+			a.NoError(h.SetMode("test-node", tc.mode))
+			a.Equal(http.MethodPut, mc.req.Method)
+
+			b, err := ioutil.ReadAll(mc.req.Body)
+			a.NoError(err)
+			a.JSONEq(tc.body, string(b))
+		})
+	}
+
+	t.Run("should return an error when Hive rejects the mode", func(t *testing.T) {
+		r := ioutil.NopCloser(bytes.NewReader(bytes.Repeat([]byte("x"), 1024)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusForbidden, Body: r}}
+
+		h := hive.New(hive.Config{}, mc)
+
+		// Only the start of the body is included
+		assert.EqualError(t, h.CancelBoost("test-node"), "unexpected status code 403: "+strings.Repeat("x", 512))
+	})
 
-		// There will be an error because we don't return any node information
-		_, _ = h.GetTempForNode("test-node")
+	t.Run("should return an error for an unknown mode", func(t *testing.T) {
+		h := hive.New(hive.Config{}, &mockClient{})
 
-		a.Equal("a-special-token", mc.req.Header.Get("X-Omnia-Access-Token"))
+		assert.EqualError(t, h.SetMode("test-node", "holiday"), `unknown mode "holiday"`)
 	})
 }
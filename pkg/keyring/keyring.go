@@ -0,0 +1,240 @@
+// Package keyring stores secrets, such as refresh tokens, in a local file
+// encrypted with a passphrase, in the style of the file backend of an OS
+// keyring. The whole file is encrypted with AES-256-GCM, using a key derived
+// from the passphrase with scrypt, and is only readable by its owner.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrNotFound is returned by Get when there's no secret with the key
+	ErrNotFound = errors.New("secret not found")
+	// ErrIncorrectPassphrase is returned when the file can't be decrypted with the passphrase
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase, or the file has been modified")
+)
+
+const (
+	fileVersion = 1
+
+	// The scrypt parameters recommended for interactive logins
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+
+	keyLength  = 32
+	saltLength = 16
+)
+
+// encryptedFile is the contents of a keyring file. The scrypt parameters are
+// stored so that they can be changed without breaking existing files
+type encryptedFile struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// File is a keyring stored in a single encrypted file
+type File struct {
+	path       string
+	passphrase string
+}
+
+// NewFile returns a keyring stored at path, encrypted with passphrase.
+// The file is created by the first call to Set
+func NewFile(path, passphrase string) *File {
+	return &File{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+// Path returns the path to the keyring file
+func (f *File) Path() string {
+	return f.path
+}
+
+// Get returns the secret stored with key, or ErrNotFound
+func (f *File) Get(key string) (string, error) {
+	secrets, err := f.read()
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := secrets[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return s, nil
+}
+
+// Set stores secret with key, replacing any secret already stored with it
+func (f *File) Set(key, secret string) error {
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	secrets[key] = secret
+
+	return f.write(secrets)
+}
+
+// Remove removes the secret stored with key, if there is one
+func (f *File) Remove(key string) error {
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := secrets[key]; !ok {
+		return nil
+	}
+
+	delete(secrets, key)
+
+	return f.write(secrets)
+}
+
+// read decrypts the file, returning no secrets if it doesn't exist
+func (f *File) read() (map[string]string, error) {
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keyring: %w", err)
+	}
+
+	var ef encryptedFile
+	if err := json.Unmarshal(b, &ef); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal keyring: %w", err)
+	}
+
+	if ef.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported keyring version %d", ef.Version)
+	}
+
+	gcm, err := f.cipher(ef.Salt, ef.N, ef.R, ef.P)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ef.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(ef.Nonce))
+	}
+
+	plain, err := gcm.Open(nil, ef.Nonce, ef.Data, nil)
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// write encrypts secrets with a new salt and nonce and replaces the file
+func (f *File) write(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("unable to marshal secrets: %w", err)
+	}
+
+	ef := encryptedFile{
+		Version: fileVersion,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLength),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, ef.Salt); err != nil {
+		return fmt.Errorf("unable to generate salt: %w", err)
+	}
+
+	gcm, err := f.cipher(ef.Salt, ef.N, ef.R, ef.P)
+	if err != nil {
+		return err
+	}
+
+	ef.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, ef.Nonce); err != nil {
+		return fmt.Errorf("unable to generate nonce: %w", err)
+	}
+
+	ef.Data = gcm.Seal(nil, ef.Nonce, plain, nil)
+
+	b, err := json.MarshalIndent(ef, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal keyring: %w", err)
+	}
+
+	return writeFile(f.path, b)
+}
+
+func (f *File) cipher(salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(f.passphrase), salt, n, r, p, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// writeFile writes b to a temporary file, readable only by its owner, and
+// renames it over path so that the keyring is never left half written
+func writeFile(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create keyring: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to set keyring permissions: %w", err)
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write keyring: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write keyring: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace keyring: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package keyring_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/simondrake/home-stats/pkg/keyring"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+func TestFile(t *testing.T) {
+	t.Run("should return ErrNotFound when the file doesn't exist", func(t *testing.T) {
+		k := keyring.NewFile(filepath.Join(tempDir(t), "tokens"), "passphrase")
+
+		_, err := k.Get("hive")
+		assert.Equal(t, keyring.ErrNotFound, err)
+	})
+
+	t.Run("should store secrets encrypted and readable only by the owner", func(t *testing.T) {
+		a := assert.New(t)
+		path := filepath.Join(tempDir(t), "tokens")
+		k := keyring.NewFile(path, "passphrase")
+
+		a.NoError(k.Set("hive", "a-refresh-token"))
+		a.NoError(k.Set("other", "another-secret"))
+
+		s, err := keyring.NewFile(path, "passphrase").Get("hive")
+		a.NoError(err)
+		a.Equal("a-refresh-token", s)
+
+		b, err := ioutil.ReadFile(path)
+		a.NoError(err)
+		a.NotContains(string(b), "a-refresh-token")
+
+		fi, err := os.Stat(path)
+		a.NoError(err)
+		a.Equal(os.FileMode(0600), fi.Mode().Perm())
+	})
+
+	t.Run("should remove secrets", func(t *testing.T) {
+		a := assert.New(t)
+		k := keyring.NewFile(filepath.Join(tempDir(t), "tokens"), "passphrase")
+
+		a.NoError(k.Set("hive", "a-refresh-token"))
+		a.NoError(k.Remove("hive"))
+		a.NoError(k.Remove("hive"))
+
+		_, err := k.Get("hive")
+		a.Equal(keyring.ErrNotFound, err)
+	})
+
+	t.Run("should not decrypt the file with the wrong passphrase", func(t *testing.T) {
+		a := assert.New(t)
+		path := filepath.Join(tempDir(t), "tokens")
+
+		a.NoError(keyring.NewFile(path, "passphrase").Set("hive", "a-refresh-token"))
+
+		_, err := keyring.NewFile(path, "wrong").Get("hive")
+		a.Equal(keyring.ErrIncorrectPassphrase, err)
+
+		a.Equal(keyring.ErrIncorrectPassphrase, keyring.NewFile(path, "wrong").Set("hive", "replaced"))
+	})
+
+	t.Run("should error when the file isn't a keyring", func(t *testing.T) {
+		path := filepath.Join(tempDir(t), "tokens")
+		if err := ioutil.WriteFile(path, []byte(`{"version": 9}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := keyring.NewFile(path, "passphrase").Get("hive")
+		assert.EqualError(t, err, "unsupported keyring version 9")
+	})
+}
@@ -0,0 +1,438 @@
+// Package logger is a small structured, levelled logger. Each entry is a
+// message and a list of alternating keys and values, written as logfmt or
+// JSON. The values of keys that look like secrets, such as password or
+// token, are redacted.
+package logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// Level is the severity of an entry
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn (or warning) or error
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Format is how entries are written
+type Format string
+
+const (
+	// Logfmt writes each entry as key=value pairs, e.g. level=info msg="Collecting statistics"
+	Logfmt Format = "logfmt"
+	// JSON writes each entry as a JSON object
+	JSON Format = "json"
+)
+
+// ParseFormat parses logfmt or json
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "logfmt", "":
+		return Logfmt, nil
+	case "json":
+		return JSON, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q", s)
+	}
+}
+
+// Redacted replaces the value of a secret
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedKeys are the keys whose values are redacted. A key is
+// redacted if, ignoring case, underscores and hyphens, it is or ends with
+// one of these, e.g. password, hivePassword and api_key
+var DefaultRedactedKeys = []string{"password", "passphrase", "token", "apikey", "appid", "secret", "authorization"}
+
+var defaultRedact = normaliseKeys(DefaultRedactedKeys)
+
+func normaliseKeys(keys []string) []string {
+	n := make([]string, len(keys))
+	for i, k := range keys {
+		n[i] = normaliseKey(k)
+	}
+
+	return n
+}
+
+// Option configures a Logger
+type Option func(h *handler)
+
+// WithLevel sets the minimum level written. The default is LevelInfo
+func WithLevel(l Level) Option {
+	return func(h *handler) {
+		h.level = int32(l)
+	}
+}
+
+// WithFormat sets how entries are written. The default is Logfmt
+func WithFormat(f Format) Option {
+	return func(h *handler) {
+		h.format = f
+	}
+}
+
+// WithRedactedKeys adds to the keys whose values are redacted
+func WithRedactedKeys(keys ...string) Option {
+	return func(h *handler) {
+		h.redact = append(h.redact, normaliseKeys(keys)...)
+	}
+}
+
+// handler is shared by a Logger and every Logger derived from it with With
+type handler struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	level  int32
+	redact []string
+	now    func() time.Time
+}
+
+// Logger writes structured entries. A nil *Logger discards everything,
+// so it can be used as the default in a Config
+type Logger struct {
+	h      *handler
+	fields []interface{}
+}
+
+// New returns a Logger that writes to w
+func New(w io.Writer, opts ...Option) *Logger {
+	h := &handler{
+		w:      w,
+		format: Logfmt,
+		level:  int32(LevelInfo),
+		redact: normaliseKeys(DefaultRedactedKeys),
+		now:    time.Now,
+	}
+
+	for _, o := range opts {
+		o(h)
+	}
+
+	return &Logger{h: h}
+}
+
+// With returns a Logger that adds keysAndValues to every entry
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+
+	return &Logger{h: l.h, fields: fields}
+}
+
+// SetLevel changes the minimum level written by l and every Logger sharing its output
+func (l *Logger) SetLevel(level Level) {
+	if l == nil {
+		return
+	}
+
+	atomic.StoreInt32(&l.h.level, int32(level))
+}
+
+// Enabled reports whether entries at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && int32(level) >= atomic.LoadInt32(&l.h.level)
+}
+
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(LevelDebug, msg, keysAndValues)
+}
+
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(LevelInfo, msg, keysAndValues)
+}
+
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(LevelWarn, msg, keysAndValues)
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(LevelError, msg, keysAndValues)
+}
+
+// StdLogger returns a *log.Logger that writes each line at level, for
+// libraries that only accept the standard library logger
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(writerFunc(func(p []byte) (int, error) {
+		l.log(level, strings.TrimRight(string(p), "\n"), nil)
+		return len(p), nil
+	}), "", 0)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (l *Logger) log(level Level, msg string, keysAndValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	kvs := make([]interface{}, 0, 6+len(l.fields)+len(keysAndValues))
+	kvs = append(kvs, "time", l.h.now(), "level", level.String(), "msg", msg)
+	kvs = append(kvs, l.fields...)
+	kvs = append(kvs, keysAndValues...)
+
+	// An odd number of keys and values has a value without a key
+	if len(kvs)%2 != 0 {
+		kvs = append(kvs[:len(kvs)-1], "!BADKEY", kvs[len(kvs)-1])
+	}
+
+	var b bytes.Buffer
+
+	if l.h.format == JSON {
+		l.h.writeJSON(&b, kvs)
+	} else {
+		l.h.writeLogfmt(&b, kvs)
+	}
+
+	b.WriteByte('\n')
+
+	l.h.mu.Lock()
+	defer l.h.mu.Unlock()
+
+	_, _ = l.h.w.Write(b.Bytes())
+}
+
+func (h *handler) writeLogfmt(b *bytes.Buffer, kvs []interface{}) {
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		key := fmt.Sprint(kvs[i])
+
+		b.WriteString(logfmtKey(key))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(h.value(key, kvs[i+1])))
+	}
+}
+
+func (h *handler) writeJSON(b *bytes.Buffer, kvs []interface{}) {
+	b.WriteByte('{')
+
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key := fmt.Sprint(kvs[i])
+
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+
+		v := h.value(key, kvs[i+1])
+
+		// Numbers and booleans are kept as JSON numbers and booleans
+		if _, ok := v.(string); !ok {
+			if j, err := json.Marshal(v); err == nil {
+				b.Write(j)
+				continue
+			}
+
+			v = fmt.Sprint(v)
+		}
+
+		s, _ := json.Marshal(v)
+		b.Write(s)
+	}
+
+	b.WriteByte('}')
+}
+
+// value returns v in the form it should be written, redacting secrets
+func (h *handler) value(key string, v interface{}) interface{} {
+	if h.redacted(key) {
+		return Redacted
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return t.Format("2006-01-02T15:04:05.000Z07:00")
+	case time.Duration:
+		return t.String()
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return t
+	default:
+		return fmt.Sprintf("%+v", t)
+	}
+}
+
+func (h *handler) redacted(key string) bool {
+	return isSecret(h.redact, key)
+}
+
+// isSecret reports whether the normalised key ends with any of redact
+func isSecret(redact []string, key string) bool {
+	k := normaliseKey(key)
+
+	for _, r := range redact {
+		if strings.HasSuffix(k, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normaliseKey(k string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(k))
+}
+
+func logfmtKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+
+		return r
+	}, k)
+}
+
+func logfmtValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	if s == "" || strings.IndexFunc(s, needsQuote) >= 0 {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func needsQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r)
+}
+
+// RedactURL returns u with any password, and the values of any secret query
+// parameters such as appid or token, replaced so that it can be logged
+func RedactURL(u *url.URL) string {
+	c := *u
+
+	if _, ok := c.User.Password(); ok {
+		c.User = url.UserPassword(c.User.Username(), "REDACTED")
+	}
+
+	if c.RawQuery != "" {
+		params := strings.Split(c.RawQuery, "&")
+
+		for i, p := range params {
+			k := strings.SplitN(p, "=", 2)[0]
+
+			if name, err := url.QueryUnescape(k); err == nil && isSecret(defaultRedact, name) {
+				params[i] = k + "=REDACTED"
+			}
+		}
+
+		c.RawQuery = strings.Join(params, "&")
+	}
+
+	return c.String()
+}
+
+// RedactError returns err with its URL redacted by RedactURL, if it's a
+// *url.Error as returned by http.Client.Do. Other errors are returned as they are
+func RedactError(err error) error {
+	ue, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+
+	u, perr := url.Parse(ue.URL)
+	if perr != nil {
+		return &url.Error{Op: ue.Op, URL: "REDACTED", Err: ue.Err}
+	}
+
+	return &url.Error{Op: ue.Op, URL: RedactURL(u), Err: ue.Err}
+}
+
+// NewRequestID returns a random ID, used to tie together the entries logged for a request to an upstream service
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger carried by ctx, or fallback if there isn't one
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok && l != nil {
+		return l
+	}
+
+	return fallback
+}
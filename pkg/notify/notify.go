@@ -0,0 +1,63 @@
+// Package notify sends notifications to webhooks, email, push services and Telegram
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/logger"
+)
+
+// DefaultTimeout is the maximum duration of a single notification
+// when a notifier's Timeout isn't set
+const DefaultTimeout = 30 * time.Second
+
+// Notification is a message to be sent by a Notifier
+type Notification struct {
+	Title   string
+	Message string
+	// Resolved is set when the notification reports that a problem has cleared
+	Resolved bool
+	// Urgent is set when the notification needs immediate attention, and
+	// is sent with the highest priority the notifier supports
+	Urgent bool
+}
+
+// Notifier sends notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// httpClient implements the Do method, which is the exact
+// API of the http.Client's DO function. This helps with testing.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// send makes a request with the given timeout and returns an error for an unsuccessful status code
+func send(ctx context.Context, client httpClient, timeout time.Duration, req *http.Request) error {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error making request: %w", logger.RedactError(err))
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", res.StatusCode, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+func newServer(status int, reqs *[]request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		*reqs = append(*reqs, request{method: r.Method, path: r.URL.Path, header: r.Header, body: string(b)})
+		w.WriteHeader(status)
+	}))
+}
+
+// clientFunc adapts a function to an httpClient
+type clientFunc func(req *http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var testNotification = Notification{Title: "Too cold", Message: "It is 15 degrees"}
+
+func TestWebhook(t *testing.T) {
+	t.Run("should post the notification as JSON", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		w := NewWebhook(srv.URL+"/hook", map[string]string{"X-Api-Key": "key"}, nil)
+
+		a.NoError(w.Notify(context.Background(), Notification{Title: "Too cold", Message: "It is 15 degrees", Resolved: true}))
+		a.Len(reqs, 1)
+		a.Equal(http.MethodPost, reqs[0].method)
+		a.Equal("/hook", reqs[0].path)
+		a.Equal("key", reqs[0].header.Get("X-Api-Key"))
+		a.JSONEq(`{"title": "Too cold", "message": "It is 15 degrees", "status": "resolved"}`, reqs[0].body)
+	})
+
+	t.Run("should flag urgent notifications", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		a.NoError(NewWebhook(srv.URL, nil, nil).Notify(context.Background(), Notification{Title: "Boost failed", Message: "timeout", Urgent: true}))
+		a.Len(reqs, 1)
+		a.JSONEq(`{"title": "Boost failed", "message": "timeout", "status": "firing", "urgent": true}`, reqs[0].body)
+	})
+
+	t.Run("should return an error for an unsuccessful status code", func(t *testing.T) {
+		var reqs []request
+		srv := newServer(http.StatusInternalServerError, &reqs)
+		defer srv.Close()
+
+		err := NewWebhook(srv.URL, nil, nil).Notify(context.Background(), testNotification)
+
+		assert.EqualError(t, err, "unexpected status code 500: ")
+	})
+}
+
+func TestNtfy(t *testing.T) {
+	t.Run("should publish the notification to the topic", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		n := NewNtfy(srv.URL+"/home-stats", "token", nil)
+		n.Priority = "high"
+
+		a.NoError(n.Notify(context.Background(), testNotification))
+		a.Len(reqs, 1)
+		a.Equal("/home-stats", reqs[0].path)
+		a.Equal("Too cold", reqs[0].header.Get("Title"))
+		a.Equal("high", reqs[0].header.Get("Priority"))
+		a.Equal("warning", reqs[0].header.Get("Tags"))
+		a.Equal("Bearer token", reqs[0].header.Get("Authorization"))
+		a.Equal("It is 15 degrees", reqs[0].body)
+	})
+
+	t.Run("should use the urgent priority for urgent notifications", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		n := NewNtfy(srv.URL+"/home-stats", "", nil)
+		n.Priority = "low"
+
+		a.NoError(n.Notify(context.Background(), Notification{Title: "Boost failed", Message: "timeout", Urgent: true}))
+		a.Len(reqs, 1)
+		a.Equal("urgent", reqs[0].header.Get("Priority"))
+		a.Equal("rotating_light", reqs[0].header.Get("Tags"))
+		a.Empty(reqs[0].header.Get("Authorization"))
+	})
+}
+
+func TestGotify(t *testing.T) {
+	t.Run("should post the notification as a message", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		g := NewGotify(srv.URL+"/", "app-token", nil)
+		g.Priority = 5
+
+		a.NoError(g.Notify(context.Background(), testNotification))
+		a.Len(reqs, 1)
+		a.Equal("/message", reqs[0].path)
+		a.Equal("app-token", reqs[0].header.Get("X-Gotify-Key"))
+		a.JSONEq(`{"title": "Too cold", "message": "It is 15 degrees", "priority": 5}`, reqs[0].body)
+	})
+
+	t.Run("should raise the priority of urgent notifications", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		g := NewGotify(srv.URL, "app-token", nil)
+		g.Priority = 5
+
+		a.NoError(g.Notify(context.Background(), Notification{Title: "Boost failed", Message: "timeout", Urgent: true}))
+		a.Len(reqs, 1)
+		a.JSONEq(`{"title": "Boost failed", "message": "timeout", "priority": 8}`, reqs[0].body)
+	})
+}
+
+func TestTelegram(t *testing.T) {
+	t.Run("should send the notification to the chat", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		tg := NewTelegram("123:abc", "-100200", nil)
+		tg.URL = srv.URL + "/"
+
+		a.NoError(tg.Notify(context.Background(), testNotification))
+		a.Len(reqs, 1)
+		a.Equal(http.MethodPost, reqs[0].method)
+		a.Equal("/bot123:abc/sendMessage", reqs[0].path)
+		a.JSONEq(`{"chat_id": "-100200", "text": "Too cold\n\nIt is 15 degrees"}`, reqs[0].body)
+	})
+
+	t.Run("should mark urgent notifications and send resolved notifications silently", func(t *testing.T) {
+		a := assert.New(t)
+
+		var reqs []request
+		srv := newServer(http.StatusOK, &reqs)
+		defer srv.Close()
+
+		tg := NewTelegram("123:abc", "@home", nil)
+		tg.URL = srv.URL
+
+		a.NoError(tg.Notify(context.Background(), Notification{Title: "Boost failed", Message: "timeout", Urgent: true}))
+		a.NoError(tg.Notify(context.Background(), Notification{Title: "Too cold", Message: "It is 18 degrees", Resolved: true}))
+		a.Len(reqs, 2)
+		a.JSONEq(`{"chat_id": "@home", "text": "❗ Boost failed\n\ntimeout"}`, reqs[0].body)
+		a.JSONEq(`{"chat_id": "@home", "text": "Too cold\n\nIt is 18 degrees", "disable_notification": true}`, reqs[1].body)
+	})
+
+	t.Run("should return an error for an unsuccessful status code", func(t *testing.T) {
+		var reqs []request
+		srv := newServer(http.StatusUnauthorized, &reqs)
+		defer srv.Close()
+
+		tg := NewTelegram("bad", "1", nil)
+		tg.URL = srv.URL
+
+		assert.EqualError(t, tg.Notify(context.Background(), testNotification), "unexpected status code 401: ")
+	})
+
+	t.Run("should not return the token in request errors", func(t *testing.T) {
+		tg := NewTelegram("123:abc", "1", clientFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, &url.Error{Op: "Post", URL: req.URL.String(), Err: errors.New("connection refused")}
+		}))
+
+		assert.EqualError(t, tg.Notify(context.Background(), testNotification), `error making request: Post "https://api.telegram.org/botREDACTED/sendMessage": connection refused`)
+	})
+}
+
+func TestEmail(t *testing.T) {
+	t.Run("should send the notification", func(t *testing.T) {
+		a := assert.New(t)
+
+		var (
+			gotAddr string
+			gotTo   []string
+			gotMsg  string
+			gotAuth smtp.Auth
+		)
+
+		e := NewEmail("smtp.example.com", 587, "user", "password", "home-stats@example.com", []string{"a@example.com", "b@example.com"})
+		e.sendMail = func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			_, ok := ctx.Deadline()
+			a.True(ok, "should send with a deadline")
+
+			gotAddr, gotAuth, gotTo, gotMsg = addr, auth, to, string(msg)
+			return nil
+		}
+
+		a.NoError(e.Notify(context.Background(), Notification{Title: "Too\ncold", Message: "It is 15 degrees"}))
+		a.Equal("smtp.example.com:587", gotAddr)
+		a.NotNil(gotAuth)
+		a.Equal([]string{"a@example.com", "b@example.com"}, gotTo)
+		a.Contains(gotMsg, "To: a@example.com, b@example.com\r\n")
+		a.Contains(gotMsg, "Subject: Too cold\r\n")
+		a.Contains(gotMsg, "\r\n\r\nIt is 15 degrees\r\n")
+		a.NotContains(gotMsg, "X-Priority")
+	})
+
+	t.Run("should mark urgent notifications as high importance", func(t *testing.T) {
+		a := assert.New(t)
+
+		var gotMsg string
+
+		e := NewEmail("smtp.example.com", 25, "", "", "home-stats@example.com", []string{"a@example.com"})
+		e.sendMail = func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			gotMsg = string(msg)
+			return nil
+		}
+
+		a.NoError(e.Notify(context.Background(), Notification{Title: "Boost failed", Message: "timeout", Urgent: true}))
+		a.Contains(gotMsg, "X-Priority: 1\r\n")
+		a.Contains(gotMsg, "Importance: high\r\n")
+	})
+
+	t.Run("should return an error when sending fails", func(t *testing.T) {
+		e := NewEmail("smtp.example.com", 25, "", "", "home-stats@example.com", []string{"a@example.com"})
+		e.sendMail = func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			return errors.New("connection refused")
+		}
+
+		assert.EqualError(t, e.Notify(context.Background(), testNotification), "error sending email: connection refused")
+	})
+
+	t.Run("should time out when the server doesn't respond", func(t *testing.T) {
+		a := assert.New(t)
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		a.NoError(err)
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			close(done)
+			l.Close()
+		})
+
+		// Accept the connection but never send the greeting
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			<-done
+			conn.Close()
+		}()
+
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		p, _ := strconv.Atoi(port)
+
+		e := NewEmail(host, p, "", "", "home-stats@example.com", []string{"a@example.com"})
+		e.Timeout = 50 * time.Millisecond
+
+		err = e.Notify(context.Background(), testNotification)
+		if a.Error(err) {
+			var ne net.Error
+			a.True(errors.As(err, &ne) && ne.Timeout(), "expected a timeout, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// gotifyUrgentPriority is the lowest Gotify priority that clients treat as high
+const gotifyUrgentPriority = 8
+
+// Ntfy publishes notifications to an ntfy topic
+type Ntfy struct {
+	httpClient httpClient
+	// URL is the topic URL, e.g. https://ntfy.sh/my-topic
+	URL string
+	// Token is an optional access token
+	Token string
+	// Priority is one of min, low, default, high or urgent
+	Priority string
+	Timeout  time.Duration
+}
+
+// NewNtfy takes a topic URL, an optional token and an optional httpClient and returns a pointer to an Ntfy
+func NewNtfy(url, token string, client httpClient) *Ntfy {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Ntfy{httpClient: client, URL: url, Token: token}
+}
+
+// Notify implements Notifier
+func (nt *Ntfy) Notify(ctx context.Context, n Notification) error {
+	req, err := http.NewRequest(http.MethodPost, nt.URL, strings.NewReader(n.Message))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Title", n.Title)
+
+	switch {
+	case n.Resolved:
+		req.Header.Set("Tags", "white_check_mark")
+	case n.Urgent:
+		req.Header.Set("Tags", "rotating_light")
+	default:
+		req.Header.Set("Tags", "warning")
+	}
+
+	switch {
+	case n.Urgent:
+		req.Header.Set("Priority", "urgent")
+	case nt.Priority != "":
+		req.Header.Set("Priority", nt.Priority)
+	}
+
+	if nt.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+nt.Token)
+	}
+
+	return send(ctx, nt.httpClient, nt.Timeout, req)
+}
+
+// Gotify sends notifications to a Gotify server
+type Gotify struct {
+	httpClient httpClient
+	// URL is the server URL, e.g. https://gotify.example.com
+	URL string
+	// Token is the application token
+	Token    string
+	Priority int
+	Timeout  time.Duration
+}
+
+// gotifyMessage is the body of a Gotify message
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// NewGotify takes a server URL, an application token and an optional httpClient and returns a pointer to a Gotify
+func NewGotify(url, token string, client httpClient) *Gotify {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Gotify{httpClient: client, URL: url, Token: token}
+}
+
+// Notify implements Notifier
+func (g *Gotify) Notify(ctx context.Context, n Notification) error {
+	priority := g.Priority
+	if n.Urgent && priority < gotifyUrgentPriority {
+		priority = gotifyUrgentPriority
+	}
+
+	b, err := json.Marshal(gotifyMessage{Title: n.Title, Message: n.Message, Priority: priority})
+	if err != nil {
+		return fmt.Errorf("error marshalling notification: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(g.URL, "/")+"/message", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.Token)
+
+	return send(ctx, g.httpClient, g.Timeout, req)
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTelegramURL is the Telegram Bot API used when a Telegram's URL isn't set
+const DefaultTelegramURL = "https://api.telegram.org"
+
+// Telegram sends notifications to a chat using a Telegram bot
+type Telegram struct {
+	httpClient httpClient
+	// URL is the Bot API server, which only needs to be changed for a self-hosted server
+	URL string
+	// Token is the bot token given by BotFather
+	Token string
+	// ChatID is the ID of the chat, or the @username of the channel, to send to
+	ChatID  string
+	Timeout time.Duration
+}
+
+// telegramMessage is the body of a sendMessage request
+type telegramMessage struct {
+	ChatID              string `json:"chat_id"`
+	Text                string `json:"text"`
+	DisableNotification bool   `json:"disable_notification,omitempty"`
+}
+
+// NewTelegram takes a bot token, a chat ID and an optional httpClient and returns a pointer to a Telegram
+func NewTelegram(token, chatID string, client httpClient) *Telegram {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Telegram{httpClient: client, URL: DefaultTelegramURL, Token: token, ChatID: chatID}
+}
+
+// Notify implements Notifier. Resolved notifications are sent silently
+func (t *Telegram) Notify(ctx context.Context, n Notification) error {
+	text := n.Title + "\n\n" + n.Message
+	if n.Urgent {
+		text = "❗ " + text
+	}
+
+	b, err := json.Marshal(telegramMessage{ChatID: t.ChatID, Text: text, DisableNotification: n.Resolved})
+	if err != nil {
+		return fmt.Errorf("error marshalling notification: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(t.URL, "/"), t.Token)
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return send(ctx, tokenRedactingClient{httpClient: t.httpClient, token: t.Token}, t.Timeout, req)
+}
+
+// tokenRedactingClient masks the bot token in the URL of request errors. It's
+// in the path, which isn't redacted by send
+type tokenRedactingClient struct {
+	httpClient
+	token string
+}
+
+func (c tokenRedactingClient) Do(req *http.Request) (*http.Response, error) {
+	res, err := c.httpClient.Do(req)
+
+	if ue, ok := err.(*url.Error); ok {
+		err = &url.Error{Op: ue.Op, URL: strings.Replace(ue.URL, "/bot"+c.token+"/", "/botREDACTED/", 1), Err: ue.Err}
+	}
+
+	return res, err
+}
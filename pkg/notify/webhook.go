@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook posts notifications as JSON to a URL
+type Webhook struct {
+	httpClient httpClient
+	URL        string
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+// webhookPayload is the body posted by Webhook
+type webhookPayload struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	// Status is either firing or resolved
+	Status string `json:"status"`
+	Urgent bool   `json:"urgent,omitempty"`
+}
+
+// NewWebhook takes a URL, optional headers and an optional httpClient and returns a pointer to a Webhook
+func NewWebhook(url string, headers map[string]string, client httpClient) *Webhook {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Webhook{httpClient: client, URL: url, Headers: headers}
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	status := "firing"
+	if n.Resolved {
+		status = "resolved"
+	}
+
+	b, err := json.Marshal(webhookPayload{Title: n.Title, Message: n.Message, Status: status, Urgent: n.Urgent})
+	if err != nil {
+		return fmt.Errorf("error marshalling notification: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return send(ctx, w.httpClient, w.Timeout, req)
+}
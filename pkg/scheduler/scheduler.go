@@ -0,0 +1,279 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownJob is returned when triggering a job that hasn't been added
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrDuplicateJob is returned when adding a job with a name that is already in use
+	ErrDuplicateJob = errors.New("job already added")
+)
+
+// Job is a function that is run on an interval
+type Job struct {
+	// Name uniquely identifies the job
+	Name string
+	// Interval is the time between runs
+	Interval time.Duration
+	// Jitter is the maximum random delay added before each run
+	Jitter time.Duration
+	// RunOnStart runs the job as soon as the scheduler is started,
+	// rather than waiting for the first interval to elapse
+	RunOnStart bool
+	// Run is called on every run of the job
+	Run func(ctx context.Context)
+}
+
+// Clock provides the time related functions used by the Scheduler,
+// so that they can be replaced in tests
+type Clock interface {
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker is the subset of time.Ticker used by the Scheduler
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Option configures a Scheduler
+type Option func(*Scheduler)
+
+// WithClock sets the Clock used by the Scheduler
+func WithClock(c Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithRand sets the function used to pick the jitter for each run. It is
+// called with the job's Jitter and should return a value in [0, n)
+func WithRand(f func(n int64) int64) Option {
+	return func(s *Scheduler) {
+		s.rand = f
+	}
+}
+
+// WithSkipHandler sets a function that is called whenever a run is
+// skipped because the previous run of the same job hasn't finished
+func WithSkipHandler(f func(name string)) Option {
+	return func(s *Scheduler) {
+		s.onSkip = f
+	}
+}
+
+// Scheduler runs each of its jobs in its own goroutine, on the job's interval.
+// A run is skipped if the previous run of a job with the same name is still in
+// progress, even if that job has since been removed
+type Scheduler struct {
+	clock  Clock
+	rand   func(n int64) int64
+	onSkip func(name string)
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	// running holds the names of the jobs with a run in progress
+	running map[string]bool
+	// ctx and workCtx are set by Start, so that jobs added
+	// afterwards can be started straight away
+	ctx, workCtx context.Context
+
+	wg sync.WaitGroup
+}
+
+type job struct {
+	Job
+	trigger chan struct{}
+	// stop is closed when the job is removed
+	stop chan struct{}
+}
+
+// New creates a Scheduler
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		clock:   realClock{},
+		rand:    rand.Int63n,
+		onSkip:  func(string) {},
+		jobs:    map[string]*job{},
+		running: map[string]bool{},
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// Add adds a job to the Scheduler. A job added after Start has been called is started immediately
+func (s *Scheduler) Add(j Job) error {
+	if j.Interval <= 0 {
+		return fmt.Errorf("invalid interval (%s) for job %s", j.Interval, j.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[j.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, j.Name)
+	}
+
+	jb := &job{Job: j, trigger: make(chan struct{}, 1), stop: make(chan struct{})}
+	s.jobs[j.Name] = jb
+
+	if s.ctx != nil {
+		s.wg.Add(1)
+
+		go s.loop(s.ctx, s.workCtx, jb)
+	}
+
+	return nil
+}
+
+// Remove stops scheduling the named job. A run that is in progress is left to
+// finish, and a job added with the same name won't run until it has
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	delete(s.jobs, name)
+	close(j.stop)
+
+	return nil
+}
+
+// Trigger runs the named job as soon as possible, outside of its usual interval
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	// If a trigger is already pending there is no need for another
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start starts a goroutine for each job, which schedules runs until ctx is
+// cancelled. Runs are passed workCtx, which allows in-flight runs to continue
+// after ctx has been cancelled
+func (s *Scheduler) Start(ctx, workCtx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx, s.workCtx = ctx, workCtx
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+
+		go s.loop(ctx, workCtx, j)
+	}
+}
+
+// Wait blocks until every job goroutine has stopped and every in-flight run has finished
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx, workCtx context.Context, j *job) {
+	defer s.wg.Done()
+
+	t := s.clock.NewTicker(j.Interval)
+	defer t.Stop()
+
+	if j.RunOnStart {
+		s.start(ctx, workCtx, j)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		case <-t.C():
+		case <-j.trigger:
+		}
+
+		// A tick can arrive at the same time as the job is removed
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+
+		s.start(ctx, workCtx, j)
+	}
+}
+
+// start runs j in a new goroutine, unless a job with the same name is already running
+func (s *Scheduler) start(ctx, workCtx context.Context, j *job) {
+	s.mu.Lock()
+	if s.running[j.Name] {
+		s.mu.Unlock()
+		s.onSkip(j.Name)
+		return
+	}
+
+	s.running[j.Name] = true
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, j.Name)
+			s.mu.Unlock()
+		}()
+
+		if j.Jitter > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.clock.After(time.Duration(s.rand(int64(j.Jitter)))):
+			}
+		}
+
+		j.Run(workCtx)
+	}()
+}
@@ -0,0 +1,386 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that only moves forward when Advance is called
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	afters  []*fakeAfter
+}
+
+type fakeTicker struct {
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+	stopped  int32
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               { atomic.StoreInt32(&t.stopped, 1) }
+
+type fakeAfter struct {
+	c  chan time.Time
+	at time.Time
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) scheduler.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTicker{c: make(chan time.Time, 1), interval: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+
+	return t
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	a := &fakeAfter{c: make(chan time.Time, 1), at: c.now.Add(d)}
+	c.afters = append(c.afters, a)
+
+	return a.c
+}
+
+// Advance moves the clock forward by d, firing any tickers and timers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	for _, t := range c.tickers {
+		for atomic.LoadInt32(&t.stopped) == 0 && !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+
+			t.next = t.next.Add(t.interval)
+		}
+	}
+
+	var pending []*fakeAfter
+
+	for _, a := range c.afters {
+		if a.at.After(c.now) {
+			pending = append(pending, a)
+			continue
+		}
+
+		a.c <- a.at
+	}
+
+	c.afters = pending
+}
+
+func (c *fakeClock) counts() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.tickers), len(c.afters)
+}
+
+// waitForTickers blocks until n tickers have been created
+func (c *fakeClock) waitForTickers(t *testing.T, n int) {
+	assert.Eventually(t, func() bool { tickers, _ := c.counts(); return tickers == n }, time.Second, time.Millisecond)
+}
+
+// waitForAfters blocks until n timers are pending
+func (c *fakeClock) waitForAfters(t *testing.T, n int) {
+	assert.Eventually(t, func() bool { _, afters := c.counts(); return afters == n }, time.Second, time.Millisecond)
+}
+
+type counter struct {
+	n int32
+}
+
+func (c *counter) Run(ctx context.Context) { atomic.AddInt32(&c.n, 1) }
+func (c *counter) Count() int32            { return atomic.LoadInt32(&c.n) }
+
+// start starts s and returns a function that stops it and waits for it to finish
+func start(s *scheduler.Scheduler) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx, context.Background())
+
+	return func() {
+		cancel()
+		s.Wait()
+	}
+}
+
+func TestAdd(t *testing.T) {
+	t.Run("should error with an invalid interval", func(t *testing.T) {
+		s := scheduler.New()
+
+		assert.EqualError(t, s.Add(scheduler.Job{Name: "job"}), "invalid interval (0s) for job job")
+	})
+
+	t.Run("should error when a job with the same name has been added", func(t *testing.T) {
+		s := scheduler.New()
+
+		assert.NoError(t, s.Add(scheduler.Job{Name: "job", Interval: time.Minute, Run: func(context.Context) {}}))
+
+		err := s.Add(scheduler.Job{Name: "job", Interval: time.Minute, Run: func(context.Context) {}})
+		assert.True(t, errors.Is(err, scheduler.ErrDuplicateJob))
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("should run a job on its interval", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c))
+		job := &counter{}
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Minute, Run: job.Run}))
+
+		stop := start(s)
+		defer stop()
+
+		c.waitForTickers(t, 1)
+		a.Equal(int32(0), job.Count())
+
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return job.Count() == 1 }, time.Second, time.Millisecond)
+
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return job.Count() == 2 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("should run a job on start when RunOnStart is set", func(t *testing.T) {
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c))
+		job := &counter{}
+
+		assert.NoError(t, s.Add(scheduler.Job{Name: "job", Interval: time.Hour, RunOnStart: true, Run: job.Run}))
+
+		stop := start(s)
+		defer stop()
+
+		assert.Eventually(t, func() bool { return job.Count() == 1 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("should run jobs independently of each other", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c))
+		fast, slow := &counter{}, &counter{}
+		block := make(chan struct{})
+
+		a.NoError(s.Add(scheduler.Job{Name: "slow", Interval: time.Minute, Run: func(ctx context.Context) {
+			<-block
+			slow.Run(ctx)
+		}}))
+		a.NoError(s.Add(scheduler.Job{Name: "fast", Interval: time.Minute, Run: fast.Run}))
+
+		stop := start(s)
+		defer stop()
+		defer close(block)
+
+		c.waitForTickers(t, 2)
+
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return fast.Count() == 1 }, time.Second, time.Millisecond)
+		a.Equal(int32(0), slow.Count())
+	})
+
+	t.Run("should skip a run while the previous run is in progress", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+
+		var skipped int32
+		s := scheduler.New(scheduler.WithClock(c), scheduler.WithSkipHandler(func(name string) {
+			a.Equal("job", name)
+			atomic.AddInt32(&skipped, 1)
+		}))
+
+		job := &counter{}
+		block := make(chan struct{})
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Minute, Run: func(ctx context.Context) {
+			job.Run(ctx)
+			<-block
+		}}))
+
+		stop := start(s)
+		defer stop()
+
+		c.waitForTickers(t, 1)
+
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return job.Count() == 1 }, time.Second, time.Millisecond)
+
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return atomic.LoadInt32(&skipped) == 1 }, time.Second, time.Millisecond)
+		a.Equal(int32(1), job.Count())
+
+		close(block)
+
+		// The first run may not have finished by the time the clock is advanced,
+		// so keep advancing until another run has happened
+		a.Eventually(func() bool {
+			c.Advance(time.Minute)
+			return job.Count() >= 2
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should delay each run by the jitter", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c), scheduler.WithRand(func(n int64) int64 {
+			a.Equal(int64(time.Minute), n)
+			return int64(30 * time.Second)
+		}))
+		job := &counter{}
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Hour, Jitter: time.Minute, Run: job.Run}))
+
+		stop := start(s)
+		defer stop()
+
+		c.waitForTickers(t, 1)
+
+		c.Advance(time.Hour)
+		c.waitForAfters(t, 1)
+		a.Equal(int32(0), job.Count())
+
+		c.Advance(30 * time.Second)
+		a.Eventually(func() bool { return job.Count() == 1 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("should run a job when triggered", func(t *testing.T) {
+		a := assert.New(t)
+		s := scheduler.New(scheduler.WithClock(&fakeClock{}))
+		job := &counter{}
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Hour, Run: job.Run}))
+
+		stop := start(s)
+		defer stop()
+
+		a.NoError(s.Trigger("job"))
+		a.Eventually(func() bool { return job.Count() == 1 }, time.Second, time.Millisecond)
+
+		err := s.Trigger("unknown")
+		a.True(errors.Is(err, scheduler.ErrUnknownJob))
+	})
+
+	t.Run("should wait for in-flight runs once stopped", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c))
+
+		var finished int32
+		started := make(chan struct{})
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Minute, RunOnStart: true, Run: func(ctx context.Context) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+		}}))
+
+		stop := start(s)
+		<-started
+		stop()
+
+		a.Equal(int32(1), atomic.LoadInt32(&finished))
+	})
+
+	t.Run("should start a job added after the scheduler has started", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c))
+		job := &counter{}
+
+		stop := start(s)
+		defer stop()
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Minute, RunOnStart: true, Run: job.Run}))
+		a.Eventually(func() bool { return job.Count() == 1 }, time.Second, time.Millisecond)
+
+		c.waitForTickers(t, 1)
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return job.Count() == 2 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("should stop running a removed job", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+		s := scheduler.New(scheduler.WithClock(c))
+		removed, kept := &counter{}, &counter{}
+
+		a.NoError(s.Add(scheduler.Job{Name: "removed", Interval: time.Minute, Run: removed.Run}))
+		a.NoError(s.Add(scheduler.Job{Name: "kept", Interval: time.Minute, Run: kept.Run}))
+
+		stop := start(s)
+		defer stop()
+
+		c.waitForTickers(t, 2)
+		a.NoError(s.Remove("removed"))
+
+		c.Advance(time.Minute)
+		a.Eventually(func() bool { return kept.Count() == 1 }, time.Second, time.Millisecond)
+		a.Equal(int32(0), removed.Count())
+
+		a.True(errors.Is(s.Remove("removed"), scheduler.ErrUnknownJob))
+		a.True(errors.Is(s.Trigger("removed"), scheduler.ErrUnknownJob))
+
+		// The name can be reused once the job has been removed
+		a.NoError(s.Add(scheduler.Job{Name: "removed", Interval: time.Hour, Run: removed.Run}))
+	})
+
+	t.Run("should not overlap a re-added job with the removed job's run", func(t *testing.T) {
+		a := assert.New(t)
+		c := &fakeClock{}
+
+		var skipped int32
+		s := scheduler.New(scheduler.WithClock(c), scheduler.WithSkipHandler(func(name string) {
+			atomic.AddInt32(&skipped, 1)
+		}))
+
+		old, replacement := &counter{}, &counter{}
+		block := make(chan struct{})
+
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Minute, Run: func(ctx context.Context) {
+			old.Run(ctx)
+			<-block
+		}}))
+
+		stop := start(s)
+		defer stop()
+
+		c.waitForTickers(t, 1)
+		a.NoError(s.Trigger("job"))
+		a.Eventually(func() bool { return old.Count() == 1 }, time.Second, time.Millisecond)
+
+		a.NoError(s.Remove("job"))
+		a.NoError(s.Add(scheduler.Job{Name: "job", Interval: time.Minute, Run: replacement.Run}))
+
+		a.NoError(s.Trigger("job"))
+		a.Eventually(func() bool { return atomic.LoadInt32(&skipped) == 1 }, time.Second, time.Millisecond)
+		a.Equal(int32(0), replacement.Count())
+
+		close(block)
+
+		// The removed job's run may not have finished by the time the
+		// replacement is triggered, so keep triggering until it runs
+		a.Eventually(func() bool {
+			a.NoError(s.Trigger("job"))
+			return replacement.Count() >= 1
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,205 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	defaultDownloadURL    = "https://speed.cloudflare.com/__down?bytes=25000000"
+	defaultUploadURL      = "https://speed.cloudflare.com/__up"
+	defaultLatencyURL     = "https://speed.cloudflare.com/__down?bytes=0"
+	defaultUploadBytes    = 10000000
+	defaultLatencySamples = 5
+
+	// DefaultTimeout is the maximum duration of a single request
+	// when Config.Timeout isn't set
+	DefaultTimeout = 60 * time.Second
+)
+
+type Config struct {
+	// DownloadURL is requested with a GET and the whole response body read
+	DownloadURL string
+	// UploadURL is sent UploadBytes of data with a POST
+	UploadURL string
+	// UploadBytes is the size of the upload
+	UploadBytes int64
+	// LatencyURL is requested with a GET LatencySamples times. It should
+	// return as small a response as possible
+	LatencyURL string
+	// LatencySamples is the number of requests used to measure latency
+	LatencySamples int
+	// Timeout is the maximum duration of a single request
+	Timeout time.Duration
+}
+
+type Speedtest struct {
+	httpClient httpClient
+	Config
+}
+
+// Result is the outcome of a speed test
+type Result struct {
+	// Download is the download throughput in bits per second
+	Download float64
+	// Upload is the upload throughput in bits per second
+	Upload float64
+	// Latency is the median time taken to complete a request to LatencyURL
+	Latency time.Duration
+}
+
+// New takes a Config object and an optional httpClient and returns a
+// pointer to a Speedtest object. Any unset Config values are defaulted
+// to use Cloudflare's speed test endpoints
+func New(c Config, client httpClient) *Speedtest {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	if c.DownloadURL == "" {
+		c.DownloadURL = defaultDownloadURL
+	}
+
+	if c.UploadURL == "" {
+		c.UploadURL = defaultUploadURL
+	}
+
+	if c.UploadBytes <= 0 {
+		c.UploadBytes = defaultUploadBytes
+	}
+
+	if c.LatencyURL == "" {
+		c.LatencyURL = defaultLatencyURL
+	}
+
+	if c.LatencySamples <= 0 {
+		c.LatencySamples = defaultLatencySamples
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	return &Speedtest{
+		httpClient: client,
+		Config:     c,
+	}
+}
+
+// httpClient implements the Do method, which is the exact
+// API of the http.Client's DO function. This helps with testing.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Run measures latency, then download and upload throughput
+func (s *Speedtest) Run(ctx context.Context) (Result, error) {
+	var (
+		r   Result
+		err error
+	)
+
+	if r.Latency, err = s.measureLatency(ctx); err != nil {
+		return r, fmt.Errorf("error measuring latency: %w", err)
+	}
+
+	if r.Download, err = s.measureDownload(ctx); err != nil {
+		return r, fmt.Errorf("error measuring download: %w", err)
+	}
+
+	if r.Upload, err = s.measureUpload(ctx); err != nil {
+		return r, fmt.Errorf("error measuring upload: %w", err)
+	}
+
+	return r, nil
+}
+
+func (s *Speedtest) measureLatency(ctx context.Context) (time.Duration, error) {
+	samples := make([]time.Duration, 0, s.LatencySamples)
+
+	for i := 0; i < s.LatencySamples; i++ {
+		elapsed, _, err := s.do(ctx, http.MethodGet, s.LatencyURL, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+
+		samples = append(samples, elapsed)
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	return samples[len(samples)/2], nil
+}
+
+func (s *Speedtest) measureDownload(ctx context.Context) (float64, error) {
+	elapsed, n, err := s.do(ctx, http.MethodGet, s.DownloadURL, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return bitsPerSecond(n, elapsed), nil
+}
+
+func (s *Speedtest) measureUpload(ctx context.Context) (float64, error) {
+	body := bytes.NewReader(make([]byte, s.UploadBytes))
+
+	elapsed, _, err := s.do(ctx, http.MethodPost, s.UploadURL, body, s.UploadBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	return bitsPerSecond(s.UploadBytes, elapsed), nil
+}
+
+// do makes a request, reads the whole response body and returns the time
+// taken and the number of bytes read
+func (s *Speedtest) do(ctx context.Context, method, url string, body io.Reader, contentLength int64) (time.Duration, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error creating request: %w", err)
+	}
+
+	if body != nil {
+		req.ContentLength = contentLength
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	start := time.Now()
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error making request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	n, err := io.Copy(ioutil.Discard, res.Body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading response: %w", err)
+	}
+
+	elapsed := time.Since(start)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return 0, 0, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return elapsed, n, nil
+}
+
+func bitsPerSecond(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(n*8) / elapsed.Seconds()
+}
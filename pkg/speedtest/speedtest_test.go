@@ -0,0 +1,106 @@
+package speedtest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/simondrake/home-stats/pkg/speedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockClient struct {
+	err error
+}
+
+func (m *mockClient) Do(req *http.Request) (*http.Response, error) {
+	return nil, m.err
+}
+
+func newServer(t *testing.T, uploaded *int64, pings *int32) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(pings, 1)
+	})
+
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, 100000))
+	})
+
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		atomic.StoreInt64(uploaded, n)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should measure latency, download and upload", func(t *testing.T) {
+		a := assert.New(t)
+
+		var (
+			uploaded int64
+			pings    int32
+		)
+
+		srv := newServer(t, &uploaded, &pings)
+		defer srv.Close()
+
+		s := speedtest.New(speedtest.Config{
+			DownloadURL:    srv.URL + "/download",
+			UploadURL:      srv.URL + "/upload",
+			UploadBytes:    50000,
+			LatencyURL:     srv.URL + "/ping",
+			LatencySamples: 3,
+		}, nil)
+
+		r, err := s.Run(context.Background())
+
+		a.NoError(err)
+		a.Greater(r.Download, 0.0)
+		a.Greater(r.Upload, 0.0)
+		a.Greater(int64(r.Latency), int64(0))
+		a.Equal(int64(50000), atomic.LoadInt64(&uploaded))
+		a.Equal(int32(3), atomic.LoadInt32(&pings))
+	})
+
+	t.Run("should return an error for an unsuccessful status code", func(t *testing.T) {
+		var (
+			uploaded int64
+			pings    int32
+		)
+
+		srv := newServer(t, &uploaded, &pings)
+		defer srv.Close()
+
+		s := speedtest.New(speedtest.Config{
+			DownloadURL: srv.URL + "/missing",
+			UploadURL:   srv.URL + "/upload",
+			LatencyURL:  srv.URL + "/ping",
+		}, nil)
+
+		_, err := s.Run(context.Background())
+
+		assert.EqualError(t, err, "error measuring download: unexpected status code: 404")
+	})
+
+	t.Run("should return an error when the request fails", func(t *testing.T) {
+		s := speedtest.New(speedtest.Config{}, &mockClient{err: errors.New("something went wrong")})
+
+		_, err := s.Run(context.Background())
+
+		assert.EqualError(t, err, "error measuring latency: error making request: something went wrong")
+	})
+}
@@ -0,0 +1,45 @@
+package totp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	// The SHA1 test vectors from RFC 6238, truncated to 6 digits. The secret is "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := totp.Code(secret, time.Unix(tt.unix, 0))
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.code, code, "at %d", tt.unix)
+	}
+
+	t.Run("should ignore spaces, case and padding", func(t *testing.T) {
+		code, err := totp.Code("gezd gnbv gy3t qojq gezd gnbv gy3t qojq====", time.Unix(59, 0))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "287082", code)
+	})
+
+	t.Run("should error with an invalid secret", func(t *testing.T) {
+		_, err := totp.Code("not base32!", time.Now())
+
+		assert.EqualError(t, err, "unable to decode secret: illegal base32 data at input byte 9")
+	})
+}
@@ -1,18 +1,33 @@
 package weather
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/simondrake/home-stats/pkg/logger"
 )
 
-const openWeatherMapEndpoint = "https://api.openweathermap.org/data/2.5/weather"
+const (
+	openWeatherMapEndpoint = "https://api.openweathermap.org/data/2.5/weather"
+
+	// DefaultTimeout is the maximum duration of a single request
+	// to OpenWeatherMap when Config.Timeout isn't set
+	DefaultTimeout = 30 * time.Second
+)
 
 type Config struct {
 	City    string
 	Country string
 	APIKey  string
 	Units   string
+	// Timeout is the maximum duration of a single request to OpenWeatherMap
+	Timeout time.Duration
+	// Logger logs each request at debug level, unless the request's context
+	// carries a logger. Nothing is logged if both are nil
+	Logger *logger.Logger
 }
 
 type Weather struct {
@@ -124,7 +139,14 @@ type Sys struct {
 	Sunset int64 `json:"sunset,omitempty"`
 }
 
+// GetCurrentWeather gets the current weather for the configured City and Country
 func (w *Weather) GetCurrentWeather() (CurrentWeather, error) {
+	return w.GetCurrentWeatherWithContext(context.Background())
+}
+
+// GetCurrentWeatherWithContext is the same as GetCurrentWeather, with the
+// addition of a context which is used for the request
+func (w *Weather) GetCurrentWeatherWithContext(ctx context.Context) (CurrentWeather, error) {
 	endpoint := fmt.Sprintf("%s?q=%s,%s&appid=%s", openWeatherMapEndpoint, w.City, w.Country, w.APIKey)
 
 	if w.Units != "" {
@@ -133,16 +155,38 @@ func (w *Weather) GetCurrentWeather() (CurrentWeather, error) {
 
 	var cw CurrentWeather
 
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return cw, fmt.Errorf("error creating request: %w", err)
 	}
 
+	l := logger.FromContext(ctx, w.Logger).With(
+		"requestID", logger.NewRequestID(),
+		"method", req.Method,
+		"url", logger.RedactURL(req.URL),
+	)
+
+	start := time.Now()
+
 	res, err := w.httpClient.Do(req)
 	if err != nil {
+		// The error includes the URL, and so the API key
+		err = logger.RedactError(err)
+
+		l.Debug("OpenWeatherMap request failed", "duration", time.Since(start), "err", err)
 		return cw, fmt.Errorf("error requesting node information: %w", err)
 	}
 
+	l.Debug("OpenWeatherMap request", "status", res.StatusCode, "duration", time.Since(start))
+
 	defer res.Body.Close()
 
 	json.NewDecoder(res.Body).Decode(&cw)
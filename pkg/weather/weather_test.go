@@ -2,12 +2,16 @@ package weather_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/simondrake/home-stats/pkg/logger"
 	"github.com/simondrake/home-stats/pkg/weather"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,10 +20,16 @@ type mockClient struct {
 	req      *http.Request
 	response *http.Response
 	err      error
+	// do, if set, returns the error for req
+	do func(req *http.Request) error
 }
 
 func (m *mockClient) Do(req *http.Request) (*http.Response, error) {
 	m.req = req
+	if m.do != nil {
+		return m.response, m.do(req)
+	}
+
 	return m.response, m.err
 }
 
@@ -77,6 +87,74 @@ func TestGetCurrentWeather(t *testing.T) {
 		expectedURL := fmt.Sprintf("%s?q=%s,%s&appid=%s&units=%s", "https://api.openweathermap.org/data/2.5/weather", w.City, w.Country, w.APIKey, w.Units)
 		assert.Equal(t, expectedURL, mc.req.URL.String())
 	})
+
+	t.Run("should set a deadline on the request", func(t *testing.T) {
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
+
+		w := weather.New(weather.Config{Timeout: time.Minute}, mc)
+
+		start := time.Now()
+		_, err := w.GetCurrentWeather()
+		assert.NoError(t, err)
+
+		deadline, ok := mc.req.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, start.Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("should use the context passed in", func(t *testing.T) {
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
+
+		w := weather.New(weather.Config{}, mc)
+
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "value")
+
+		_, err := w.GetCurrentWeatherWithContext(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", mc.req.Context().Value(key{}))
+	})
+
+	t.Run("should return and log request errors without the API key", func(t *testing.T) {
+		a := assert.New(t)
+		mc := &mockClient{}
+
+		var b bytes.Buffer
+		w := weather.New(weather.Config{City: "London", APIKey: "MockKey", Logger: logger.New(&b, logger.WithLevel(logger.LevelDebug))}, mc)
+
+		// Fail the way http.Client does, with the request URL in the error
+		mc.do = func(req *http.Request) error {
+			return &url.Error{Op: "Get", URL: req.URL.String(), Err: errors.New("i/o timeout")}
+		}
+
+		_, err := w.GetCurrentWeather()
+		if a.Error(err) {
+			a.Contains(err.Error(), "appid=REDACTED")
+			a.NotContains(err.Error(), "MockKey")
+		}
+
+		a.Contains(b.String(), `msg="OpenWeatherMap request failed"`)
+		a.NotContains(b.String(), "MockKey")
+	})
+
+	t.Run("should log the request without the API key", func(t *testing.T) {
+		a := assert.New(t)
+		r := ioutil.NopCloser(bytes.NewReader([]byte(`{}`)))
+		mc := &mockClient{response: &http.Response{StatusCode: http.StatusOK, Body: r}}
+
+		var b bytes.Buffer
+		w := weather.New(weather.Config{City: "London", APIKey: "MockKey", Logger: logger.New(&b, logger.WithLevel(logger.LevelDebug))}, mc)
+
+		_, err := w.GetCurrentWeather()
+		a.NoError(err)
+
+		a.Contains(b.String(), `msg="OpenWeatherMap request"`)
+		a.Contains(b.String(), "requestID=")
+		a.Contains(b.String(), "appid=REDACTED")
+		a.NotContains(b.String(), "MockKey")
+	})
 }
 
 // Test that is able to mock the HTTP request in